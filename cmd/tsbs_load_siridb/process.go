@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -58,7 +57,7 @@ func (p *processor) ProcessBatch(b load.Batch, doLoad bool) (metricCount, rows u
 			now := time.Now()
 			took := now.Sub(start)
 			batchSize := batch.batchCnt
-			fmt.Printf("BATCH: batchsize %d insert rate %f/sec (took %v)\n", batchSize, float64(batchSize)/float64(took.Seconds()), took)
+			loader.Reportf("BATCH: batchsize %d insert rate %f/sec (took %v)\n", batchSize, float64(batchSize)/float64(took.Seconds()), took)
 		}
 	}
 	metricCount = uint64(batch.metricCnt)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// loadChecksum is the sum of the checksums of all rows processed by the
+// workers with -checksum, updated atomically as each worker finishes. A sum
+// does not depend on the order in which the rows were processed, so loads of
+// the same input have the same checksum however the rows were spread across
+// workers.
+var loadChecksum uint64
+
+// rowChecksum returns the FNV-1a hash of the tags and values lines of row as
+// they appear in the input
+func rowChecksum(hypertable string, row *insertData) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(tagsKey + delimiter + row.tags + "\n" + hypertable + delimiter + row.fields + "\n"))
+	return h.Sum64()
+}
+
+// rowsChecksum returns the sum of the checksums of rows of hypertable
+func rowsChecksum(hypertable string, rows []*insertData) uint64 {
+	sum := uint64(0)
+	for _, row := range rows {
+		sum += rowChecksum(hypertable, row)
+	}
+	return sum
+}
+
+// addChecksum adds a worker's checksum to the checksum of the load
+func addChecksum(sum uint64) {
+	atomic.AddUint64(&loadChecksum, sum)
+}
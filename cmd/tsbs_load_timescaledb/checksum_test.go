@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestRowsChecksum(t *testing.T) {
+	a := &insertData{tags: "hostname=host_0", fields: "100,1,2"}
+	b := &insertData{tags: "hostname=host_1", fields: "100,3,4"}
+	sum := rowsChecksum("cpu", []*insertData{a, b})
+	if got := rowsChecksum("cpu", []*insertData{b}) + rowsChecksum("cpu", []*insertData{a}); got != sum {
+		t.Errorf("checksum depends on the order of the rows: got %x want %x", got, sum)
+	}
+	if got := rowsChecksum("mem", []*insertData{a, b}); got == sum {
+		t.Errorf("checksum does not depend on the hypertable")
+	}
+	changed := &insertData{tags: "hostname=host_1", fields: "100,3,5"}
+	if got := rowsChecksum("cpu", []*insertData{a, changed}); got == sum {
+		t.Errorf("checksum does not depend on the values")
+	}
+	if got := rowsChecksum("cpu", []*insertData{a, a}); got == rowsChecksum("cpu", nil) {
+		t.Errorf("checksums of duplicate rows cancel out")
+	}
+}
@@ -4,36 +4,284 @@ import (
 	"bufio"
 	"database/sql"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/lib/pq"
 )
 
-const tagsKey = "tags"
+const (
+	tagsKey          = "tags"
+	defaultFieldType = "DOUBLE PRECISION"
+	// partitionKeyColumn holds the values of the -partition-columns tags and
+	// is used as the space partitioning column when they are set
+	partitionKeyColumn = "partition_key"
+	// maxNativePartitions limits the partitions -partitioning=native creates per table
+	maxNativePartitions = 10000
+	// narrowNameColumn and narrowValueColumn hold the name and value of the
+	// field of each row with -layout=narrow
+	narrowNameColumn  = "metric_name"
+	narrowValueColumn = "value"
+)
 
 var tableCols = make(map[string][]string)
 
+// tableRawFields is a global map of, for each table, whether each of its fields
+// has a column type other than defaultFieldType. Values for such fields are
+// passed to the database as-is instead of being parsed as floats.
+var tableRawFields = make(map[string][]bool)
+
+// inferredFieldTypes is a global map of, for each table, the column type of each
+// of its fields as inferred from the first row of the table with -infer-types
+var inferredFieldTypes = make(map[string]map[string]string)
+
+// appendToExistingTags is set when the tags table already existed, in which case
+// workers need to look up the ids of tags inserted by previous loads
+var appendToExistingTags bool
+
+// partitionColumnIdx is the position among the tags of each -partition-columns tag
+var partitionColumnIdx []int
+
 type dbCreator struct {
 	br      *bufio.Reader
 	tags    string
 	cols    []string
 	connStr string
 	connDB  string
+	// headerFile, if set, is read for the header instead of br
+	headerFile string
+	// hostConnStrs replace connStr with one for each of -postgres-hosts
+	hostConnStrs []string
+
+	// deferredIndexes are created after the data is loaded (-index-after-load)
+	deferredIndexes []string
+	// pendingIndexes are the indexes of the table being created, which are
+	// created together once the table's index definitions are all known
+	pendingIndexes []string
+	indexesCreated int
+	indexBuildTime time.Duration
+	// initialRows is the row count of each reused hypertable before the load
+	initialRows map[string]uint64
+	// keepDB is set when -reset=truncate kept the existing database, whose
+	// tables are truncated rather than recreated
+	keepDB bool
 }
 
 func (d *dbCreator) Init() {
-	d.readDataHeader(d.br)
+	d.readHeader()
+	if parquetIn != nil {
+		// The Parquet types of the fields give their column types, unless set
+		// with -field-types. Narrow tables have a single value column.
+		if layout != layoutNarrow {
+			inferredFieldTypes = parquetIn.fieldTypes()
+		}
+	} else if _, err := d.br.Peek(1); err == io.EOF {
+		// As with an empty input, the program generating the data most
+		// likely failed after writing the header
+		fatal("no input received: the input has a header but no data rows")
+		return
+	}
 	d.initConnectString()
+	if inferTypes {
+		d.inferFieldTypes()
+	}
+	if checkPartitions > 0 && useHypertable {
+		d.checkPartitionSkew()
+	}
 }
 func (d *dbCreator) initConnectString() {
+	d.connStr = d.adminConnectString(d.connStr)
+	d.hostConnStrs = nil
+	for i := range postgresHosts {
+		d.hostConnStrs = append(d.hostConnStrs, d.adminConnectString(hostConnectString(i)))
+	}
+}
+
+// adminConnectString returns connStr modified to connect to the database in
+// which the benchmark database is dropped and created
+func (d *dbCreator) adminConnectString(connStr string) string {
 	// Needed to connect to user's database in order to drop/create db-name database
 	re := regexp.MustCompile(`(dbname)=\S*\b`)
-	d.connStr = strings.TrimSpace(re.ReplaceAllString(d.connStr, ""))
+	connStr = strings.TrimSpace(re.ReplaceAllString(connStr, ""))
 
 	if d.connDB != "" {
-		d.connStr = fmt.Sprintf("dbname=%s %s", d.connDB, d.connStr)
+		connStr = fmt.Sprintf("dbname=%s %s", d.connDB, connStr)
+	}
+	return connStr
+}
+
+// adminConnStrs returns the connection strings used to drop and create the
+// benchmark database on each host
+func (d *dbCreator) adminConnStrs() []string {
+	if len(d.hostConnStrs) > 0 {
+		return d.hostConnStrs
+	}
+	return []string{d.connStr}
+}
+
+// checkPartitionSkew samples the start of the data, without consuming it, and
+// warns for each hypertable whose rows have fewer distinct partitioning keys
+// than the number of space partitions, since the extra partitions stay empty.
+// Only as much data as fits in the read buffer is sampled.
+func (d *dbCreator) checkPartitionSkew() {
+	sample, _ := d.br.Peek(d.br.Size())
+	counts, rows := countPartitionKeys(string(sample), checkPartitions)
+	tables := make([]string, 0, len(counts))
+	for table := range counts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if partitions := partitionsFor(table); counts[table] < partitions {
+			warnf("hypertable %s has only %d distinct tag sets in its first %d rows but %d partitions; space partitions will be skewed",
+				table, counts[table], rows[table], partitions)
+		}
+	}
+}
+
+// countPartitionKeys returns, for each hypertable in data, the number of
+// distinct partitioning keys (the first tag value, as used for tags_id) in
+// its first maxRows rows, along with the number of rows that were read.
+// An incomplete trailing row is ignored.
+func countPartitionKeys(data string, maxRows int) (map[string]int, map[string]int) {
+	keys := make(map[string]map[string]bool)
+	rows := make(map[string]int)
+	lines := strings.Split(data, "\n")
+	// the last line is either empty or incomplete
+	for i := 0; i+2 < len(lines); i += 2 {
+		tags := strings.SplitN(lines[i], delimiter, 3)
+		table := strings.SplitN(lines[i+1], delimiter, 2)[0]
+		if tags[0] != tagsKey || len(tags) < 2 {
+			break
+		}
+		if rows[table] >= maxRows {
+			continue
+		}
+		key := tags[1]
+		if idx := strings.Index(key, "="); idx >= 0 {
+			key = key[idx+1:]
+		}
+		if keys[table] == nil {
+			keys[table] = make(map[string]bool)
+		}
+		keys[table][key] = true
+		rows[table]++
+	}
+
+	counts := make(map[string]int, len(keys))
+	for table, k := range keys {
+		counts[table] = len(k)
+	}
+	return counts, rows
+}
+
+// inferFieldTypes samples the start of the data, without consuming it, and
+// infers the column types of the fields of each table from its first row.
+// Only as much data as fits in the read buffer is sampled.
+func (d *dbCreator) inferFieldTypes() {
+	sample, _ := d.br.Peek(d.br.Size())
+	inferredFieldTypes = inferTypesFromRows(string(sample), d.cols)
+	for _, tableDef := range d.cols {
+		tableName := strings.SplitN(tableDef, delimiter, 2)[0]
+		if _, ok := inferredFieldTypes[tableName]; !ok {
+			warnf("no row of table %s at the start of the input to infer its field types from; using %s", tableName, defaultFieldType)
+		}
+	}
+}
+
+// inferTypesFromRows returns, for each table defined in cols with a row in data,
+// the column type of each of its fields inferred from the values of its first
+// row. Fields whose value is NULL are left out. An incomplete trailing row is
+// ignored.
+func inferTypesFromRows(data string, cols []string) map[string]map[string]string {
+	fields := make(map[string][]string, len(cols))
+	for _, tableDef := range cols {
+		columns := strings.Split(tableDef, delimiter)
+		fields[columns[0]] = columns[1:]
 	}
+
+	ret := make(map[string]map[string]string)
+	lines := strings.Split(data, "\n")
+	// the last line is either empty or incomplete
+	for i := 0; i+2 < len(lines); i += 2 {
+		if strings.SplitN(lines[i], delimiter, 2)[0] != tagsKey {
+			break
+		}
+		values := strings.Split(lines[i+1], delimiter)
+		tableName := values[0]
+		if _, ok := ret[tableName]; ok || fields[tableName] == nil {
+			continue
+		}
+		types := make(map[string]string)
+		// values after the table name start with the timestamp
+		for j := 2; j < len(values) && j-2 < len(fields[tableName]); j++ {
+			if t := inferType(values[j]); t != "" {
+				types[fields[tableName][j-2]] = t
+			}
+		}
+		ret[tableName] = types
+	}
+	return ret
+}
+
+// inferType returns the column type for a field with value v: BIGINT for an
+// integer, DOUBLE PRECISION for other numbers, BOOLEAN for true or false and
+// TEXT otherwise. It returns an empty string for a NULL value.
+func inferType(v string) string {
+	if v == "" || v == nullAs {
+		return ""
+	}
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "BIGINT"
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return defaultFieldType
+	}
+	if strings.EqualFold(v, "true") || strings.EqualFold(v, "false") {
+		return "BOOLEAN"
+	}
+	return "TEXT"
+}
+
+// readHeader reads and validates the header, from -header-file if set and
+// otherwise from the start of the input.
+func (d *dbCreator) readHeader() {
+	if parquetIn != nil {
+		d.tags, d.cols = parquetIn.header()
+	} else if len(d.headerFile) > 0 {
+		file, err := os.Open(d.headerFile)
+		if err != nil {
+			fatal("cannot open header file %s: %v", d.headerFile, err)
+			return
+		}
+		defer file.Close()
+		// The header file need not end with the blank line separating the
+		// header from the data
+		d.readDataHeader(bufio.NewReader(io.MultiReader(file, strings.NewReader("\n\n"))))
+	} else {
+		d.readDataHeader(d.br)
+	}
+	if err := validateDataHeader(d.tags, d.cols); err != nil {
+		fatal("input does not look like TimescaleDB data: %v", err)
+	}
+}
+
+// inputHeaderLines returns the number of lines of the header at the start of
+// the input, which is empty when it is read from -header-file or the Parquet
+// schema
+func (d *dbCreator) inputHeaderLines() uint64 {
+	if len(d.headerFile) > 0 || parquetIn != nil {
+		return 0
+	}
+	// The tags line, a line per table and the blank line ending the header
+	return uint64(len(d.cols)) + 2
 }
 
 func (d *dbCreator) readDataHeader(br *bufio.Reader) {
@@ -46,6 +294,11 @@ func (d *dbCreator) readDataHeader(br *bufio.Reader) {
 		var line string
 		if i == 0 {
 			d.tags, err = br.ReadString('\n')
+			if err == io.EOF && len(d.tags) == 0 {
+				// Most likely the program generating the data failed
+				fatal("no input received")
+				return
+			}
 			if err != nil {
 				fatal("input has wrong header format: %v", err)
 			}
@@ -65,29 +318,104 @@ func (d *dbCreator) readDataHeader(br *bufio.Reader) {
 	}
 }
 
+// validateDataHeader checks that the header read by readDataHeader has the
+// expected format, to catch data generated for another database (e.g., InfluxDB
+// line protocol) before any tables are created from it. The tags line must be
+// 'tags' followed by '<name> <type>' pairs, and each table line must be the
+// table name followed by its field names.
+func validateDataHeader(tags string, cols []string) error {
+	tagDefs := strings.Split(tags, delimiter)
+	if tagDefs[0] != tagsKey {
+		return fmt.Errorf("header should start with '%s', got '%s'", tagsKey, tagDefs[0])
+	}
+	if len(tagDefs) < 2 {
+		return fmt.Errorf("header has no tags")
+	}
+	for _, tagDef := range tagDefs[1:] {
+		if len(strings.Split(tagDef, " ")) != 2 {
+			return fmt.Errorf("tag '%s' should be in '<name> <type>' format", tagDef)
+		}
+	}
+
+	if len(cols) == 0 {
+		return fmt.Errorf("header has no tables")
+	}
+	for _, tableDef := range cols {
+		columns := strings.Split(tableDef, delimiter)
+		if len(columns) < 2 {
+			return fmt.Errorf("table '%s' has no fields", columns[0])
+		}
+		for _, name := range columns {
+			if len(name) == 0 || strings.ContainsAny(name, " =") {
+				return fmt.Errorf("invalid table or field name '%s' in '%s'", name, tableDef)
+			}
+		}
+	}
+	return nil
+}
+
 // MustConnect connects or exits on errors
 func MustConnect(dbType, connStr string) *sql.DB {
 	db, err := sql.Open(dbType, connStr)
 	if err != nil {
-		panic(err)
+		fatal("could not connect: %v", redactErr(err))
+		return nil
 	}
 	return db
 }
 
+var (
+	sharedPool     *sql.DB
+	sharedPoolOnce sync.Once
+)
+
+// getSharedPool returns the connection pool shared by the workers that do not
+// need a dedicated connection and by post-load queries, creating it on first use.
+// Its size is set by -max-open-conns and -max-idle-conns, and its statements are
+// limited by -statement-timeout like those of the workers.
+func getSharedPool() *sql.DB {
+	sharedPoolOnce.Do(func() {
+		sharedPool = MustConnect(driver, withStatementTimeout(getConnectString()))
+		sharedPool.SetMaxOpenConns(maxOpenConns)
+		sharedPool.SetMaxIdleConns(maxIdleConns)
+	})
+	return sharedPool
+}
+
+// closeSharedPool closes the shared connection pool if it was created
+func closeSharedPool() {
+	if sharedPool != nil {
+		sharedPool.Close()
+	}
+}
+
 // MustExec executes query or exits on error
 func MustExec(db *sql.DB, query string, args ...interface{}) sql.Result {
 	r, err := db.Exec(query, args...)
 	if err != nil {
-		panic(err)
+		fatal("could not execute %s: %v", query, redactErr(err))
+		return nil
 	}
 	return r
 }
 
+// MustExecDDL executes a schema statement or exits on error. If -print-ddl is
+// set, the statement is printed to stdout instead of being executed.
+func MustExecDDL(db *sql.DB, query string) {
+	if printDDL {
+		fmt.Printf("%s;\n", strings.TrimSuffix(query, ";"))
+		return
+	}
+	debugf("executing %s", query)
+	MustExec(db, query)
+}
+
 // MustQuery executes query or exits on error
 func MustQuery(db *sql.DB, query string, args ...interface{}) *sql.Rows {
 	r, err := db.Query(query, args...)
 	if err != nil {
-		panic(err)
+		fatal("could not query %s: %v", query, redactErr(err))
+		return nil
 	}
 	return r
 }
@@ -96,13 +424,27 @@ func MustQuery(db *sql.DB, query string, args ...interface{}) *sql.Rows {
 func MustBegin(db *sql.DB) *sql.Tx {
 	tx, err := db.Begin()
 	if err != nil {
-		panic(err)
+		fatal("could not begin transaction: %v", redactErr(err))
+		return nil
 	}
 	return tx
 }
 
+// DBExists returns whether the benchmark database exists on any of the hosts
 func (d *dbCreator) DBExists(dbName string) bool {
-	db := MustConnect(driver, d.connStr)
+	if !target.HasDatabases() {
+		return true
+	}
+	for _, connStr := range d.adminConnStrs() {
+		if dbExists(connStr, dbName) {
+			return true
+		}
+	}
+	return false
+}
+
+func dbExists(connStr, dbName string) bool {
+	db := MustConnect(driver, connStr)
 	defer db.Close()
 	r := MustQuery(db, "SELECT 1 from pg_database WHERE datname = $1", dbName)
 	defer r.Close()
@@ -110,50 +452,160 @@ func (d *dbCreator) DBExists(dbName string) bool {
 }
 
 func (d *dbCreator) RemoveOldDB(dbName string) error {
-	db := MustConnect(driver, d.connStr)
-	defer db.Close()
-	MustExec(db, "DROP DATABASE IF EXISTS "+dbName)
+	if !target.HasDatabases() {
+		return nil
+	}
+	if resetMode == resetTruncate {
+		d.keepDB = true
+		return nil
+	}
+	d.dropDB(dbName)
 	return nil
 }
 
+// dropDB drops the database dbName on each host
+func (d *dbCreator) dropDB(dbName string) {
+	for _, connStr := range d.adminConnStrs() {
+		db := MustConnect(driver, connStr)
+		MustExec(db, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(dbName))
+		db.Close()
+	}
+}
+
 func (d *dbCreator) CreateDB(dbName string) error {
-	db := MustConnect(driver, d.connStr)
-	MustExec(db, "CREATE DATABASE "+dbName)
-	db.Close()
+	if !target.HasDatabases() || d.keepDB {
+		return nil
+	}
+	for _, connStr := range d.adminConnStrs() {
+		db := MustConnect(driver, connStr)
+		// Quote the name so it matches the case-sensitive lookup in DBExists and
+		// may contain characters such as '-', e.g., for concurrent benchmarks
+		MustExec(db, "CREATE DATABASE "+pq.QuoteIdentifier(dbName))
+		db.Close()
+	}
 	return nil
 }
 
+// PostCreateDB creates the schema on each of the hosts
 func (d *dbCreator) PostCreateDB(dbName string) error {
-	dbBench := MustConnect(driver, getConnectString())
-	defer dbBench.Close()
+	for _, connStr := range benchConnectStrings() {
+		if err := d.postCreateDB(connStr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postCreateDB creates the tags table and hypertables in the benchmark
+// database at connStr
+func (d *dbCreator) postCreateDB(connStr string) error {
+	var dbBench *sql.DB
+	if !printDDL {
+		dbBench = MustConnect(driver, connStr)
+		defer dbBench.Close()
+	}
 
-	tags := strings.Split(strings.TrimSpace(d.tags), ",")
+	if useHypertable && !printDDL {
+		// Before creating any table, so that with -on-missing-extension=fallback
+		// none are made hypertables
+		if _, err := dbBench.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE"); err != nil {
+			cause := fmt.Sprintf("cannot create the timescaledb extension: %v", redactErr(err))
+			if err := missingExtension(cause, "create it beforehand as a user allowed to"); err != nil {
+				return err
+			}
+		}
+	}
+	if len(pgSchema) > 0 {
+		// Install the extension before creating the schema, which comes first
+		// in the search_path, so that it is installed in public instead
+		if useHypertable {
+			MustExecDDL(dbBench, "CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE")
+		}
+		MustExecDDL(dbBench, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(pgSchema))
+	}
+
+	tags := strings.Split(strings.TrimSpace(d.tags), delimiter)
 	if tags[0] != tagsKey {
 		return fmt.Errorf("input header in wrong format. got '%s', expected 'tags'", tags[0])
 	}
 	tagNames, tagTypes := extractTagNamesAndTypes(tags[1:])
+	// When the database is not being (re)created, append to existing tables
+	// rather than dropping them
+	reuseTables := !loader.DoCreateDB && !printDDL
+	toCreate := &schema{tagNames: tagNames, tagTypes: tagTypes}
 	if createMetricsTable {
-		createTagsTable(dbBench, tagNames, tagTypes)
+		switch {
+		case d.keepDB && truncatableTable(dbBench, tagsKey, tagsTableColumns(tagNames)):
+			// The emptied tags table is reused as is
+		case reuseTables && tableExists(dbBench, tagsKey):
+			mustMatchColumns(dbBench, tagsKey, tagsTableColumns(tagNames))
+			appendToExistingTags = true
+		default:
+			toCreate.createTags = true
+		}
 	}
 	// tableCols is a global map. Globally cache the available tags
 	tableCols[tagsKey] = tagNames
+	var err error
+	if partitionColumnIdx, err = tagIndexes(tagNames, partitionColumns); err != nil {
+		return fmt.Errorf("invalid partition columns: %v", err)
+	}
 	// tagTypes holds the type of each tag value (as strings from Go types (string, float32...))
 	tagColumnTypes = tagTypes
 
 	// Each table is defined in the dbCreator 'cols' list. The definition consists of a
 	// comma separated list of the table name followed by its columns. Iterate over each
 	// definition to update our global cache and create the requisite tables and indexes
+	var tableNames []string
 	for _, tableDef := range d.cols {
-		columns := strings.Split(strings.TrimSpace(tableDef), ",")
+		columns := strings.Split(strings.TrimSpace(tableDef), delimiter)
 		tableName := columns[0]
+		tableNames = append(tableNames, tableName)
+		if !hypertableSelected(tableName) {
+			// Its rows are dropped by the decoder
+			continue
+		}
 		// tableCols is a global map. Globally cache the available columns for the given table
 		tableCols[tableName] = columns[1:]
+		tableRawFields[tableName] = rawFields(tableName, columns[1:])
 
-		fieldDefs, indexDefs := d.getFieldAndIndexDefinitions(columns)
+		var fieldDefs, indexDefs []string
+		if layout == layoutNarrow {
+			fieldDefs, indexDefs = d.getNarrowFieldAndIndexDefinitions(tableName)
+		} else {
+			fieldDefs, indexDefs = d.getFieldAndIndexDefinitions(columns)
+		}
 		if createMetricsTable {
-			d.createTableAndIndexes(dbBench, tableName, fieldDefs, indexDefs)
+			if d.keepDB && truncatableTable(dbBench, tableName, hypertableColumns(tableName, fieldDefs)) {
+				continue
+			}
+			if reuseTables && tableExists(dbBench, tableName) {
+				mustMatchColumns(dbBench, tableName, hypertableColumns(tableName, fieldDefs))
+				if verify {
+					if d.initialRows == nil {
+						d.initialRows = make(map[string]uint64)
+					}
+					d.initialRows[tableName] = countRows(dbBench, tableName)
+				}
+				continue
+			}
+			toCreate.tables = append(toCreate.tables, schemaTable{name: tableName, fieldDefs: fieldDefs, indexDefs: indexDefs})
 		}
 	}
+	if unknown := unknownHypertables(tableNames); len(unknown) > 0 {
+		warnf("hypertables %s selected with -only-hypertables or -skip-hypertables are not in the header", strings.Join(unknown, ", "))
+	}
+	if createMetricsTable {
+		if distributed && len(toCreate.tables) > 0 {
+			if err := checkDataNodes(dbBench); err != nil {
+				return err
+			}
+		}
+		target.CreateSchema(dbBench, d, toCreate)
+	}
+	for _, stmt := range postSchemaSQL {
+		MustExecDDL(dbBench, stmt)
+	}
 	return nil
 }
 
@@ -163,6 +615,7 @@ func (d *dbCreator) getFieldAndIndexDefinitions(columns []string) ([]string, []s
 	var fieldDefs []string
 	var indexDefs []string
 	var allCols []string
+	seenIndexDefs := make(map[string]bool)
 
 	partitioningField := tableCols[tagsKey][0]
 	tableName := columns[0]
@@ -171,14 +624,17 @@ func (d *dbCreator) getFieldAndIndexDefinitions(columns []string) ([]string, []s
 	if inTableTag {
 		allCols = append(allCols, partitioningField)
 	}
+	if len(partitionColumns) > 0 {
+		allCols = append(allCols, partitionKeyColumn)
+	}
 
 	allCols = append(allCols, columns[1:]...)
-	extraCols := 0 // set to 1 when hostname is kept in-table
+	extraCols := 0 // counts the hostname kept in-table and the partition key
 	for idx, field := range allCols {
 		if len(field) == 0 {
 			continue
 		}
-		fieldType := "DOUBLE PRECISION"
+		fieldType := tableFieldType(tableName, field)
 		idxType := fieldIndex
 		// This condition handles the case where we keep the primary tag key in the table
 		// and partition on it. Since under the current implementation this tag is always
@@ -186,49 +642,887 @@ func (d *dbCreator) getFieldAndIndexDefinitions(columns []string) ([]string, []s
 		if inTableTag && idx == 0 {
 			fieldType = "TEXT"
 			idxType = ""
-			extraCols = 1
+			extraCols++
+		}
+		if field == partitionKeyColumn && idx == extraCols {
+			fieldType = "TEXT"
+			idxType = ""
+			extraCols++
 		}
 
 		fieldDefs = append(fieldDefs, fmt.Sprintf("%s %s", field, fieldType))
 		// If the user specifies indexes on additional fields, add them to
-		// our index definitions until we've reached the desired number of indexes
-		if fieldIndexCount == -1 || idx < (fieldIndexCount+extraCols) {
-			indexDefs = append(indexDefs, d.getCreateIndexOnFieldCmds(tableName, field, idxType)...)
+		// our index definitions until we've reached the desired number of
+		// indexes, or for the fields named in -index-fields
+		indexed := fieldIndexCount == -1 || idx < (fieldIndexCount+extraCols)
+		if indexFields != nil {
+			indexed = idxType != "" && indexFields[field]
+		}
+		if indexed {
+			for _, indexDef := range d.getCreateIndexOnFieldCmds(tableName, field, idxType) {
+				// Indexes that do not depend on the field (e.g., BRIN-TIME) are only created once
+				if !seenIndexDefs[indexDef] {
+					seenIndexDefs[indexDef] = true
+					indexDefs = append(indexDefs, indexDef)
+				}
+			}
 		}
 	}
 	return fieldDefs, indexDefs
 }
 
+// getNarrowFieldAndIndexDefinitions returns the field and index definitions of
+// tableName with -layout=narrow: the tag columns kept in the table, followed by
+// the name and value of a single field. Field indexes are on the name column.
+func (d *dbCreator) getNarrowFieldAndIndexDefinitions(tableName string) ([]string, []string) {
+	fieldDefs, indexDefs := d.getFieldAndIndexDefinitions([]string{tableName})
+	fieldDefs = append(fieldDefs, narrowNameColumn+" TEXT", narrowValueColumn+" "+defaultFieldType)
+	if fieldIndexCount != 0 || indexFields != nil {
+		indexDefs = append(indexDefs, d.getCreateIndexOnFieldCmds(tableName, narrowNameColumn, fieldIndex)...)
+	}
+	return fieldDefs, indexDefs
+}
+
+// parsePartitions parses the -partitions flag: a comma separated list of
+// <hypertable>=<count> pairs and at most one bare count, which is the default
+// for hypertables not listed (1 if not given).
+func parsePartitions(s string) (int, map[string]int, error) {
+	def := 1
+	seenDefault := false
+	ret := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		table, count := "", entry
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			table, count = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return 0, nil, fmt.Errorf("invalid partition count '%s': expected a positive integer or <hypertable>=<count>", entry)
+		}
+		if table == "" {
+			if seenDefault {
+				return 0, nil, fmt.Errorf("more than one default partition count in '%s'", s)
+			}
+			seenDefault = true
+			def = n
+		} else {
+			ret[table] = n
+		}
+	}
+	return def, ret, nil
+}
+
+// partitionsFor returns the number of space partitions for hypertable
+func partitionsFor(hypertable string) int {
+	if n, ok := tablePartitions[hypertable]; ok {
+		return n
+	}
+	return numberPartitions
+}
+
+// defaultChunkTime is the chunk time of hypertables not listed in -chunk-time
+// when it has no bare duration
+const defaultChunkTime = 12 * time.Hour
+
+// parseChunkTimes parses the -chunk-time flag: a comma separated list of
+// <hypertable>=<duration> pairs and at most one bare duration, which is the
+// default for hypertables not listed (defaultChunkTime if not given).
+func parseChunkTimes(s string) (time.Duration, map[string]time.Duration, error) {
+	def := defaultChunkTime
+	seenDefault := false
+	ret := make(map[string]time.Duration)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		table, duration := "", entry
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			table, duration = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return 0, nil, fmt.Errorf("invalid chunk time '%s': expected a positive duration (e.g., 12h) or <hypertable>=<duration>", entry)
+		}
+		if table == "" {
+			if seenDefault {
+				return 0, nil, fmt.Errorf("more than one default chunk time in '%s'", s)
+			}
+			seenDefault = true
+			def = d
+		} else {
+			ret[table] = d
+		}
+	}
+	return def, ret, nil
+}
+
+// chunkTimeFor returns the chunk time interval for hypertable
+func chunkTimeFor(hypertable string) time.Duration {
+	if d, ok := tableChunkTimes[hypertable]; ok {
+		return d
+	}
+	return chunkTime
+}
+
+// defaultTimeColumn is the name of the time column of hypertables not listed
+// in -time-column when it has no bare name
+const defaultTimeColumn = "time"
+
+// timeColumnRe matches the names accepted for time columns, which are used
+// unquoted in the DDL
+var timeColumnRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// parseTimeColumns parses the -time-column flag: a comma separated list of
+// <hypertable>=<column> pairs and at most one bare column name, which is the
+// default for hypertables not listed (defaultTimeColumn if not given).
+func parseTimeColumns(s string) (string, map[string]string, error) {
+	def := defaultTimeColumn
+	seenDefault := false
+	ret := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		table, column := "", entry
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			table, column = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		if !timeColumnRe.MatchString(column) {
+			return "", nil, fmt.Errorf("invalid time column '%s': expected a lowercase column name (e.g., ts) or <hypertable>=<column>", entry)
+		}
+		if table == "" {
+			if seenDefault {
+				return "", nil, fmt.Errorf("more than one default time column in '%s'", s)
+			}
+			seenDefault = true
+			def = column
+		} else {
+			ret[table] = column
+		}
+	}
+	return def, ret, nil
+}
+
+// timeColumnFor returns the name of the time column of hypertable
+func timeColumnFor(hypertable string) string {
+	if c, ok := tableTimeColumns[hypertable]; ok {
+		return c
+	}
+	return timeColumn
+}
+
+// parseTimeRange parses the -time-start and -time-end flags, which are both
+// required with -partitioning=native
+func parseTimeRange(startStr, endStr string) (time.Time, time.Time, error) {
+	if len(startStr) == 0 || len(endStr) == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("-time-start and -time-end are required")
+	}
+	start, err := time.Parse(time.RFC3339, startStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start '%s': %v", startStr, err)
+	}
+	end, err := time.Parse(time.RFC3339, endStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end '%s': %v", endStr, err)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end %s is not after start %s", endStr, startStr)
+	}
+	return start.UTC(), end.UTC(), nil
+}
+
+// nativePartitionBounds returns the bounds of the partitions of interval
+// covering start to end, aligned to the Unix epoch like hypertable chunks:
+// partition i covers bounds[i] up to (excluding) bounds[i+1]
+func nativePartitionBounds(start, end time.Time, interval time.Duration) ([]time.Time, error) {
+	from := start.UnixNano() - start.UnixNano()%int64(interval)
+	n := (end.UnixNano() - from + int64(interval) - 1) / int64(interval)
+	if n > maxNativePartitions {
+		return nil, fmt.Errorf("%d partitions of %v are needed to cover %s to %s, more than the maximum of %d", n, interval, start.Format(time.RFC3339), end.Format(time.RFC3339), maxNativePartitions)
+	}
+	bounds := make([]time.Time, n+1)
+	for i := range bounds {
+		bounds[i] = time.Unix(0, from+int64(i)*int64(interval)).UTC()
+	}
+	return bounds, nil
+}
+
+// nativePartitionQueries returns the statements creating the partitions of
+// tableName for -partitioning=native, along with a default partition for rows
+// outside of -time-start to -time-end
+func nativePartitionQueries(tableName string, bounds []time.Time) []string {
+	queries := make([]string, 0, len(bounds))
+	for i := 0; i+1 < len(bounds); i++ {
+		queries = append(queries, fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			pq.QuoteIdentifier(fmt.Sprintf("%s_p%d", tableName, i)), pq.QuoteIdentifier(tableName), bounds[i].Format(time.RFC3339Nano), bounds[i+1].Format(time.RFC3339Nano)))
+	}
+	return append(queries, fmt.Sprintf("CREATE TABLE %s PARTITION OF %s DEFAULT", pq.QuoteIdentifier(tableName+"_default"), pq.QuoteIdentifier(tableName)))
+}
+
+// parseFieldTypes parses a comma separated list of <field>=<type> pairs into a map
+// from field to PostgreSQL column type. A field ending in '*' matches all fields
+// with that prefix.
+func parseFieldTypes(s string) (map[string]string, error) {
+	ret := make(map[string]string)
+	if len(strings.TrimSpace(s)) == 0 {
+		return ret, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("invalid field type '%s': expected <field>=<type>", pair)
+		}
+		ret[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return ret, nil
+}
+
+// fieldTypeFor returns the column type to use for field. An exact match in
+// fieldTypes takes precedence, followed by the longest matching prefix.
+func fieldTypeFor(field string) string {
+	if t, ok := matchFieldType(field); ok {
+		return t
+	}
+	return defaultFieldType
+}
+
+// matchFieldType returns the type fieldTypes sets for field, if any
+func matchFieldType(field string) (string, bool) {
+	if t, ok := fieldTypes[field]; ok {
+		return t, true
+	}
+	fieldType := ""
+	longest := -1
+	for name, t := range fieldTypes {
+		if !strings.HasSuffix(name, "*") {
+			continue
+		}
+		prefix := strings.TrimSuffix(name, "*")
+		if strings.HasPrefix(field, prefix) && len(prefix) > longest {
+			fieldType = t
+			longest = len(prefix)
+		}
+	}
+	return fieldType, longest >= 0
+}
+
+// tableFieldType returns the column type of field in tableName: the type set
+// by fieldTypes, if any, or else the type inferred with -infer-types.
+func tableFieldType(tableName, field string) string {
+	if t, ok := matchFieldType(field); ok {
+		return t
+	}
+	if t, ok := inferredFieldTypes[tableName][field]; ok {
+		return t
+	}
+	return defaultFieldType
+}
+
+// rawFields returns, for each of the fields of tableName, whether it has a
+// non-default column type
+func rawFields(tableName string, fields []string) []bool {
+	ret := make([]bool, len(fields))
+	for i, field := range fields {
+		ret[i] = tableFieldType(tableName, field) != defaultFieldType
+	}
+	return ret
+}
+
+// tableExists returns whether tableName exists in the benchmark database
+func tableExists(db *sql.DB, tableName string) bool {
+	r := MustQuery(db, "SELECT 1 FROM pg_tables WHERE tablename = $1 AND schemaname = ANY(current_schemas(false))", tableName)
+	defer r.Close()
+	return r.Next()
+}
+
+// mustMatchColumns exits if the columns of the existing table tableName are not
+// the ones that would be created from the input header
+func mustMatchColumns(db *sql.DB, tableName string, want []string) {
+	if err := checkColumnsMatch(tableName, tableColumns(db, tableName), want); err != nil {
+		fatal("cannot append to existing table: %v", err)
+	}
+}
+
+// tableColumns returns the column names of the existing table tableName
+func tableColumns(db *sql.DB, tableName string) []string {
+	r := MustQuery(db, "SELECT column_name FROM information_schema.columns WHERE table_name = $1 AND table_schema = ANY(current_schemas(false))", tableName)
+	defer r.Close()
+	var got []string
+	for r.Next() {
+		var col string
+		if err := r.Scan(&col); err != nil {
+			fatal("could not read the columns of %s: %v", tableName, err)
+			return nil
+		}
+		got = append(got, col)
+	}
+	return got
+}
+
+// truncatableTable returns whether tableName exists with the columns it would be
+// created with, so that -reset=truncate can empty it instead of recreating it
+func truncatableTable(db *sql.DB, tableName string, want []string) bool {
+	if !tableExists(db, tableName) {
+		return false
+	}
+	if err := checkColumnsMatch(tableName, tableColumns(db, tableName), want); err != nil {
+		infof("recreating table: %v", err)
+		return false
+	}
+	MustExecDDL(db, "TRUNCATE "+pq.QuoteIdentifier(tableName)+" RESTART IDENTITY")
+	return true
+}
+
+// checkColumnsMatch returns an error if got and want do not contain the same column names
+func checkColumnsMatch(tableName string, got, want []string) error {
+	gotSorted := append([]string{}, got...)
+	wantSorted := append([]string{}, want...)
+	sort.Strings(gotSorted)
+	sort.Strings(wantSorted)
+	if strings.Join(gotSorted, ",") != strings.Join(wantSorted, ",") {
+		return fmt.Errorf("table %s has columns (%s), but the input header requires (%s)", tableName, strings.Join(gotSorted, ","), strings.Join(wantSorted, ","))
+	}
+	return nil
+}
+
+// tagsTableColumns returns the names of the columns of the tags table
+func tagsTableColumns(tagNames []string) []string {
+	if useJSON {
+		return []string{"id", "tagset"}
+	}
+	return append([]string{"id"}, tagNames...)
+}
+
+// hypertableColumns returns the names of the columns of hypertable with the given field definitions
+func hypertableColumns(hypertable string, fieldDefs []string) []string {
+	cols := []string{timeColumnFor(hypertable), "tags_id", "additional_tags"}
+	for _, fieldDef := range fieldDefs {
+		cols = append(cols, strings.SplitN(fieldDef, " ", 2)[0])
+	}
+	return cols
+}
+
 // createTableAndIndexes takes a list of field and index definitions for a given tableName and constructs
 // the necessary table, index, and potential hypertable based on the user's settings
 func (d *dbCreator) createTableAndIndexes(dbBench *sql.DB, tableName string, fieldDefs []string, indexDefs []string) {
-	MustExec(dbBench, fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName))
-	MustExec(dbBench, fmt.Sprintf("CREATE TABLE %s (time timestamptz, tags_id integer, %s, additional_tags JSONB DEFAULT NULL)", tableName, strings.Join(fieldDefs, ",")))
-	if partitionIndex {
-		MustExec(dbBench, fmt.Sprintf("CREATE INDEX ON %s(tags_id, \"time\" DESC)", tableName))
+	quotedTable := pq.QuoteIdentifier(tableName)
+	MustExecDDL(dbBench, fmt.Sprintf("DROP TABLE IF EXISTS %s", quotedTable))
+	keyDef := ""
+	if len(tableKey) > 0 {
+		def, err := tableKeyDef(tableName, hypertableColumns(tableName, fieldDefs))
+		if err != nil {
+			fatal("invalid key: %v", err)
+			return
+		}
+		keyDef = ", " + def
+	}
+	timeCol := pq.QuoteIdentifier(timeColumnFor(tableName))
+	createTable := fmt.Sprintf("%s %s (%s %s, tags_id integer, %s, additional_tags JSONB DEFAULT NULL%s)", createTableCmd(), quotedTable, timeCol, timeColumnType, strings.Join(quoteFieldDefs(fieldDefs), ","), keyDef)
+	if partitioning == partitioningNative {
+		MustExecDDL(dbBench, fmt.Sprintf("%s PARTITION BY RANGE (%s)", createTable, timeCol))
+		// The bounds were checked when parsing the flags
+		bounds, _ := nativePartitionBounds(timeStart, timeEnd, chunkTimeFor(tableName))
+		for _, query := range nativePartitionQueries(tableName, bounds) {
+			MustExecDDL(dbBench, query)
+		}
+	} else {
+		MustExecDDL(dbBench, createTable)
+	}
+	if onConflict && len(tableKey) == 0 {
+		// ON CONFLICT needs the unique index while loading, so it is never deferred.
+		// It also serves as the partition index.
+		MustExecDDL(dbBench, uniqueIndexQuery(tableName))
+	} else if partitionIndex {
+		d.createIndex(fmt.Sprintf("CREATE INDEX ON %s(tags_id, %s DESC)", quotedTable, timeCol))
 	}
 
 	// Only allow one or the other, it's probably never right to have both.
 	// Experimentation suggests (so far) that for 100k devices it is better to
 	// use --time-partition-index for reduced index lock contention.
 	if timePartitionIndex {
-		MustExec(dbBench, fmt.Sprintf("CREATE INDEX ON %s(\"time\" DESC, tags_id)", tableName))
+		d.createIndex(fmt.Sprintf("CREATE INDEX ON %s(%s DESC, tags_id)", quotedTable, timeCol))
 	} else if timeIndex {
-		MustExec(dbBench, fmt.Sprintf("CREATE INDEX ON %s(\"time\" DESC)", tableName))
+		d.createIndex(fmt.Sprintf("CREATE INDEX ON %s(%s DESC)", quotedTable, timeCol))
 	}
 
 	for _, indexDef := range indexDefs {
-		MustExec(dbBench, indexDef)
+		d.createIndex(indexDef)
 	}
+	d.createPendingIndexes(dbBench)
 
 	if useHypertable {
-		MustExec(dbBench, "CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE")
-		MustExec(dbBench,
-			fmt.Sprintf("SELECT create_hypertable('%s'::regclass, 'time'::name, partitioning_column => '%s'::name, number_partitions => %v::smallint, chunk_time_interval => %d, create_default_indexes=>FALSE)",
-				tableName, "tags_id", numberPartitions, chunkTime.Nanoseconds()/1000))
+		MustExecDDL(dbBench, "CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE")
+		MustExecDDL(dbBench, createHypertableQuery(tableName))
+		if len(chunkTargetSize) > 0 {
+			setupAdaptiveChunking(dbBench, tableName)
+		}
+
+		if continuousAggBucket > 0 {
+			setupContinuousAggregate(dbBench, tableName, fieldDefs)
+		}
+		if compressChunkInterval > 0 {
+			setupCompression(dbBench, tableName)
+		}
+		if retention > 0 {
+			setupRetention(dbBench, tableName)
+		}
 	}
 }
 
+// parseTableKey parses the -primary-key and -unique-key flags, of which at most
+// one may be set, into the key columns and the constraint they form
+func parseTableKey(primaryKey, uniqueKey string) ([]string, string, error) {
+	s, constraint := primaryKey, "PRIMARY KEY"
+	if len(strings.TrimSpace(uniqueKey)) > 0 {
+		if len(strings.TrimSpace(primaryKey)) > 0 {
+			return nil, "", fmt.Errorf("only one of -primary-key and -unique-key can be set")
+		}
+		s, constraint = uniqueKey, "UNIQUE"
+	}
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil, "", nil
+	}
+	var key []string
+	seen := make(map[string]bool)
+	for _, col := range strings.Split(s, ",") {
+		col = strings.TrimSpace(col)
+		if len(col) == 0 || seen[col] {
+			return nil, "", fmt.Errorf("empty or repeated column in '%s'", s)
+		}
+		seen[col] = true
+		key = append(key, col)
+	}
+	return key, constraint, nil
+}
+
+// checkPartitionedKey checks that key includes the columns the tables are
+// partitioned on, which TimescaleDB and PostgreSQL require of the unique
+// indexes of hypertables and partitioned tables
+func checkPartitionedKey(key []string) error {
+	if len(key) == 0 {
+		return nil
+	}
+	var required []string
+	if useHypertable {
+		required = []string{timeColumn, partitioningColumn()}
+	} else if partitioning == partitioningNative {
+		required = []string{timeColumn}
+	}
+	for _, col := range required {
+		if !containsString(key, col) {
+			return fmt.Errorf("key (%s) must include column %s, which the tables are partitioned on (all of: %s)", strings.Join(key, ","), col, strings.Join(required, ","))
+		}
+	}
+	return nil
+}
+
+// tableKeyDef returns the definition of the key constraint of a table with the
+// given columns, or an error if the key is not among them
+func tableKeyDef(tableName string, columns []string) (string, error) {
+	for _, col := range tableKey {
+		if !containsString(columns, col) {
+			return "", fmt.Errorf("key column %s is not a column of table %s (%s)", col, tableName, strings.Join(columns, ","))
+		}
+	}
+	return fmt.Sprintf("%s (%s)", tableKeyConstraint, strings.Join(quoteIdentifiers(tableKey), ",")), nil
+}
+
+// quoteIdentifiers returns names quoted as SQL identifiers, so that columns
+// named after keywords or in mixed case are kept as they are
+func quoteIdentifiers(names []string) []string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = pq.QuoteIdentifier(name)
+	}
+	return ret
+}
+
+// quoteFieldDefs returns fieldDefs, each a column name followed by its type,
+// with the column names quoted as SQL identifiers
+func quoteFieldDefs(fieldDefs []string) []string {
+	ret := make([]string, len(fieldDefs))
+	for i, fieldDef := range fieldDefs {
+		parts := strings.SplitN(fieldDef, " ", 2)
+		parts[0] = pq.QuoteIdentifier(parts[0])
+		ret[i] = strings.Join(parts, " ")
+	}
+	return ret
+}
+
+// quoteRelation returns the table or view name as an SQL string literal
+// holding its quoted identifier, for the regclass arguments of the
+// TimescaleDB functions, e.g., '"Cpu"'
+func quoteRelation(name string) string {
+	return quoteLiteral(pq.QuoteIdentifier(name))
+}
+
+// quoteLiteral returns s as an SQL string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkTimeInterval returns the chunk time interval of hypertable in the units
+// of its time column: nanoseconds for bigint and microseconds otherwise
+func chunkTimeInterval(hypertable string) int64 {
+	if timeColumnType == timeColumnBigint {
+		return chunkTimeFor(hypertable).Nanoseconds()
+	}
+	return chunkTimeFor(hypertable).Nanoseconds() / 1000
+}
+
+// uniqueIndexQuery returns the query creating the unique index of tableName
+// that -on-conflict skips duplicate rows on, when no key is set
+func uniqueIndexQuery(tableName string) string {
+	return fmt.Sprintf("CREATE UNIQUE INDEX ON %s(tags_id, %s DESC%s)", pq.QuoteIdentifier(tableName), pq.QuoteIdentifier(timeColumnFor(tableName)), uniquePartitionKey())
+}
+
+// uniquePartitionKey returns the partition key column to add to the unique
+// index of -on-conflict and its ON CONFLICT target, if any, as TimescaleDB
+// rejects a unique index that does not include all partitioning columns
+func uniquePartitionKey() string {
+	if len(partitionColumns) > 0 {
+		return ", " + pq.QuoteIdentifier(partitionKeyColumn)
+	}
+	return ""
+}
+
+// partitioningColumn returns the column hypertables are space partitioned on
+func partitioningColumn() string {
+	if len(partitionColumns) > 0 {
+		return partitionKeyColumn
+	}
+	return "tags_id"
+}
+
+// tagIndexes returns the position of each of names in tagNames
+func tagIndexes(tagNames, names []string) ([]int, error) {
+	idx := make([]int, 0, len(names))
+	for _, name := range names {
+		found := false
+		for i, tagName := range tagNames {
+			if tagName == name {
+				idx = append(idx, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown tag '%s'", name)
+		}
+	}
+	return idx, nil
+}
+
+// createIndex queues indexDef to be created along with the other indexes of
+// the table, or after the data is loaded if -index-after-load is set.
+func (d *dbCreator) createIndex(indexDef string) {
+	if indexAfterLoad {
+		d.deferredIndexes = append(d.deferredIndexes, deferredIndexDef(indexDef))
+		return
+	}
+	d.pendingIndexes = append(d.pendingIndexes, indexDef)
+}
+
+// createPendingIndexes creates the indexes queued by createIndex, keeping
+// track of how many were created and how long it took.
+func (d *dbCreator) createPendingIndexes(dbBench *sql.DB) {
+	start := time.Now()
+	execIndexDefs(dbBench, d.pendingIndexes)
+	d.indexesCreated += len(d.pendingIndexes)
+	d.indexBuildTime += time.Since(start)
+	d.pendingIndexes = nil
+}
+
+// execIndexDefs runs the CREATE INDEX statements in indexDefs using up to
+// -index-workers connections at a time. When printing DDL they are run one
+// at a time to keep the output in order.
+func execIndexDefs(dbBench *sql.DB, indexDefs []string) {
+	workers := indexWorkers
+	if workers < 1 || printDDL {
+		workers = 1
+	}
+	defs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indexDef := range defs {
+				MustExecDDL(dbBench, indexDef)
+			}
+		}()
+	}
+	for _, indexDef := range indexDefs {
+		defs <- indexDef
+	}
+	close(defs)
+	wg.Wait()
+}
+
+// deferredIndexDef returns indexDef modified to be built concurrently with
+// other activity on the table if -create-index-concurrently is set. Hypertables
+// do not support CONCURRENTLY, so they build the index one chunk at a time instead.
+func deferredIndexDef(indexDef string) string {
+	if !createIndexConcurrently {
+		return indexDef
+	}
+	if useHypertable {
+		return indexDef + " WITH (timescaledb.transaction_per_chunk)"
+	}
+	return strings.Replace(indexDef, "CREATE INDEX ON", "CREATE INDEX CONCURRENTLY ON", 1)
+}
+
+// createDeferredIndexes builds the indexes deferred by -index-after-load,
+// returning how many were created.
+func (d *dbCreator) createDeferredIndexes() int {
+	if len(d.deferredIndexes) == 0 {
+		return 0
+	}
+	var dbBench *sql.DB
+	if !printDDL {
+		dbBench = MustConnect(driver, getConnectString())
+		defer dbBench.Close()
+	}
+	execIndexDefs(dbBench, d.deferredIndexes)
+	return len(d.deferredIndexes)
+}
+
+// hasFunction returns whether a function named name exists, e.g., to check
+// whether the installed TimescaleDB version has a policy API. Without a
+// connection, when printing DDL, functions are assumed to exist.
+func hasFunction(dbBench *sql.DB, name string) bool {
+	if printDDL {
+		return true
+	}
+	r := MustQuery(dbBench, "SELECT 1 FROM pg_proc WHERE proname = $1", name)
+	defer r.Close()
+	return r.Next()
+}
+
+// createHypertableQuery returns the query that turns tableName into a
+// hypertable, which is distributed over the data nodes with -distributed
+func createHypertableQuery(tableName string) string {
+	args := fmt.Sprintf("%s::regclass, %s::name, partitioning_column => %s::name, number_partitions => %v::smallint, chunk_time_interval => %d, create_default_indexes=>FALSE",
+		quoteRelation(tableName), quoteLiteral(timeColumnFor(tableName)), quoteLiteral(partitioningColumn()), partitionsFor(tableName), chunkTimeInterval(tableName))
+	if !distributed {
+		return fmt.Sprintf("SELECT create_hypertable(%s)", args)
+	}
+	args += fmt.Sprintf(", replication_factor => %d", replicationFactor)
+	if len(dataNodes) > 0 {
+		nodes := make([]string, len(dataNodes))
+		for i, node := range dataNodes {
+			nodes[i] = quoteLiteral(node)
+		}
+		args += fmt.Sprintf(", data_nodes => ARRAY[%s]::name[]", strings.Join(nodes, ","))
+	}
+	return fmt.Sprintf("SELECT create_distributed_hypertable(%s)", args)
+}
+
+// checkDataNodes checks that the TimescaleDB version supports distributed
+// hypertables and that the -data-nodes, or enough data nodes for
+// -replication-factor, are attached to the benchmark database
+func checkDataNodes(dbBench *sql.DB) error {
+	if printDDL {
+		return nil
+	}
+	MustExecDDL(dbBench, "CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE")
+	if !hasFunction(dbBench, "create_distributed_hypertable") {
+		return fmt.Errorf("TimescaleDB version does not support distributed hypertables (-distributed requires 2.0 or later)")
+	}
+	r := MustQuery(dbBench, "SELECT node_name FROM timescaledb_information.data_nodes")
+	defer r.Close()
+	var attached []string
+	for r.Next() {
+		var name string
+		if err := r.Scan(&name); err != nil {
+			return err
+		}
+		attached = append(attached, name)
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(attached) == 0 {
+		return fmt.Errorf("no data nodes are attached to database %s; attach them with add_data_node() on the access node and load with -do-create-db=false", loader.DatabaseName())
+	}
+	if missing := missingDataNodes(dataNodes, attached); len(missing) > 0 {
+		return fmt.Errorf("data nodes %s are not attached to database %s, which has %s", strings.Join(missing, ","), loader.DatabaseName(), strings.Join(attached, ","))
+	}
+	if len(dataNodes) == 0 && replicationFactor > len(attached) {
+		return fmt.Errorf("-replication-factor %d exceeds the %d data nodes attached to database %s", replicationFactor, len(attached), loader.DatabaseName())
+	}
+	return nil
+}
+
+// missingDataNodes returns the nodes of want that are not among attached
+func missingDataNodes(want, attached []string) []string {
+	isAttached := make(map[string]bool, len(attached))
+	for _, node := range attached {
+		isAttached[node] = true
+	}
+	var missing []string
+	for _, node := range want {
+		if !isAttached[node] {
+			missing = append(missing, node)
+		}
+	}
+	return missing
+}
+
+// chunkTargetSizeRe matches a size in the units of pg_size_bytes, e.g., 512MB
+var chunkTargetSizeRe = regexp.MustCompile(`^[0-9]+ ?(bytes|[kMGT]B)?$`)
+
+// parseChunkTargetSize parses the -chunk-target-size flag: a size, 'estimate'
+// or 'off', which is the same as not setting it
+func parseChunkTargetSize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s == "off":
+		return "", nil
+	case s == "estimate" || chunkTargetSizeRe.MatchString(s):
+		return s, nil
+	}
+	return "", fmt.Errorf("'%s' is not a size (e.g., 1GB) or 'estimate'", s)
+}
+
+// setupAdaptiveChunking makes TimescaleDB adapt the chunk interval of the
+// hypertable, starting from -chunk-time, so that chunks are about
+// -chunk-target-size. TimescaleDB versions without adaptive chunking keep the
+// fixed interval.
+func setupAdaptiveChunking(dbBench *sql.DB, tableName string) {
+	if !hasFunction(dbBench, "set_adaptive_chunking") {
+		warnf("TimescaleDB version does not support adaptive chunking; using a fixed chunk interval of %v for %s", chunkTimeFor(tableName), tableName)
+		return
+	}
+	MustExecDDL(dbBench, fmt.Sprintf("SELECT set_adaptive_chunking(%s, '%s')", quoteRelation(tableName), chunkTargetSize))
+}
+
+// setupRetention adds a policy to drop chunks of the hypertable older than
+// retention. TimescaleDB versions without the policy API are skipped.
+func setupRetention(dbBench *sql.DB, tableName string) {
+	if !hasFunction(dbBench, "add_retention_policy") {
+		warnf("TimescaleDB version does not support retention policies; skipping retention setup for %s", tableName)
+		return
+	}
+	MustExecDDL(dbBench, fmt.Sprintf("SELECT add_retention_policy(%s, INTERVAL '%d microseconds')", quoteRelation(tableName), retention.Nanoseconds()/1000))
+	if !printDDL {
+		infof("added retention policy dropping chunks older than %v to %s", retention, tableName)
+	}
+}
+
+// continuousAggFunctions are the aggregate functions allowed in -continuous-aggregate
+var continuousAggFunctions = map[string]bool{"avg": true, "min": true, "max": true, "sum": true, "count": true}
+
+// parseContinuousAggregate parses the -continuous-aggregate flag: a bucket
+// width, optionally followed by a colon and a comma separated list of the
+// aggregate functions to apply to each field (avg if not given).
+func parseContinuousAggregate(s string) (time.Duration, []string, error) {
+	parts := strings.SplitN(s, ":", 2)
+	bucket, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil || bucket <= 0 {
+		return 0, nil, fmt.Errorf("invalid bucket width '%s': expected a positive duration, e.g., 1h", parts[0])
+	}
+	funcs := []string{"avg"}
+	if len(parts) == 2 {
+		funcs = funcs[:0]
+		for _, f := range strings.Split(parts[1], ",") {
+			f = strings.ToLower(strings.TrimSpace(f))
+			if !continuousAggFunctions[f] {
+				return 0, nil, fmt.Errorf("unsupported aggregate function '%s': expected avg, min, max, sum or count", f)
+			}
+			funcs = append(funcs, f)
+		}
+	}
+	return bucket, funcs, nil
+}
+
+// isNumericType returns whether a column of type t can be aggregated
+func isNumericType(t string) bool {
+	switch t = strings.ToUpper(t); {
+	case t == defaultFieldType, t == "REAL", t == "FLOAT", t == "BIGINT", t == "INTEGER", t == "INT", t == "SMALLINT":
+		return true
+	default:
+		return strings.HasPrefix(t, "NUMERIC") || strings.HasPrefix(t, "DECIMAL")
+	}
+}
+
+// continuousAggregateQuery returns the statement creating the continuous
+// aggregate of tableName, which applies each of continuousAggFuncs to each
+// of its numeric fields per tags_id and bucket. It returns "" if the table
+// has no numeric fields.
+func continuousAggregateQuery(view, tableName string, fieldDefs []string) string {
+	var aggs []string
+	for _, fieldDef := range fieldDefs {
+		parts := strings.SplitN(fieldDef, " ", 2)
+		if len(parts) < 2 || !isNumericType(parts[1]) {
+			continue
+		}
+		for _, f := range continuousAggFuncs {
+			aggs = append(aggs, fmt.Sprintf("%s(%s) AS %s", f, pq.QuoteIdentifier(parts[0]), pq.QuoteIdentifier(f+"_"+parts[0])))
+		}
+	}
+	if len(aggs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("CREATE MATERIALIZED VIEW %s WITH (timescaledb.continuous) AS SELECT time_bucket(INTERVAL '%d microseconds', %s) AS bucket, tags_id, %s FROM %s GROUP BY 1, 2 WITH NO DATA",
+		pq.QuoteIdentifier(view), continuousAggBucket.Nanoseconds()/1000, pq.QuoteIdentifier(timeColumnFor(tableName)), strings.Join(aggs, ", "), pq.QuoteIdentifier(tableName))
+}
+
+// setupContinuousAggregate creates a continuous aggregate of the hypertable,
+// named <table>_cagg, with a policy refreshing it every bucket width.
+// TimescaleDB versions without the policy API are skipped.
+func setupContinuousAggregate(dbBench *sql.DB, tableName string, fieldDefs []string) {
+	if !hasFunction(dbBench, "add_continuous_aggregate_policy") {
+		warnf("TimescaleDB version does not support continuous aggregate policies; skipping continuous aggregate for %s", tableName)
+		return
+	}
+	view := tableName + "_cagg"
+	query := continuousAggregateQuery(view, tableName, fieldDefs)
+	if query == "" {
+		warnf("%s has no numeric fields; skipping continuous aggregate", tableName)
+		return
+	}
+	bucket := continuousAggBucket.Nanoseconds() / 1000
+	MustExecDDL(dbBench, query)
+	MustExecDDL(dbBench, fmt.Sprintf("SELECT add_continuous_aggregate_policy(%s, start_offset => NULL, end_offset => INTERVAL '%d microseconds', schedule_interval => INTERVAL '%d microseconds')", quoteRelation(view), bucket, bucket))
+	if !printDDL {
+		infof("created continuous aggregate %s with %v buckets", view, continuousAggBucket)
+	}
+}
+
+// setupCompression enables native compression on the hypertable, segmented by
+// its partitioning column, and adds a policy to compress chunks older than
+// compressChunkInterval. TimescaleDB versions without compression are skipped.
+func setupCompression(dbBench *sql.DB, tableName string) {
+	if !hasFunction(dbBench, "add_compression_policy") {
+		warnf("TimescaleDB version does not support compression; skipping compression setup for %s", tableName)
+		return
+	}
+
+	segmentBy := "tags_id"
+	if inTableTag {
+		segmentBy = tableCols[tagsKey][0]
+	}
+	// The setting is a list of identifiers, which are quoted within it
+	MustExecDDL(dbBench, fmt.Sprintf("ALTER TABLE %s SET (timescaledb.compress, timescaledb.compress_segmentby = %s)", pq.QuoteIdentifier(tableName), quoteLiteral(pq.QuoteIdentifier(segmentBy))))
+	MustExecDDL(dbBench, fmt.Sprintf("SELECT add_compression_policy(%s, INTERVAL '%d microseconds')", quoteRelation(tableName), compressChunkInterval.Nanoseconds()/1000))
+}
+
 func (d *dbCreator) getCreateIndexOnFieldCmds(hypertable, field, idxType string) []string {
 	ret := []string{}
 	for _, idx := range strings.Split(idxType, ",") {
@@ -236,43 +1530,79 @@ func (d *dbCreator) getCreateIndexOnFieldCmds(hypertable, field, idxType string)
 			continue
 		}
 
+		timeCol := pq.QuoteIdentifier(timeColumnFor(hypertable))
+		quotedField := pq.QuoteIdentifier(field)
 		indexDef := ""
 		if idx == timeValueIdx {
-			indexDef = fmt.Sprintf("(time DESC, %s)", field)
+			indexDef = fmt.Sprintf("(%s DESC, %s)", timeCol, quotedField)
 		} else if idx == valueTimeIdx {
-			indexDef = fmt.Sprintf("(%s, time DESC)", field)
+			indexDef = fmt.Sprintf("(%s, %s DESC)", quotedField, timeCol)
+		} else if idx == brinTimeIdx {
+			indexDef = fmt.Sprintf("USING brin (%s)", timeCol)
+		} else if idx == brinValueIdx {
+			indexDef = fmt.Sprintf("USING brin (%s, %s)", timeCol, quotedField)
+		} else if idx == timeValueIncludeIdx {
+			tag := "tags_id"
+			if inTableTag {
+				tag = tableCols[tagsKey][0]
+			}
+			indexDef = fmt.Sprintf("(%s DESC, %s) INCLUDE (%s)", timeCol, pq.QuoteIdentifier(tag), strings.Join(quoteIdentifiers(includedFields(hypertable, field)), ", "))
 		} else {
 			fatal("Unknown index type %v", idx)
 		}
 
-		ret = append(ret, fmt.Sprintf("CREATE INDEX ON %s %s", hypertable, indexDef))
+		ret = append(ret, fmt.Sprintf("CREATE INDEX ON %s %s", pq.QuoteIdentifier(hypertable), indexDef))
+	}
+	return ret
+}
+
+// includedFields returns the fields of hypertable that a TIME-VALUE-INCLUDE
+// index on field covers: those named in -index-include, or else field itself
+func includedFields(hypertable, field string) []string {
+	var ret []string
+	for _, f := range tableCols[hypertable] {
+		if indexInclude[f] {
+			ret = append(ret, f)
+		}
+	}
+	if len(ret) == 0 {
+		return []string{field}
 	}
 	return ret
 }
 
 func createTagsTable(db *sql.DB, tagNames, tagTypes []string) {
-	MustExec(db, "DROP TABLE IF EXISTS tags")
+	MustExecDDL(db, "DROP TABLE IF EXISTS tags")
 	if useJSON {
-		MustExec(db, "CREATE TABLE tags(id SERIAL PRIMARY KEY, tagset JSONB)")
-		MustExec(db, "CREATE UNIQUE INDEX uniq1 ON tags(tagset)")
-		MustExec(db, "CREATE INDEX idxginp ON tags USING gin (tagset jsonb_path_ops);")
+		MustExecDDL(db, createTableCmd()+" tags(id SERIAL PRIMARY KEY, tagset JSONB)")
+		MustExecDDL(db, "CREATE UNIQUE INDEX uniq1 ON tags(tagset)")
+		MustExecDDL(db, "CREATE INDEX idxginp ON tags USING gin (tagset jsonb_path_ops);")
 		return
 	}
 
-	MustExec(db, generateTagsTableQuery(tagNames, tagTypes))
-	MustExec(db, fmt.Sprintf("CREATE UNIQUE INDEX uniq1 ON tags(%s)", strings.Join(tagNames, ",")))
-	MustExec(db, fmt.Sprintf("CREATE INDEX ON tags(%s)", tagNames[0]))
+	MustExecDDL(db, generateTagsTableQuery(tagNames, tagTypes))
+	MustExecDDL(db, fmt.Sprintf("CREATE UNIQUE INDEX uniq1 ON tags(%s)", strings.Join(quoteIdentifiers(tagNames), ",")))
+	MustExecDDL(db, fmt.Sprintf("CREATE INDEX ON tags(%s)", pq.QuoteIdentifier(tagNames[0])))
 }
 
 func generateTagsTableQuery(tagNames, tagTypes []string) string {
 	tagColumnDefinitions := make([]string, len(tagNames))
 	for i, tagName := range tagNames {
 		pgType := serializedTypeToPgType(tagTypes[i])
-		tagColumnDefinitions[i] = fmt.Sprintf("%s %s", tagName, pgType)
+		tagColumnDefinitions[i] = fmt.Sprintf("%s %s", pq.QuoteIdentifier(tagName), pgType)
 	}
 
 	cols := strings.Join(tagColumnDefinitions, ", ")
-	return fmt.Sprintf("CREATE TABLE tags(id SERIAL PRIMARY KEY, %s)", cols)
+	return fmt.Sprintf("%s tags(id SERIAL PRIMARY KEY, %s)", createTableCmd(), cols)
+}
+
+// createTableCmd returns the command creating the tags table and data tables,
+// which are not written to the WAL with -unlogged
+func createTableCmd() string {
+	if unlogged {
+		return "CREATE UNLOGGED TABLE"
+	}
+	return "CREATE TABLE"
 }
 
 func extractTagNamesAndTypes(tags []string) ([]string, []string) {
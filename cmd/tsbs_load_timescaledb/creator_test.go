@@ -4,8 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDBCreatorInit(t *testing.T) {
@@ -68,6 +75,7 @@ func TestDBCreatorReadDataHeader(t *testing.T) {
 		wantCols     []string
 		wantBuffered int
 		shouldFatal  bool
+		wantFatal    string
 	}{
 		{
 			desc:         "min case: exactly three lines",
@@ -107,6 +115,12 @@ func TestDBCreatorReadDataHeader(t *testing.T) {
 			input:       "tags",
 			shouldFatal: true,
 		},
+		{
+			desc:        "empty input",
+			input:       "",
+			shouldFatal: true,
+			wantFatal:   "no input received",
+		},
 	}
 
 	for _, c := range cases {
@@ -114,13 +128,17 @@ func TestDBCreatorReadDataHeader(t *testing.T) {
 		br := bufio.NewReader(bytes.NewReader([]byte(c.input)))
 		if c.shouldFatal {
 			isCalled := false
-			fatal = func(fmt string, args ...interface{}) {
+			msg := ""
+			fatal = func(format string, args ...interface{}) {
 				isCalled = true
-				log.Printf(fmt, args...)
+				msg = fmt.Sprintf(format, args...)
+				log.Printf(format, args...)
 			}
 			dbc.readDataHeader(br)
 			if !isCalled {
 				t.Errorf("%s: did not call fatal when it should", c.desc)
+			} else if !strings.Contains(msg, c.wantFatal) {
+				t.Errorf("%s: incorrect fatal message: got %q want %q", c.desc, msg, c.wantFatal)
 			}
 		} else {
 			dbc.readDataHeader(br)
@@ -142,14 +160,98 @@ func TestDBCreatorReadDataHeader(t *testing.T) {
 	}
 }
 
+func TestDBCreatorInitHeaderOnly(t *testing.T) {
+	// The loader must exit with an error, so Init is run in a child process
+	// with the default fatal
+	if os.Getenv("TSBS_TEST_HEADER_ONLY") == "1" {
+		fatal = exitOnError
+		dbc := &dbCreator{br: bufio.NewReader(strings.NewReader("tags,hostname string\ncpu,usage_user\n\n"))}
+		dbc.Init()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDBCreatorInitHeaderOnly$")
+	cmd.Env = append(os.Environ(), "TSBS_TEST_HEADER_ONLY=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.ExitCode() != 1 {
+		t.Fatalf("header-only input did not exit with status 1: %v\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "no input received") {
+		t.Errorf("incorrect error for header-only input:\n%s", stderr.String())
+	}
+}
+
+func TestDBCreatorInputHeaderLines(t *testing.T) {
+	d := &dbCreator{cols: []string{"cpu,usage_user", "mem,used"}}
+	if got := d.inputHeaderLines(); got != 4 {
+		t.Errorf("incorrect header lines: got %d want 4", got)
+	}
+	d.headerFile = "header.txt"
+	if got := d.inputHeaderLines(); got != 0 {
+		t.Errorf("incorrect header lines with a header file: got %d want 0", got)
+	}
+}
+
+func TestDBCreatorReadHeaderFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsbs-header")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		desc   string
+		header string
+	}{
+		{
+			desc:   "with blank line",
+			header: "tags,hostname string\ncpu,usage_user\n\n",
+		},
+		{
+			desc:   "without blank line",
+			header: "tags,hostname string\ncpu,usage_user\n",
+		},
+		{
+			desc:   "without line ender",
+			header: "tags,hostname string\ncpu,usage_user",
+		},
+	}
+	data := "tags,hostname=host_0\ncpu,1451606400000000000,58\n"
+	for _, c := range cases {
+		fileName := filepath.Join(dir, "header")
+		if err := ioutil.WriteFile(fileName, []byte(c.header), 0644); err != nil {
+			t.Fatalf("could not write header file: %v", err)
+		}
+		br := bufio.NewReader(bytes.NewBufferString(data))
+		dbc := &dbCreator{br: br, headerFile: fileName}
+		dbc.readHeader()
+		if got := dbc.tags; got != "tags,hostname string" {
+			t.Errorf("%s: incorrect tags: got %s", c.desc, got)
+		}
+		if got := dbc.cols; !reflect.DeepEqual(got, []string{"cpu,usage_user"}) {
+			t.Errorf("%s: incorrect cols: got %v", c.desc, got)
+		}
+		if got, _ := br.Peek(len(data)); string(got) != data {
+			t.Errorf("%s: data was consumed: got %q", c.desc, got)
+		}
+	}
+}
+
 func TestDBCreatorGetCreateIndexOnFieldSQL(t *testing.T) {
 	hypertable := "htable"
 	field := "foo"
-	valueTime := "CREATE INDEX ON htable (foo, time DESC)"
-	timeValue := "CREATE INDEX ON htable (time DESC, foo)"
+	valueTime := "CREATE INDEX ON \"htable\" (\"foo\", \"time\" DESC)"
+	timeValue := "CREATE INDEX ON \"htable\" (\"time\" DESC, \"foo\")"
+	brinTime := "CREATE INDEX ON \"htable\" USING brin (\"time\")"
+	brinValue := "CREATE INDEX ON \"htable\" USING brin (\"time\", \"foo\")"
+	oldTableCols, oldIndexInclude := tableCols[hypertable], indexInclude
+	defer func() { tableCols[hypertable], indexInclude = oldTableCols, oldIndexInclude }()
+	tableCols[hypertable] = []string{"foo", "bar", "baz"}
 	cases := []struct {
 		desc        string
 		idxType     string
+		include     map[string]bool
 		want        []string
 		shouldFatal bool
 	}{
@@ -173,6 +275,38 @@ func TestDBCreatorGetCreateIndexOnFieldSQL(t *testing.T) {
 			idxType: timeValueIdx + "," + valueTimeIdx,
 			want:    []string{timeValue, valueTime},
 		},
+		{
+			desc:    "single BRIN-TIME index",
+			idxType: brinTimeIdx,
+			want:    []string{brinTime},
+		},
+		{
+			desc:    "single BRIN-VALUE index",
+			idxType: brinValueIdx,
+			want:    []string{brinValue},
+		},
+		{
+			desc:    "BRIN and btree indexes",
+			idxType: valueTimeIdx + "," + brinValueIdx,
+			want:    []string{valueTime, brinValue},
+		},
+		{
+			desc:    "TIME-VALUE-INCLUDE index",
+			idxType: timeValueIncludeIdx,
+			want:    []string{"CREATE INDEX ON \"htable\" (\"time\" DESC, \"tags_id\") INCLUDE (\"foo\")"},
+		},
+		{
+			desc:    "TIME-VALUE-INCLUDE index with included fields",
+			idxType: timeValueIncludeIdx,
+			include: map[string]bool{"baz": true, "bar": true, "missing": true},
+			want:    []string{"CREATE INDEX ON \"htable\" (\"time\" DESC, \"tags_id\") INCLUDE (\"bar\", \"baz\")"},
+		},
+		{
+			desc:    "TIME-VALUE-INCLUDE index without included fields in table",
+			idxType: timeValueIncludeIdx,
+			include: map[string]bool{"missing": true},
+			want:    []string{"CREATE INDEX ON \"htable\" (\"time\" DESC, \"tags_id\") INCLUDE (\"foo\")"},
+		},
 		{
 			desc:        "bad idxType",
 			idxType:     "baz",
@@ -182,6 +316,7 @@ func TestDBCreatorGetCreateIndexOnFieldSQL(t *testing.T) {
 
 	for _, c := range cases {
 		dbc := &dbCreator{}
+		indexInclude = c.include
 		if c.shouldFatal {
 			isCalled := false
 			fatal = func(fmt string, args ...interface{}) {
@@ -211,7 +346,10 @@ func TestDBCreatorGetFieldAndIndexDefinitions(t *testing.T) {
 		desc            string
 		columns         []string
 		fieldIndexCount int
+		indexFields     map[string]bool
+		fieldIndex      string
 		inTableTag      bool
+		partitionCols   []string
 		wantFieldDefs   []string
 		wantIndexDefs   []string
 	}{
@@ -221,7 +359,7 @@ func TestDBCreatorGetFieldAndIndexDefinitions(t *testing.T) {
 			fieldIndexCount: -1,
 			inTableTag:      false,
 			wantFieldDefs:   []string{"usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION", "usage_idle DOUBLE PRECISION", "usage_nice DOUBLE PRECISION"},
-			wantIndexDefs:   []string{"CREATE INDEX ON cpu (usage_user, time DESC)", "CREATE INDEX ON cpu (usage_system, time DESC)", "CREATE INDEX ON cpu (usage_idle, time DESC)", "CREATE INDEX ON cpu (usage_nice, time DESC)"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" (\"usage_user\", \"time\" DESC)", "CREATE INDEX ON \"cpu\" (\"usage_system\", \"time\" DESC)", "CREATE INDEX ON \"cpu\" (\"usage_idle\", \"time\" DESC)", "CREATE INDEX ON \"cpu\" (\"usage_nice\", \"time\" DESC)"},
 		},
 		{
 			desc:            "no field indexes",
@@ -245,7 +383,16 @@ func TestDBCreatorGetFieldAndIndexDefinitions(t *testing.T) {
 			fieldIndexCount: 1,
 			inTableTag:      false,
 			wantFieldDefs:   []string{"usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION", "usage_idle DOUBLE PRECISION", "usage_nice DOUBLE PRECISION"},
-			wantIndexDefs:   []string{"CREATE INDEX ON cpu (usage_user, time DESC)"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" (\"usage_user\", \"time\" DESC)"},
+		},
+		{
+			desc:            "BRIN-TIME index only created once",
+			columns:         []string{"cpu", "usage_user", "usage_system"},
+			fieldIndexCount: -1,
+			fieldIndex:      brinTimeIdx + "," + brinValueIdx,
+			inTableTag:      false,
+			wantFieldDefs:   []string{"usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" USING brin (\"time\")", "CREATE INDEX ON \"cpu\" USING brin (\"time\", \"usage_user\")", "CREATE INDEX ON \"cpu\" USING brin (\"time\", \"usage_system\")"},
 		},
 		{
 			desc:            "two field indexes",
@@ -253,19 +400,57 @@ func TestDBCreatorGetFieldAndIndexDefinitions(t *testing.T) {
 			fieldIndexCount: 2,
 			inTableTag:      false,
 			wantFieldDefs:   []string{"usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION", "usage_idle DOUBLE PRECISION", "usage_nice DOUBLE PRECISION"},
-			wantIndexDefs:   []string{"CREATE INDEX ON cpu (usage_user, time DESC)", "CREATE INDEX ON cpu (usage_system, time DESC)"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" (\"usage_user\", \"time\" DESC)", "CREATE INDEX ON \"cpu\" (\"usage_system\", \"time\" DESC)"},
+		},
+		{
+			desc:            "one field index, partition columns, in table tag",
+			columns:         []string{"cpu", "usage_user", "usage_system"},
+			fieldIndexCount: 1,
+			inTableTag:      true,
+			partitionCols:   []string{"hostname", "region"},
+			wantFieldDefs:   []string{"hostname TEXT", "partition_key TEXT", "usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" (\"usage_user\", \"time\" DESC)"},
+		},
+		{
+			desc:          "field indexes by name",
+			columns:       []string{"cpu", "usage_user", "usage_system", "usage_idle", "usage_nice"},
+			indexFields:   map[string]bool{"usage_idle": true, "usage_nice": true, "usage_guest": true},
+			wantFieldDefs: []string{"usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION", "usage_idle DOUBLE PRECISION", "usage_nice DOUBLE PRECISION"},
+			wantIndexDefs: []string{"CREATE INDEX ON \"cpu\" (\"usage_idle\", \"time\" DESC)", "CREATE INDEX ON \"cpu\" (\"usage_nice\", \"time\" DESC)"},
+		},
+		{
+			desc:            "field indexes by name override count, in table tag",
+			columns:         []string{"cpu", "usage_user", "usage_system"},
+			fieldIndexCount: -1,
+			indexFields:     map[string]bool{"usage_system": true, "hostname": true},
+			inTableTag:      true,
+			wantFieldDefs:   []string{"hostname TEXT", "usage_user DOUBLE PRECISION", "usage_system DOUBLE PRECISION"},
+			wantIndexDefs:   []string{"CREATE INDEX ON \"cpu\" (\"usage_system\", \"time\" DESC)"},
 		},
 	}
 
+	oldInTableTag, oldPartitionColumns, oldIndexFields := inTableTag, partitionColumns, indexFields
+	defer func() {
+		inTableTag, partitionColumns, indexFields = oldInTableTag, oldPartitionColumns, oldIndexFields
+	}()
 	for _, c := range cases {
 		// Set the global in-table-tag flag based on the test case
 		inTableTag = c.inTableTag
+		partitionColumns = c.partitionCols
 		// Initialize global cache
 		tableCols[tagsKey] = []string{}
 		tableCols[tagsKey] = append(tableCols[tagsKey], "hostname")
 		dbc := &dbCreator{}
 		fieldIndexCount = c.fieldIndexCount
+		indexFields = c.indexFields
+		fieldIndex = valueTimeIdx
+		if c.fieldIndex != "" {
+			fieldIndex = c.fieldIndex
+		}
 		fieldDefs, indexDefs := dbc.getFieldAndIndexDefinitions(c.columns)
+		if len(indexDefs) != len(c.wantIndexDefs) {
+			t.Errorf("%s: incorrect number of indexDefs: got %d want %d", c.desc, len(indexDefs), len(c.wantIndexDefs))
+		}
 		for i, fieldDef := range fieldDefs {
 			if fieldDef != c.wantFieldDefs[i] {
 				t.Errorf("%s: incorrect fieldDef at idx %d: got %s want %s", c.desc, i, fieldDef, c.wantFieldDefs[i])
@@ -279,6 +464,34 @@ func TestDBCreatorGetFieldAndIndexDefinitions(t *testing.T) {
 	}
 }
 
+func TestTagIndexes(t *testing.T) {
+	tagNames := []string{"hostname", "region", "datacenter"}
+	cases := []struct {
+		desc    string
+		names   []string
+		want    []int
+		wantErr bool
+	}{
+		{desc: "none", names: nil, want: []int{}},
+		{desc: "multiple", names: []string{"datacenter", "hostname"}, want: []int{2, 0}},
+		{desc: "unknown tag", names: []string{"hostname", "rack"}, wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := tagIndexes(tagNames, c.names)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect indexes: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
 func TestExtractTagNamesAndTypes(t *testing.T) {
 	names, types := extractTagNamesAndTypes([]string{"tag1 type1", "tag2 type2"})
 	if names[0] != "tag1" || names[1] != "tag2" {
@@ -298,12 +511,12 @@ func TestGenerateTagsTableQuery(t *testing.T) {
 		{
 			in:  []string{"tag1"},
 			inT: []string{"string"},
-			out: "CREATE TABLE tags(id SERIAL PRIMARY KEY, tag1 TEXT)",
+			out: `CREATE TABLE tags(id SERIAL PRIMARY KEY, "tag1" TEXT)`,
 		}, {
 			in:  []string{"tag1", "tag2", "tag3", "tag4"},
 			inT: []string{"int32", "int64", "float32", "float64"},
-			out: "CREATE TABLE tags(id SERIAL PRIMARY KEY, tag1 INTEGER, tag2 BIGINT," +
-				" tag3 FLOAT, tag4 DOUBLE PRECISION)",
+			out: `CREATE TABLE tags(id SERIAL PRIMARY KEY, "tag1" INTEGER, "tag2" BIGINT,` +
+				` "tag3" FLOAT, "tag4" DOUBLE PRECISION)`,
 		},
 	}
 
@@ -317,6 +530,16 @@ func TestGenerateTagsTableQuery(t *testing.T) {
 	}
 }
 
+func TestGenerateTagsTableQueryUnlogged(t *testing.T) {
+	oldUnlogged := unlogged
+	defer func() { unlogged = oldUnlogged }()
+	unlogged = true
+	want := `CREATE UNLOGGED TABLE tags(id SERIAL PRIMARY KEY, "tag1" TEXT)`
+	if got := generateTagsTableQuery([]string{"tag1"}, []string{"string"}); got != want {
+		t.Errorf("incorrect unlogged tags table query: got %s want %s", got, want)
+	}
+}
+
 func TestGenerateTagsTableQueryPanicOnWrongType(t *testing.T) {
 	defer func() {
 		r := recover()
@@ -329,3 +552,763 @@ func TestGenerateTagsTableQueryPanicOnWrongType(t *testing.T) {
 
 	t.Fatalf("test should have stopped at this point")
 }
+
+func TestParseFieldTypes(t *testing.T) {
+	cases := []struct {
+		desc    string
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+			in:   "",
+			want: map[string]string{},
+		},
+		{
+			desc: "one field",
+			in:   "usage_user=BIGINT",
+			want: map[string]string{"usage_user": "BIGINT"},
+		},
+		{
+			desc: "multiple fields w/ spaces and prefix",
+			in:   "usage_user=BIGINT, usage_*=INTEGER,up = BOOLEAN",
+			want: map[string]string{"usage_user": "BIGINT", "usage_*": "INTEGER", "up": "BOOLEAN"},
+		},
+		{
+			desc:    "missing type",
+			in:      "usage_user=",
+			wantErr: true,
+		},
+		{
+			desc:    "missing equals",
+			in:      "usage_user",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := parseFieldTypes(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect field types: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestFieldTypeFor(t *testing.T) {
+	oldFieldTypes := fieldTypes
+	fieldTypes = map[string]string{
+		"usage_user":   "BIGINT",
+		"usage_*":      "INTEGER",
+		"usage_sys*":   "SMALLINT",
+		"other_prefix": "BOOLEAN",
+	}
+	cases := map[string]string{
+		"usage_user":    "BIGINT",
+		"usage_idle":    "INTEGER",
+		"usage_system":  "SMALLINT",
+		"other":         defaultFieldType,
+		"other_prefix":  "BOOLEAN",
+		"other_prefix2": defaultFieldType,
+	}
+	for field, want := range cases {
+		if got := fieldTypeFor(field); got != want {
+			t.Errorf("incorrect type for %s: got %s want %s", field, got, want)
+		}
+	}
+	if got, want := rawFields("cpu", []string{"usage_user", "other"}), []bool{true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect raw fields: got %v want %v", got, want)
+	}
+
+	oldInferred := inferredFieldTypes
+	inferredFieldTypes = map[string]map[string]string{"cpu": {"usage_user": "TEXT", "other": "BIGINT"}}
+	if got := tableFieldType("cpu", "usage_user"); got != "BIGINT" {
+		t.Errorf("incorrect type for field with set and inferred type: got %s want BIGINT", got)
+	}
+	if got := tableFieldType("cpu", "other"); got != "BIGINT" {
+		t.Errorf("incorrect type for field with inferred type: got %s want BIGINT", got)
+	}
+	if got := tableFieldType("mem", "other"); got != defaultFieldType {
+		t.Errorf("incorrect type for field of table without inferred types: got %s want %s", got, defaultFieldType)
+	}
+	inferredFieldTypes = oldInferred
+	fieldTypes = oldFieldTypes
+}
+
+func TestInferTypesFromRows(t *testing.T) {
+	cols := []string{"cpu,usage_user,usage_system,up,state,missing", "mem,used", "disk,free"}
+	data := "tags,hostname=host_0\ncpu,100,58,1.5,true,idle,\n" +
+		"tags,hostname=host_1\ncpu,100,58.5,2,false,busy,3\n" +
+		"tags,hostname=host_0\nmem,100,-3e2\n" +
+		"tags,hostname=host_0\ndisk,10"
+	want := map[string]map[string]string{
+		"cpu": {"usage_user": "BIGINT", "usage_system": defaultFieldType, "up": "BOOLEAN", "state": "TEXT"},
+		"mem": {"used": defaultFieldType},
+	}
+	if got := inferTypesFromRows(data, cols); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect inferred types: got %v want %v", got, want)
+	}
+}
+
+func TestDeferredIndexDef(t *testing.T) {
+	indexDef := "CREATE INDEX ON cpu(tags_id, \"time\" DESC)"
+	cases := []struct {
+		desc          string
+		concurrently  bool
+		useHypertable bool
+		want          string
+	}{
+		{
+			desc: "not concurrently",
+			want: indexDef,
+		},
+		{
+			desc:         "concurrently on regular table",
+			concurrently: true,
+			want:         "CREATE INDEX CONCURRENTLY ON cpu(tags_id, \"time\" DESC)",
+		},
+		{
+			desc:          "concurrently on hypertable",
+			concurrently:  true,
+			useHypertable: true,
+			want:          indexDef + " WITH (timescaledb.transaction_per_chunk)",
+		},
+	}
+
+	oldConcurrently, oldUseHypertable := createIndexConcurrently, useHypertable
+	for _, c := range cases {
+		createIndexConcurrently = c.concurrently
+		useHypertable = c.useHypertable
+		if got := deferredIndexDef(indexDef); got != c.want {
+			t.Errorf("%s: incorrect index def: got %s want %s", c.desc, got, c.want)
+		}
+	}
+	createIndexConcurrently, useHypertable = oldConcurrently, oldUseHypertable
+}
+
+func TestValidateDataHeader(t *testing.T) {
+	cases := []struct {
+		desc    string
+		tags    string
+		cols    []string
+		wantErr bool
+	}{
+		{
+			desc: "valid header",
+			tags: "tags,hostname string,region string",
+			cols: []string{"cpu,usage_user,usage_system", "mem,used"},
+		},
+		{
+			desc:    "influx line protocol",
+			tags:    "cpu,hostname=host_0,region=eu-west-1 usage_user=58i 1451606400000000000",
+			cols:    []string{"cpu,hostname=host_1 usage_user=2i 1451606400000000000"},
+			wantErr: true,
+		},
+		{
+			desc:    "no tags",
+			tags:    "tags",
+			cols:    []string{"cpu,usage_user"},
+			wantErr: true,
+		},
+		{
+			desc:    "tag without type",
+			tags:    "tags,hostname",
+			cols:    []string{"cpu,usage_user"},
+			wantErr: true,
+		},
+		{
+			desc:    "no tables",
+			tags:    "tags,hostname string",
+			wantErr: true,
+		},
+		{
+			desc:    "table without fields",
+			tags:    "tags,hostname string",
+			cols:    []string{"cpu"},
+			wantErr: true,
+		},
+		{
+			desc:    "empty field",
+			tags:    "tags,hostname string",
+			cols:    []string{"cpu,,usage_system"},
+			wantErr: true,
+		},
+		{
+			desc:    "field with space",
+			tags:    "tags,hostname string",
+			cols:    []string{"cpu,usage user"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := validateDataHeader(c.tags, c.cols)
+		if c.wantErr && err == nil {
+			t.Errorf("%s: expected error but got none", c.desc)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestCheckColumnsMatch(t *testing.T) {
+	want := hypertableColumns("cpu", []string{"usage_user DOUBLE PRECISION", "usage_system BIGINT"})
+	if got := []string{"time", "tags_id", "additional_tags", "usage_user", "usage_system"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("incorrect hypertable columns: got %v want %v", want, got)
+	}
+
+	cases := []struct {
+		desc    string
+		got     []string
+		wantErr bool
+	}{
+		{
+			desc: "same order",
+			got:  []string{"time", "tags_id", "additional_tags", "usage_user", "usage_system"},
+		},
+		{
+			desc: "different order",
+			got:  []string{"usage_system", "time", "usage_user", "tags_id", "additional_tags"},
+		},
+		{
+			desc:    "missing column",
+			got:     []string{"time", "tags_id", "additional_tags", "usage_user"},
+			wantErr: true,
+		},
+		{
+			desc:    "extra column",
+			got:     []string{"time", "tags_id", "additional_tags", "usage_user", "usage_system", "usage_idle"},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		err := checkColumnsMatch("cpu", c.got, want)
+		if c.wantErr && err == nil {
+			t.Errorf("%s: expected error but got none", c.desc)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestDBCreatorResetTruncate(t *testing.T) {
+	oldTarget, oldReset := target, resetMode
+	defer func() { target, resetMode = oldTarget, oldReset }()
+	target = &timescaleLoader{}
+	resetMode = resetTruncate
+	// No connection is made since the database is neither dropped nor created
+	d := &dbCreator{connStr: "host=invalid"}
+	if err := d.RemoveOldDB("benchmark"); err != nil {
+		t.Fatalf("unexpected error removing the database: %v", err)
+	}
+	if !d.keepDB {
+		t.Errorf("database not kept with -reset=truncate")
+	}
+	if err := d.CreateDB("benchmark"); err != nil {
+		t.Errorf("unexpected error creating the database: %v", err)
+	}
+}
+
+func TestCountPartitionKeys(t *testing.T) {
+	data := "tags,hostname=host_0,region=eu\ncpu,100,1\n" +
+		"tags,hostname=host_1,region=eu\ncpu,100,2\n" +
+		"tags,hostname=host_0,region=eu\nmem,100,3\n" +
+		"tags,hostname=host_2,region=eu\ncpu,200,4\n" +
+		"tags,hostname=host_3,region=eu\ncpu,20"
+	cases := []struct {
+		desc       string
+		maxRows    int
+		wantCounts map[string]int
+		wantRows   map[string]int
+	}{
+		{
+			desc:       "all rows",
+			maxRows:    10,
+			wantCounts: map[string]int{"cpu": 3, "mem": 1},
+			wantRows:   map[string]int{"cpu": 3, "mem": 1},
+		},
+		{
+			desc:       "limited rows",
+			maxRows:    2,
+			wantCounts: map[string]int{"cpu": 2, "mem": 1},
+			wantRows:   map[string]int{"cpu": 2, "mem": 1},
+		},
+	}
+
+	for _, c := range cases {
+		counts, rows := countPartitionKeys(data, c.maxRows)
+		if !reflect.DeepEqual(counts, c.wantCounts) {
+			t.Errorf("%s: incorrect counts: got %v want %v", c.desc, counts, c.wantCounts)
+		}
+		if !reflect.DeepEqual(rows, c.wantRows) {
+			t.Errorf("%s: incorrect rows: got %v want %v", c.desc, rows, c.wantRows)
+		}
+	}
+}
+
+func TestParsePartitions(t *testing.T) {
+	cases := []struct {
+		desc        string
+		in          string
+		wantDefault int
+		want        map[string]int
+		wantErr     bool
+	}{
+		{desc: "bare integer", in: "4", wantDefault: 4, want: map[string]int{}},
+		{desc: "per hypertable", in: "cpu=16,disk=2", wantDefault: 1, want: map[string]int{"cpu": 16, "disk": 2}},
+		{desc: "per hypertable w/ default", in: "4, cpu=16", wantDefault: 4, want: map[string]int{"cpu": 16}},
+		{desc: "two defaults", in: "4,8", wantErr: true},
+		{desc: "not a number", in: "cpu=many", wantErr: true},
+		{desc: "zero", in: "0", wantErr: true},
+	}
+	for _, c := range cases {
+		gotDefault, got, err := parsePartitions(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if gotDefault != c.wantDefault {
+			t.Errorf("%s: incorrect default: got %d want %d", c.desc, gotDefault, c.wantDefault)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect partitions: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestParseChunkTimes(t *testing.T) {
+	cases := []struct {
+		desc        string
+		in          string
+		wantDefault time.Duration
+		want        map[string]time.Duration
+		wantErr     bool
+	}{
+		{desc: "bare duration", in: "8h", wantDefault: 8 * time.Hour, want: map[string]time.Duration{}},
+		{desc: "per hypertable", in: "cpu=1h,disk=24h", wantDefault: defaultChunkTime, want: map[string]time.Duration{"cpu": time.Hour, "disk": 24 * time.Hour}},
+		{desc: "per hypertable w/ default", in: "8h, cpu=30m", wantDefault: 8 * time.Hour, want: map[string]time.Duration{"cpu": 30 * time.Minute}},
+		{desc: "two defaults", in: "8h,12h", wantErr: true},
+		{desc: "not a duration", in: "cpu=12", wantErr: true},
+		{desc: "zero", in: "cpu=0s", wantErr: true},
+		{desc: "negative", in: "-1h", wantErr: true},
+	}
+	for _, c := range cases {
+		gotDefault, got, err := parseChunkTimes(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if gotDefault != c.wantDefault {
+			t.Errorf("%s: incorrect default: got %v want %v", c.desc, gotDefault, c.wantDefault)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect chunk times: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestParseTimeColumns(t *testing.T) {
+	cases := []struct {
+		desc        string
+		in          string
+		wantDefault string
+		want        map[string]string
+		wantErr     bool
+	}{
+		{desc: "empty", in: "", wantDefault: defaultTimeColumn, want: map[string]string{}},
+		{desc: "bare name", in: "ts", wantDefault: "ts", want: map[string]string{}},
+		{desc: "per hypertable w/ default", in: "time, cpu=ts,disk=created_at", wantDefault: "time", want: map[string]string{"cpu": "ts", "disk": "created_at"}},
+		{desc: "two defaults", in: "ts,time", wantErr: true},
+		{desc: "uppercase", in: "cpu=Ts", wantErr: true},
+		{desc: "not a name", in: "cpu=ts DESC", wantErr: true},
+	}
+	for _, c := range cases {
+		gotDefault, got, err := parseTimeColumns(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if gotDefault != c.wantDefault {
+			t.Errorf("%s: incorrect default: got %v want %v", c.desc, gotDefault, c.wantDefault)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect time columns: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestParseChunkTargetSize(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "off", want: ""},
+		{in: "estimate", want: "estimate"},
+		{in: "1GB", want: "1GB"},
+		{in: " 512 MB", want: "512 MB"},
+		{in: "1048576", want: "1048576"},
+		{in: "1gb", wantErr: true},
+		{in: "1.5GB", wantErr: true},
+		{in: "1GB'; DROP TABLE cpu; --", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseChunkTargetSize(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.in, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect size: got %s want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	cases := []struct {
+		start, end string
+		wantErr    bool
+	}{
+		{start: "2016-01-01T00:00:00Z", end: "2016-01-02T00:00:00Z"},
+		{start: "", end: "2016-01-02T00:00:00Z", wantErr: true},
+		{start: "2016-01-01", end: "2016-01-02T00:00:00Z", wantErr: true},
+		{start: "2016-01-02T00:00:00Z", end: "2016-01-01T00:00:00Z", wantErr: true},
+		{start: "2016-01-01T00:00:00Z", end: "2016-01-01T00:00:00Z", wantErr: true},
+	}
+	for _, c := range cases {
+		_, _, err := parseTimeRange(c.start, c.end)
+		if c.wantErr && err == nil {
+			t.Errorf("%s to %s: expected error but got none", c.start, c.end)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s to %s: unexpected error: %v", c.start, c.end, err)
+		}
+	}
+}
+
+func TestNativePartitionQueries(t *testing.T) {
+	start := time.Date(2016, 1, 1, 3, 0, 0, 0, time.UTC)
+	end := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	bounds, err := nativePartitionBounds(start, end, 12*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"CREATE TABLE \"cpu_p0\" PARTITION OF \"cpu\" FOR VALUES FROM ('2016-01-01T00:00:00Z') TO ('2016-01-01T12:00:00Z')",
+		"CREATE TABLE \"cpu_p1\" PARTITION OF \"cpu\" FOR VALUES FROM ('2016-01-01T12:00:00Z') TO ('2016-01-02T00:00:00Z')",
+		"CREATE TABLE \"cpu_default\" PARTITION OF \"cpu\" DEFAULT",
+	}
+	if got := nativePartitionQueries("cpu", bounds); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect partition queries: got %v want %v", got, want)
+	}
+
+	if _, err := nativePartitionBounds(start, end.AddDate(10, 0, 0), time.Minute); err == nil {
+		t.Errorf("expected error for too many partitions but got none")
+	}
+}
+
+func TestParseContinuousAggregate(t *testing.T) {
+	cases := []struct {
+		desc       string
+		in         string
+		wantBucket time.Duration
+		wantFuncs  []string
+		wantErr    bool
+	}{
+		{desc: "bucket only", in: "1h", wantBucket: time.Hour, wantFuncs: []string{"avg"}},
+		{desc: "bucket w/ functions", in: "15m:avg, MAX", wantBucket: 15 * time.Minute, wantFuncs: []string{"avg", "max"}},
+		{desc: "not a duration", in: "hourly", wantErr: true},
+		{desc: "zero bucket", in: "0s:avg", wantErr: true},
+		{desc: "unsupported function", in: "1h:median", wantErr: true},
+		{desc: "no functions", in: "1h:", wantErr: true},
+	}
+	for _, c := range cases {
+		bucket, funcs, err := parseContinuousAggregate(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if bucket != c.wantBucket {
+			t.Errorf("%s: incorrect bucket: got %v want %v", c.desc, bucket, c.wantBucket)
+		}
+		if !reflect.DeepEqual(funcs, c.wantFuncs) {
+			t.Errorf("%s: incorrect functions: got %v want %v", c.desc, funcs, c.wantFuncs)
+		}
+	}
+}
+
+func TestContinuousAggregateQuery(t *testing.T) {
+	oldBucket, oldFuncs := continuousAggBucket, continuousAggFuncs
+	defer func() { continuousAggBucket, continuousAggFuncs = oldBucket, oldFuncs }()
+	continuousAggBucket = time.Hour
+	continuousAggFuncs = []string{"avg", "max"}
+
+	fieldDefs := []string{"hostname TEXT", "usage_user DOUBLE PRECISION", "free BIGINT", "status TEXT"}
+	want := `CREATE MATERIALIZED VIEW "cpu_cagg" WITH (timescaledb.continuous) AS SELECT time_bucket(INTERVAL '3600000000 microseconds', "time") AS bucket, tags_id, ` +
+		`avg("usage_user") AS "avg_usage_user", max("usage_user") AS "max_usage_user", avg("free") AS "avg_free", max("free") AS "max_free" FROM "cpu" GROUP BY 1, 2 WITH NO DATA`
+	if got := continuousAggregateQuery("cpu_cagg", "cpu", fieldDefs); got != want {
+		t.Errorf("incorrect query: got\n%s\nwant\n%s", got, want)
+	}
+	if got := continuousAggregateQuery("tags_cagg", "tags", []string{"hostname TEXT"}); got != "" {
+		t.Errorf("incorrect query without numeric fields: got %s", got)
+	}
+}
+
+func TestCreateHypertableQuery(t *testing.T) {
+	oldChunkTime, oldTimeColumnType, oldPartitions := chunkTime, timeColumnType, numberPartitions
+	oldDistributed, oldDataNodes, oldReplicationFactor := distributed, dataNodes, replicationFactor
+	oldTableTimeColumns := tableTimeColumns
+	defer func() {
+		chunkTime, timeColumnType, numberPartitions = oldChunkTime, oldTimeColumnType, oldPartitions
+		distributed, dataNodes, replicationFactor = oldDistributed, oldDataNodes, oldReplicationFactor
+		tableTimeColumns = oldTableTimeColumns
+	}()
+	chunkTime, timeColumnType, numberPartitions = time.Hour, timeColumnTimestamptz, 2
+
+	cases := []struct {
+		desc              string
+		distributed       bool
+		dataNodes         []string
+		replicationFactor int
+		timeColumns       map[string]string
+		want              string
+	}{
+		{
+			desc: "hypertable",
+			want: "SELECT create_hypertable('\"cpu\"'::regclass, 'time'::name, partitioning_column => 'tags_id'::name, number_partitions => 2::smallint, chunk_time_interval => 3600000000, create_default_indexes=>FALSE)",
+		},
+		{
+			desc:        "custom time column",
+			timeColumns: map[string]string{"cpu": "ts"},
+			want:        "SELECT create_hypertable('\"cpu\"'::regclass, 'ts'::name, partitioning_column => 'tags_id'::name, number_partitions => 2::smallint, chunk_time_interval => 3600000000, create_default_indexes=>FALSE)",
+		},
+		{
+			desc:              "distributed over all data nodes",
+			distributed:       true,
+			replicationFactor: 1,
+			want:              "SELECT create_distributed_hypertable('\"cpu\"'::regclass, 'time'::name, partitioning_column => 'tags_id'::name, number_partitions => 2::smallint, chunk_time_interval => 3600000000, create_default_indexes=>FALSE, replication_factor => 1)",
+		},
+		{
+			desc:              "distributed over given data nodes",
+			distributed:       true,
+			dataNodes:         []string{"dn1", "dn2"},
+			replicationFactor: 2,
+			want:              "SELECT create_distributed_hypertable('\"cpu\"'::regclass, 'time'::name, partitioning_column => 'tags_id'::name, number_partitions => 2::smallint, chunk_time_interval => 3600000000, create_default_indexes=>FALSE, replication_factor => 2, data_nodes => ARRAY['dn1','dn2']::name[])",
+		},
+		{
+			desc:              "data node names needing quoting",
+			distributed:       true,
+			dataNodes:         []string{"dn's 1", `dn"2}`},
+			replicationFactor: 2,
+			want:              "SELECT create_distributed_hypertable('\"cpu\"'::regclass, 'time'::name, partitioning_column => 'tags_id'::name, number_partitions => 2::smallint, chunk_time_interval => 3600000000, create_default_indexes=>FALSE, replication_factor => 2, data_nodes => ARRAY['dn''s 1','dn\"2}']::name[])",
+		},
+	}
+	for _, c := range cases {
+		distributed, dataNodes, replicationFactor = c.distributed, c.dataNodes, c.replicationFactor
+		tableTimeColumns = c.timeColumns
+		if got := createHypertableQuery("cpu"); got != c.want {
+			t.Errorf("%s: incorrect query: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestUniqueIndexQuery(t *testing.T) {
+	oldPartitionColumns, oldPartitions, oldChunkTime := partitionColumns, numberPartitions, chunkTime
+	defer func() {
+		partitionColumns, numberPartitions, chunkTime = oldPartitionColumns, oldPartitions, oldChunkTime
+	}()
+	numberPartitions, chunkTime = 2, time.Hour
+
+	partitionColumns = nil
+	if got, want := uniqueIndexQuery("cpu"), `CREATE UNIQUE INDEX ON "cpu"(tags_id, "time" DESC)`; got != want {
+		t.Errorf("incorrect unique index: got\n%s\nwant\n%s", got, want)
+	}
+
+	// The unique index must include the partition key the hypertable is
+	// partitioned on
+	partitionColumns = []string{"region"}
+	if got, want := uniqueIndexQuery("cpu"), `CREATE UNIQUE INDEX ON "cpu"(tags_id, "time" DESC, "partition_key")`; got != want {
+		t.Errorf("incorrect unique index with partition columns: got\n%s\nwant\n%s", got, want)
+	}
+	if got, want := createHypertableQuery("cpu"), "partitioning_column => 'partition_key'::name"; !strings.Contains(got, want) {
+		t.Errorf("hypertable not partitioned on the partition key: got\n%s", got)
+	}
+}
+
+func TestMissingDataNodes(t *testing.T) {
+	attached := []string{"dn1", "dn2", "dn3"}
+	cases := []struct {
+		want []string
+		exp  []string
+	}{
+		{want: nil, exp: nil},
+		{want: []string{"dn1", "dn3"}, exp: nil},
+		{want: []string{"dn1", "dn4", "dn5"}, exp: []string{"dn4", "dn5"}},
+	}
+	for _, c := range cases {
+		if got := missingDataNodes(c.want, attached); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("%v: incorrect missing data nodes: got %v want %v", c.want, got, c.exp)
+		}
+	}
+}
+
+func TestCreateIndexQueues(t *testing.T) {
+	oldIndexAfterLoad, oldConcurrently := indexAfterLoad, createIndexConcurrently
+	defer func() {
+		indexAfterLoad, createIndexConcurrently = oldIndexAfterLoad, oldConcurrently
+	}()
+	createIndexConcurrently = false
+
+	dbc := &dbCreator{}
+	indexAfterLoad = false
+	dbc.createIndex("CREATE INDEX ON cpu(time)")
+	indexAfterLoad = true
+	dbc.createIndex("CREATE INDEX ON cpu(usage_user)")
+
+	if want := []string{"CREATE INDEX ON cpu(time)"}; !reflect.DeepEqual(dbc.pendingIndexes, want) {
+		t.Errorf("incorrect pending indexes: got %v want %v", dbc.pendingIndexes, want)
+	}
+	if want := []string{"CREATE INDEX ON cpu(usage_user)"}; !reflect.DeepEqual(dbc.deferredIndexes, want) {
+		t.Errorf("incorrect deferred indexes: got %v want %v", dbc.deferredIndexes, want)
+	}
+}
+
+func TestParseTableKey(t *testing.T) {
+	cases := []struct {
+		desc           string
+		primaryKey     string
+		uniqueKey      string
+		want           []string
+		wantConstraint string
+		shouldErr      bool
+	}{
+		{desc: "none"},
+		{desc: "primary key", primaryKey: "time, tags_id", want: []string{"time", "tags_id"}, wantConstraint: "PRIMARY KEY"},
+		{desc: "unique key", uniqueKey: "time,hostname", want: []string{"time", "hostname"}, wantConstraint: "UNIQUE"},
+		{desc: "both", primaryKey: "time", uniqueKey: "time", shouldErr: true},
+		{desc: "repeated column", primaryKey: "time,time", shouldErr: true},
+		{desc: "empty column", primaryKey: "time,,tags_id", shouldErr: true},
+	}
+	for _, c := range cases {
+		key, constraint, err := parseTableKey(c.primaryKey, c.uniqueKey)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if !reflect.DeepEqual(key, c.want) || (len(key) > 0 && constraint != c.wantConstraint) {
+			t.Errorf("%s: incorrect key: got %v %s want %v %s", c.desc, key, constraint, c.want, c.wantConstraint)
+		}
+	}
+}
+
+func TestCheckPartitionedKey(t *testing.T) {
+	oldUseHypertable, oldPartitioning, oldPartitionColumns := useHypertable, partitioning, partitionColumns
+	defer func() {
+		useHypertable, partitioning, partitionColumns = oldUseHypertable, oldPartitioning, oldPartitionColumns
+	}()
+	cases := []struct {
+		desc             string
+		useHypertable    bool
+		partitioning     string
+		partitionColumns []string
+		key              []string
+		shouldErr        bool
+	}{
+		{desc: "hypertable", useHypertable: true, key: []string{"tags_id", "time"}},
+		{desc: "hypertable without time", useHypertable: true, key: []string{"tags_id"}, shouldErr: true},
+		{desc: "hypertable without tags_id", useHypertable: true, key: []string{"time", "usage_user"}, shouldErr: true},
+		{desc: "hypertable with partition key", useHypertable: true, partitionColumns: []string{"region"}, key: []string{"time", "partition_key"}},
+		{desc: "hypertable with partition key but tags_id", useHypertable: true, partitionColumns: []string{"region"}, key: []string{"time", "tags_id"}, shouldErr: true},
+		{desc: "native partitioning", partitioning: partitioningNative, key: []string{"time", "usage_user"}},
+		{desc: "native partitioning without time", partitioning: partitioningNative, key: []string{"tags_id"}, shouldErr: true},
+		{desc: "plain table", partitioning: partitioningHypertable, key: []string{"usage_user"}},
+	}
+	for _, c := range cases {
+		useHypertable, partitioning, partitionColumns = c.useHypertable, c.partitioning, c.partitionColumns
+		err := checkPartitionedKey(c.key)
+		if c.shouldErr && err == nil {
+			t.Errorf("%s: expected error but got none", c.desc)
+		} else if !c.shouldErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestQuoteFieldDefs(t *testing.T) {
+	fieldDefs := []string{"usage_user DOUBLE PRECISION", "order BIGINT", "Value TEXT", `a"b DOUBLE PRECISION`}
+	want := []string{`"usage_user" DOUBLE PRECISION`, `"order" BIGINT`, `"Value" TEXT`, `"a""b" DOUBLE PRECISION`}
+	if got := quoteFieldDefs(fieldDefs); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect field definitions: got %v want %v", got, want)
+	}
+}
+
+func TestQuoteRelation(t *testing.T) {
+	cases := map[string]string{
+		"cpu":      `'"cpu"'`,
+		"Cpu":      `'"Cpu"'`,
+		`it's`:     `'"it''s"'`,
+		`a"b`:      `'"a""b"'`,
+		"cpu_cagg": `'"cpu_cagg"'`,
+	}
+	for name, want := range cases {
+		if got := quoteRelation(name); got != want {
+			t.Errorf("incorrect literal for %s: got %s want %s", name, got, want)
+		}
+	}
+}
+
+func TestTableKeyDef(t *testing.T) {
+	oldKey, oldConstraint := tableKey, tableKeyConstraint
+	defer func() { tableKey, tableKeyConstraint = oldKey, oldConstraint }()
+	tableKey, tableKeyConstraint = []string{"time", "tags_id"}, "PRIMARY KEY"
+	columns := hypertableColumns("cpu", []string{"usage_user DOUBLE PRECISION"})
+	if got, err := tableKeyDef("cpu", columns); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if want := `PRIMARY KEY ("time","tags_id")`; got != want {
+		t.Errorf("incorrect key definition: got %s want %s", got, want)
+	}
+	tableKey = []string{"time", "hostname"}
+	if _, err := tableKeyDef("cpu", columns); err == nil {
+		t.Errorf("expected error for a key column not in the table but got none")
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/csv"
 	"fmt"
-	"log"
 	"os"
 	"sync"
 	"time"
@@ -42,12 +41,17 @@ func getReplicationStats(db *sqlx.DB) []ReplicationStats {
 */
 func OutputReplicationStats(dbConnString string, outputFileName string, wg *sync.WaitGroup) {
 	wg.Add(1)
-	db := sqlx.MustConnect("postgres", dbConnString)
+	db, err := sqlx.Connect("postgres", dbConnString)
+	if err != nil {
+		fatal("could not connect to write replication stats: %v", redactErr(err))
+		return
+	}
 	defer wg.Done()
 	defer db.Close()
 	outputFile, err := os.Create(outputFileName)
 	if err != nil {
-		log.Fatal(err)
+		fatal("cannot create replication stats file: %v", err)
+		return
 	}
 	defer outputFile.Close()
 	writer := csv.NewWriter(outputFile)
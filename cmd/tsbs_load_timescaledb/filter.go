@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// filteredRows is the number of input rows dropped because their hypertable
+// is not selected with -only-hypertables or -skip-hypertables
+var filteredRows uint64
+
+// parseHypertables returns the set of the comma-separated hypertable names in s,
+// or nil if s is empty
+func parseHypertables(s string) map[string]bool {
+	if len(s) == 0 {
+		return nil
+	}
+	ret := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		ret[strings.TrimSpace(name)] = true
+	}
+	return ret
+}
+
+// hypertableSelected returns whether the rows of hypertable are loaded, given
+// -only-hypertables and -skip-hypertables
+func hypertableSelected(hypertable string) bool {
+	if onlyHypertables != nil {
+		return onlyHypertables[hypertable]
+	}
+	return !skipHypertables[hypertable]
+}
+
+// unknownHypertables returns the names given with -only-hypertables or
+// -skip-hypertables that are not among the tables of the header, in order
+func unknownHypertables(tables []string) []string {
+	known := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		known[t] = true
+	}
+	var ret []string
+	for _, names := range []map[string]bool{onlyHypertables, skipHypertables} {
+		for name := range names {
+			if !known[name] {
+				ret = append(ret, name)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
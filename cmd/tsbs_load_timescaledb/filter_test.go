@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHypertableSelected(t *testing.T) {
+	oldOnly, oldSkip := onlyHypertables, skipHypertables
+	defer func() { onlyHypertables, skipHypertables = oldOnly, oldSkip }()
+	cases := []struct {
+		desc string
+		only string
+		skip string
+		want map[string]bool
+	}{
+		{desc: "no filter", want: map[string]bool{"cpu": true, "mem": true}},
+		{desc: "only", only: "cpu, disk", want: map[string]bool{"cpu": true, "mem": false}},
+		{desc: "skip", skip: "cpu", want: map[string]bool{"cpu": false, "mem": true}},
+	}
+	for _, c := range cases {
+		onlyHypertables, skipHypertables = parseHypertables(c.only), parseHypertables(c.skip)
+		for table, want := range c.want {
+			if got := hypertableSelected(table); got != want {
+				t.Errorf("%s: incorrect selection of %s: got %v want %v", c.desc, table, got, want)
+			}
+		}
+	}
+}
+
+func TestUnknownHypertables(t *testing.T) {
+	oldOnly, oldSkip := onlyHypertables, skipHypertables
+	defer func() { onlyHypertables, skipHypertables = oldOnly, oldSkip }()
+	onlyHypertables, skipHypertables = parseHypertables("mem,cpu,disk,net"), nil
+	got := unknownHypertables([]string{"cpu", "mem"})
+	if want := []string{"disk", "net"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect unknown hypertables: got %v want %v", got, want)
+	}
+	onlyHypertables = nil
+	if got := unknownHypertables([]string{"cpu", "mem"}); got != nil {
+		t.Errorf("unexpected unknown hypertables without a filter: %v", got)
+	}
+}
+
+func TestDecodeDropsUnselectedHypertables(t *testing.T) {
+	oldOnly, oldFiltered := onlyHypertables, filteredRows
+	defer func() { onlyHypertables, filteredRows = oldOnly, oldFiltered }()
+	onlyHypertables = parseHypertables("mem")
+	filteredRows = 0
+
+	input := "tags,host=a\ncpu,1,0.0\ntags,host=a\nmem,1,1.0\ntags,host=b\ncpu,2,0.0\ntags,host=b\nmem,2,2.0\n"
+	br := bufio.NewReader(strings.NewReader(input))
+	decoder := &decoder{scanner: bufio.NewScanner(br)}
+	var rows []uint64
+	for p := decoder.Decode(br); p != nil; p = decoder.Decode(br) {
+		data := p.Data.(*point)
+		if data.hypertable != "mem" {
+			t.Errorf("row of unselected hypertable %s not dropped", data.hypertable)
+		}
+		rows = append(rows, data.row.row)
+	}
+	// Rows are still numbered as in the input
+	if want := []uint64{2, 4}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("incorrect rows: got %v want %v", rows, want)
+	}
+	if got := atomic.LoadUint64(&filteredRows); got != 2 {
+		t.Errorf("incorrect dropped rows: got %d want 2", got)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Severities of logged messages, in increasing order, of which those below
+// -log-level are not logged
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// logLevel is the lowest severity of the messages logged
+var logLevel = levelInfo
+
+// parseLogLevel parses the name of a severity
+func parseLogLevel(s string) (int, error) {
+	for level, name := range levelNames {
+		if s == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// logf logs a message of the given severity, prefixed with it so that logs can
+// be filtered by it, e.g., 'WARN TimescaleDB version does not support retention policies'
+func logf(level int, format string, args ...interface{}) {
+	if level < logLevel {
+		return
+	}
+	log.Printf("%s %s", strings.ToUpper(levelNames[level]), fmt.Sprintf(format, args...))
+}
+
+func debugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(levelError, format, args...) }
+
+// exitOnError logs an error and exits with a non-zero status, after running
+// the functions registered with loader.OnExit, e.g., to flush -cpuprofile. It
+// is the default of fatal, which tests replace.
+func exitOnError(format string, args ...interface{}) {
+	errorf(format, args...)
+	if loader != nil {
+		loader.Exit(1)
+	}
+	os.Exit(1)
+}
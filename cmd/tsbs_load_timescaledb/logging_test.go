@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	cases := []struct {
+		in        string
+		want      int
+		shouldErr bool
+	}{
+		{in: "debug", want: levelDebug},
+		{in: "info", want: levelInfo},
+		{in: "warn", want: levelWarn},
+		{in: "error", want: levelError},
+		{in: "WARN", shouldErr: true},
+		{in: "fatal", shouldErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseLogLevel(c.in)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.in, err)
+		} else if got != c.want {
+			t.Errorf("%s: incorrect level: got %d want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLogf(t *testing.T) {
+	oldLogLevel, oldFlags := logLevel, log.Flags()
+	var b bytes.Buffer
+	log.SetOutput(&b)
+	log.SetFlags(0)
+	defer func() {
+		logLevel = oldLogLevel
+		log.SetOutput(os.Stderr)
+		log.SetFlags(oldFlags)
+	}()
+
+	logLevel = levelWarn
+	debugf("debug %d", 1)
+	infof("info %d", 2)
+	warnf("warn %d", 3)
+	errorf("error %d", 4)
+	if got, want := b.String(), "WARN warn 3\nERROR error 4\n"; got != want {
+		t.Errorf("incorrect log: got %q want %q", got, want)
+	}
+}
@@ -6,12 +6,15 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/timescale/tsbs/internal/utils"
@@ -19,62 +22,211 @@ import (
 )
 
 const (
-	timeValueIdx = "TIME-VALUE"
-	valueTimeIdx = "VALUE-TIME"
-	pgxDriver    = "pgx"
-	pqDriver     = "postgres"
+	timeValueIdx        = "TIME-VALUE"
+	valueTimeIdx        = "VALUE-TIME"
+	brinTimeIdx         = "BRIN-TIME"
+	brinValueIdx        = "BRIN-VALUE"
+	timeValueIncludeIdx = "TIME-VALUE-INCLUDE"
+	pgxDriver           = "pgx"
+	pqDriver            = "postgres"
+
+	insertStrategyCopy   = "copy"
+	insertStrategyInsert = "insert"
+
+	copyFormatBinary = "binary"
+	copyFormatText   = "text"
+
+	isolationReadCommitted  = "read-committed"
+	isolationRepeatableRead = "repeatable-read"
+	isolationSerializable   = "serializable"
+
+	resetDrop     = "drop"
+	resetTruncate = "truncate"
+
+	layoutWide   = "wide"
+	layoutNarrow = "narrow"
+
+	txPerBatch  = "batch"
+	txPerWorker = "worker"
+
+	partitioningHypertable = "hypertable"
+	partitioningNative     = "native"
+
+	missingExtensionFail     = "fail"
+	missingExtensionFallback = "fallback"
+
+	tagStorageColumns = "columns"
+	tagStorageJSONB   = "jsonb"
+
+	timeUnitNs      = "ns"
+	timeUnitUs      = "us"
+	timeUnitMs      = "ms"
+	timeUnitS       = "s"
+	timeUnitRFC3339 = "rfc3339"
+
+	timeColumnTimestamptz = "timestamptz"
+	timeColumnTimestamp   = "timestamp"
+	timeColumnBigint      = "bigint"
+
+	inputFormatCSV     = "csv"
+	inputFormatParquet = "parquet"
 )
 
 // Program option vars:
 var (
 	postgresConnect string
+	postgresHosts   []string
 	host            string
 	user            string
 	pass            string
 	port            string
 	connDB          string
 	driver          string // postgres or pgx
+	target          Loader // database-specific loading, chosen by -target
+	headerFile      string
+	startLine       uint64
+	strictColumns   bool
+	pgSchema        string
+
+	inputFormat       string
+	parquetHypertable string
+	// parquetIn is the input with -input-format=parquet, whose schema replaces
+	// the header
+	parquetIn parquetInput
+
+	sslMode     string
+	sslRootCert string
+	sslCert     string
+	sslKey      string
 
 	useHypertable bool
 	logBatches    bool
 	useJSON       bool
 	inTableTag    bool
 	hashWorkers   bool
+	ordered       bool
+	// hypertableAffinity is set with -hypertable-affinity
+	hypertableAffinity bool
+	// onMissingExtension is the -on-missing-extension policy
+	onMissingExtension string
 
-	numberPartitions int
-	chunkTime        time.Duration
+	numberPartitions      int
+	tablePartitions       map[string]int
+	partitionColumns      []string
+	checkPartitions       int
+	chunkTime             time.Duration
+	tableChunkTimes       map[string]time.Duration
+	timeColumn            string
+	tableTimeColumns      map[string]string
+	chunkTargetSize       string
+	distributed           bool
+	dataNodes             []string
+	replicationFactor     int
+	compressChunkInterval time.Duration
+	retention             time.Duration
+	continuousAggBucket   time.Duration
+	continuousAggFuncs    []string
 
 	timeIndex          bool
 	timePartitionIndex bool
 	partitionIndex     bool
 	fieldIndex         string
 	fieldIndexCount    int
+	indexFields        map[string]bool
+	indexInclude       map[string]bool
+	fieldTypes         map[string]string
+	inferTypes         bool
+
+	indexAfterLoad          bool
+	indexWorkers            int
+	createIndexConcurrently bool
 
 	profileFile          string
+	cpuProfile           string
+	memProfile           string
 	replicationStatsFile string
+	resultsDB            string
 
 	createMetricsTable bool
 	forceTextFormat    bool
+	copyFormat         string
 	tagColumnTypes     []string
+	insertStrategy     string
+	resetMode          string
+	layout             string
+	txPer              string
+	partitioning       string
+	unlogged           bool
+	preflight          bool
+	timeStart          time.Time
+	timeEnd            time.Time
+	onConflict         bool
+	copyFreeze         bool
+	copyFlushRows      int
+	// tableKey is the columns of the PRIMARY KEY or UNIQUE constraint, as
+	// given by tableKeyConstraint, of the data tables
+	tableKey           []string
+	tableKeyConstraint string
+
+	maxRetries   int
+	maxOpenConns int
+	maxIdleConns int
+	verify       bool
+	checksum     bool
+	dropOnFinish bool
+	sortBatch    bool
+	printDDL     bool
+	timeUnit     string
+	// timeColumnType is the type of the time column of the data tables
+	timeColumnType string
+	nullAs         string
+	delimiter      string
+
+	continueOnError bool
+	errorFile       string
+	topErrors       int
+	// rejectsFile is the file rows rejected by the database are written to,
+	// see -rejects-file
+	rejectsFile string
+	// maxReplicationLag, replicationLagQuery and replicationLagPostgres hold
+	// back the load while replicas lag, see -max-replication-lag
+	maxReplicationLag      time.Duration
+	replicationLagQuery    string
+	replicationLagPostgres string
+	// statementTimeout is set with -statement-timeout
+	statementTimeout time.Duration
+	// isolation is the isolation level of the batch transactions, see -isolation
+	isolation string
+	// onlyHypertables and skipHypertables select the hypertables to load, with
+	// -only-hypertables and -skip-hypertables
+	onlyHypertables map[string]bool
+	skipHypertables map[string]bool
 )
 
 type insertData struct {
 	tags   string
 	fields string
+	// row is the position of the row in the input, starting at 1
+	row uint64
+	// line is the line number of the row's values in its input file,
+	// counting the header
+	line uint64
 }
 
 // Global vars
 var loader *load.BenchmarkRunner
 
 // allows for testing
-var fatal = log.Fatalf
+var fatal = exitOnError
 
 // Parse args:
 func init() {
 	var config load.BenchmarkRunnerConfig
 	config.AddToFlagSet(pflag.CommandLine)
 
+	pflag.String("target", targetTimescaleDB, "Database to load into: 'timescaledb' or 'questdb' (over the PostgreSQL wire protocol)")
 	pflag.String("postgres", "sslmode=disable", "PostgreSQL connection string")
+	pflag.String("postgres-hosts", "", "Comma separated connection strings of hosts to shard the hypertables across, e.g., 'host=node1,host=node2 port=5433'. The schema is created on each host and all rows of a hypertable are loaded into the same host")
 	pflag.String("host", "localhost", "Hostname of TimescaleDB (PostgreSQL) instance")
 	pflag.String("port", "5432", "Which port to connect to on the database host")
 	pflag.String("user", "postgres", "User to connect to PostgreSQL as")
@@ -82,32 +234,118 @@ func init() {
 	pflag.String("admin-db-name", user, "Database to connect to in order to create additional benchmark databases.\n"+
 		"By default this is the same as the `user` (i.e., `postgres` if neither is set),\n"+
 		"but sometimes a user does not have its own database.")
+	pflag.String("pg-schema", "", "Schema to create the tables in and load into, instead of public (created if it does not exist)")
+	pflag.String("ssl-mode", "", "SSL mode to connect with (disable, allow, prefer, require, verify-ca, verify-full); overrides any sslmode in -postgres")
+	pflag.String("ssl-root-cert", "", "Path to the certificate authority certificate used to verify the server")
+	pflag.String("ssl-cert", "", "Path to the client SSL certificate")
+	pflag.String("ssl-key", "", "Path to the client SSL private key")
 
+	pflag.String("header-file", "", "File to read the schema header from, in which case the input contains only data rows")
+	pflag.String("input-format", inputFormatCSV, "Format of the input: 'csv' (the TimescaleDB data format, with its header) or 'parquet' (a -file whose schema gives the tags and fields; requires building with -tags parquet)")
+	pflag.String("only-hypertables", "", "Names of the only hypertables (comma delimited) to create and load, dropping the rows of the others from the input")
+	pflag.String("skip-hypertables", "", "Names of hypertables (comma delimited) not to create or load, dropping their rows from the input")
+	pflag.String("parquet-hypertable", "", "Hypertable to load the rows of a Parquet -file into (defaults to the file name without its extension)")
+	pflag.Uint64("start-line", 0, "Line of the input -file to resume loading from, e.g., as reported by an error; rows before it are skipped (0 for all rows)")
+	pflag.Bool("strict-columns", false, "Whether to check that each row has exactly one value per field of its hypertable in the header, exiting at the line of the first row that does not")
 	pflag.Bool("log-batches", false, "Whether to time individual batches.")
+	pflag.String("log-level", levelNames[levelInfo], "Lowest severity of the messages to log: 'debug', 'info', 'warn' or 'error'; messages are prefixed with their severity")
 
 	pflag.Bool("use-hypertable", true, "Whether to make the table a hypertable. Set this flag to false to check input write speed against regular PostgreSQL.")
+	pflag.String("on-missing-extension", missingExtensionFail, "What to do if the timescaledb extension is not available or cannot be created: 'fail' or 'fallback' (load into plain PostgreSQL tables as with -use-hypertable=false, with a warning)")
+	pflag.Bool("unlogged", false, "Whether to create the tables UNLOGGED, skipping the WAL, for an upper bound on insert throughput (requires -use-hypertable=false)")
 	pflag.Bool("use-jsonb-tags", false, "Whether tags should be stored as JSONB (instead of a separate table with schema)")
+	pflag.String("tag-storage", tagStorageColumns, "How to store the tags in the tags table: columns (one per tag) or jsonb (a single GIN indexed JSONB column, same as -use-jsonb-tags)")
 	pflag.Bool("in-table-partition-tag", false, "Whether the partition key (e.g. hostname) should also be in the metrics hypertable")
 	// TODO - This flag could potentially be done as a string/enum with other options besides no-hash, round-robin, etc
 	pflag.Bool("hash-workers", false, "Whether to consistently hash insert data to the same workers (i.e., the data for a particular host always goes to the same worker)")
+	pflag.Bool("hypertable-affinity", false, "Whether to send all the rows of each hypertable to the same worker, chosen by hashing its name, so that each connection writes to a stable subset of the hypertables")
+	pflag.Bool("ordered", false, "Whether to write rows in exactly the order of the input, using a single worker, so failing rows can be mapped to the input (slower)")
 
-	pflag.Int("partitions", 1, "Number of partitions")
-	pflag.Duration("chunk-time", 12*time.Hour, "Duration that each chunk should represent, e.g., 12h")
+	pflag.String("partitions", "1", "Number of partitions, for all hypertables (e.g., 4) or per hypertable with an optional default (e.g., 4,cpu=16,disk=2)")
+	pflag.String("partition-columns", "", "Tags (comma delimited) whose values are combined into a partition_key column used for space partitioning instead of tags_id")
+	pflag.Int("check-partitions", 0, "Number of rows per hypertable to sample before loading to warn if -partitions exceeds the distinct partitioning keys (0 to disable)")
+	pflag.String("chunk-time", "12h", "Duration that each chunk should represent, for all hypertables (e.g., 12h) or per hypertable with an optional default (e.g., 12h,cpu=1h,disk=24h)")
+	pflag.String("continuous-aggregate", "", "If set, create a continuous aggregate with a refresh policy on each hypertable: <bucket width>[:<function>,...], e.g., 1h:avg,max (functions default to avg)")
+	pflag.Bool("distributed", false, "Whether to create distributed hypertables on the data nodes of a multi-node TimescaleDB, loading through the access node given by -host")
+	pflag.String("data-nodes", "", "Data nodes (comma delimited) to distribute hypertables over with -distributed (default: all data nodes attached to the database)")
+	pflag.Int("replication-factor", 1, "Number of data nodes each chunk of a distributed hypertable is written to with -distributed")
+	pflag.Duration("retention", 0, "If set, add a retention policy to each hypertable that drops chunks older than this duration, e.g., 168h")
+	pflag.String("chunk-target-size", "", "Target size of hypertable chunks, e.g., 1GB, or 'estimate' to derive it from the server's memory, to adapt the chunk interval to as data is loaded, starting from -chunk-time (default: fixed intervals)")
+	pflag.Duration("compress-chunk-interval", 0, "If set, enable native compression on each hypertable and compress chunks older than this duration, e.g., 24h")
+	pflag.String("partitioning", partitioningHypertable, "How tables are partitioned by time: 'hypertable' (TimescaleDB) or 'native' (PostgreSQL declarative partitioning, with a partition per -chunk-time between -time-start and -time-end)")
+	pflag.String("time-start", "", "Start of the time range of the data (RFC3339), from which -partitioning=native creates partitions")
+	pflag.String("time-end", "", "End of the time range of the data (RFC3339), up to which -partitioning=native creates partitions")
 
 	pflag.Bool("time-index", true, "Whether to build an index on the time dimension")
 	pflag.Bool("time-partition-index", false, "Whether to build an index on the time dimension, compounded with partition")
 	pflag.Bool("partition-index", true, "Whether to build an index on the partition key")
 	pflag.String("field-index", valueTimeIdx, "index types for tags (comma delimited)")
 	pflag.Int("field-index-count", 0, "Number of indexed fields (-1 for all)")
+	pflag.String("index-fields", "", "Names of the fields (comma delimited) to index with -field-index, regardless of their position; overrides -field-index-count")
+	pflag.String("index-include", "", "Names of the fields (comma delimited) that TIME-VALUE-INCLUDE field indexes include (by default the indexed field)")
+	pflag.Bool("index-after-load", false, "Whether to create the hypertable indexes after the data is loaded instead of before")
+	pflag.Int("index-workers", 1, "Number of indexes to create in parallel, each on its own connection")
+	pflag.Bool("create-index-concurrently", false, "Whether indexes created after load should not block writes (CONCURRENTLY, or one transaction per chunk for hypertables)")
+	pflag.String("field-types", "", "Column types for fields (comma delimited <field>=<type>, e.g., usage_user=BIGINT; a trailing * matches a prefix). Other fields are DOUBLE PRECISION")
+	pflag.Bool("infer-types", false, "Whether to choose the column type of fields from their values in the first row of each table (BIGINT, DOUBLE PRECISION, BOOLEAN or TEXT). -field-types takes precedence")
 
 	pflag.String("write-profile", "", "File to output CPU/memory profile to")
+	pflag.String("cpuprofile", "", "File to write a pprof CPU profile of the loader to, covering the whole run")
+	pflag.String("memprofile", "", "File to write a pprof heap profile of the loader to at the end of the run")
 	pflag.String("write-replication-stats", "", "File to output replication stats to")
+	pflag.Duration("max-replication-lag", 0, "Replication lag above which reading the input is paused until the lag is back to half of it, measured every second with -replication-lag-query (0 to disable)")
+	pflag.String("replication-lag-query", defaultReplicationLagQuery, "Query returning the replication lag in seconds for -max-replication-lag (by default the replay lag of the most lagging replica, run on the primary)")
+	pflag.String("replication-lag-postgres", "", "PostgreSQL connect string of the database to run -replication-lag-query on, e.g., a replica (default: the benchmark database)")
+	pflag.String("results-db", "", "PostgreSQL connect string (e.g., 'host=localhost dbname=benchmarks') of a database to record the run's results in, in a tsbs_runs table created if absent (default: disabled)")
 	pflag.Bool("create-metrics-table", true, "Drops existing and creates new metrics table. Can be used for both regular and hypertable")
+	pflag.String("post-schema-sql", "", "File of SQL statements (separated by semicolons) to run in order after the schema is created and before loading, e.g., to set storage parameters")
+	pflag.String("layout", layoutWide, "Table layout: 'wide' (a column per field) or 'narrow' (a row per field value, with metric_name and value columns)")
+	pflag.String("reset", resetDrop, "How an existing database is reset: 'drop' (DROP DATABASE) or 'truncate' (TRUNCATE its tables, recreating those whose columns differ)")
 
 	pflag.Bool("force-text-format", false, "Send/receive data in text format")
+	pflag.String("copy-format", copyFormatBinary, "Format of the rows sent with COPY: 'binary' (encoded in Go with the pgx driver) or 'text' (same as -force-text-format)")
+	pflag.Int("copy-flush-rows", 0, "Number of rows of a hypertable's batch after which its COPY is ended and another started in the same transaction, to bound the driver's buffer (0 to copy the whole batch at once)")
+	pflag.Bool("copy-freeze", false, "Whether to COPY rows WITH (FREEZE), so the tables need no VACUUM to freeze them later (requires -force-text-format, -tx-per=worker, -workers=1 and -use-hypertable=false)")
+	pflag.String("insert-strategy", insertStrategyCopy, "How rows are written: 'copy' (COPY FROM) or 'insert' (multi-row INSERT with bound parameters)")
+
+	pflag.String("primary-key", "", "Columns (comma delimited, e.g., time,tags_id) of a PRIMARY KEY of the data tables; hypertables need time and the space partitioning column")
+	pflag.String("unique-key", "", "Columns (comma delimited) of a UNIQUE constraint of the data tables, like -primary-key but allowing NULLs")
+	pflag.Bool("on-conflict", false, "Skip rows whose time and tags already exist using INSERT ... ON CONFLICT DO NOTHING (implies -insert-strategy=insert; slower than COPY)")
+	pflag.String("delimiter", ",", "Character separating the values of each line of the input, e.g., '\\t' for tab-separated input")
+	pflag.String("null-as", "", "Field value that is loaded as NULL, like an empty value (e.g., NULL); must not be a number")
+	pflag.String("time-unit", timeUnitNs, "Format of the time column of the input: epoch in 'ns', 'us', 'ms' or 's', or 'rfc3339'")
+	pflag.String("time-column", defaultTimeColumn, "Name of the time column of the data tables, for all hypertables (e.g., ts) or per hypertable with an optional default (e.g., time,cpu=ts,disk=created_at)")
+	pflag.String("time-column-type", timeColumnTimestamptz, "Type of the time column of the data tables: 'timestamptz', 'timestamp' (UTC) or 'bigint' (nanoseconds since the epoch)")
+	pflag.Bool("preflight", true, "Whether to check that the database can be connected to and the user can create the database and hypertables before reading any input")
+	pflag.Bool("print-ddl", false, "Print the schema statements that would be executed to stdout and exit without connecting to the database")
+
+	pflag.Bool("verify", false, "After loading, check that the row count of each hypertable matches the rows that were loaded and exit with an error if not")
+	pflag.Bool("sort-batch", false, "Whether to sort the rows of each batch by time before writing them, for better chunk locality and compression at some CPU cost, which is reported at the end")
+	pflag.Bool("drop-on-finish", false, "Whether to drop the benchmark database once the load is done and the stats are printed, for throughput-only benchmarks")
+	pflag.Bool("checksum", false, "Print a checksum of the input rows processed, which is the same for loads of the same input regardless of how rows are spread across workers")
+
+	pflag.Int("max-open-conns", 0, "Maximum number of open connections in the pool shared by workers using -insert-strategy=insert and by verification queries (0 for unlimited)")
+	pflag.Int("max-idle-conns", 2, "Maximum number of idle connections kept in the shared pool")
+
+	pflag.Int("max-retries", 0, "Number of times to retry a failed batch insert, with exponential backoff starting at 100ms and capped at 30s, before exiting")
+	pflag.Bool("continue-on-error", false, "Whether to skip a batch that fails to insert (after any retries) instead of exiting")
+	pflag.String("isolation", isolationReadCommitted, "Isolation level of the transactions batches are written in: 'read-committed', 'repeatable-read' or 'serializable'")
+	pflag.Duration("statement-timeout", 0, "Time after which a statement loading a batch is canceled and the batch fails, to be retried or skipped with -max-retries and -continue-on-error (0 for no timeout)")
+	pflag.String("tx-per", txPerBatch, "Scope of the transactions rows are written in: 'batch' (committed per batch) or 'worker' (one transaction per worker, committed once it is done)")
+	pflag.String("error-file", "", "File to write the rows of skipped batches to, without the header (requires -continue-on-error)")
+	pflag.String("rejects-file", "", "File to write each row that fails to insert to, followed by its error, while the other rows of its batch are committed; rows are inserted one at a time (requires -insert-strategy=insert)")
+	pflag.Int("top-errors", 5, "Number of the most frequent classes of errors that batches were skipped for to print at the end of the load with -continue-on-error, logging only the first batch of each class (0 to log every batch)")
+
+	showVersion := pflag.Bool("version", false, "Print the version, git commit and Go version of the build and exit")
 
 	pflag.Parse()
 
+	// Exit before reading a config file, which may be missing
+	if *showVersion {
+		fmt.Printf("tsbs_load_timescaledb version %s\n", load.GetBuildInfo())
+		os.Exit(0)
+	}
+
 	err := utils.SetupConfigFile()
 
 	if err != nil {
@@ -117,42 +355,426 @@ func init() {
 	if err := viper.Unmarshal(&config); err != nil {
 		panic(fmt.Errorf("unable to decode config: %s", err))
 	}
+	logLevel, err = parseLogLevel(viper.GetString("log-level"))
+	if err != nil {
+		panic(fmt.Errorf("invalid log level: %s", err))
+	}
 
 	postgresConnect = viper.GetString("postgres")
+	postgresHosts, err = parsePostgresHosts(viper.GetString("postgres-hosts"))
+	if err != nil {
+		panic(fmt.Errorf("invalid postgres hosts: %s", err))
+	}
 	host = viper.GetString("host")
 	port = viper.GetString("port")
 	user = viper.GetString("user")
 	pass = viper.GetString("pass")
 	connDB = viper.GetString("admin-db-name")
+	pgSchema = viper.GetString("pg-schema")
+	sslMode = viper.GetString("ssl-mode")
+	switch sslMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		panic(fmt.Sprintf("unknown ssl mode '%s'", sslMode))
+	}
+	sslRootCert = viper.GetString("ssl-root-cert")
+	sslCert = viper.GetString("ssl-cert")
+	sslKey = viper.GetString("ssl-key")
+	headerFile = viper.GetString("header-file")
+	startLine = viper.GetUint64("start-line")
+	strictColumns = viper.GetBool("strict-columns")
+	if startLine > 0 && (len(config.FileName) == 0 || len(config.FileNames) > 0) {
+		// Data generated again on STDIN may differ, and the rows of -files are read concurrently
+		panic("-start-line requires the input to be read from a single -file")
+	}
 	logBatches = viper.GetBool("log-batches")
 
 	useHypertable = viper.GetBool("use-hypertable")
 	useJSON = viper.GetBool("use-jsonb-tags")
+	switch tagStorage := viper.GetString("tag-storage"); tagStorage {
+	case tagStorageColumns:
+	case tagStorageJSONB:
+		useJSON = true
+	default:
+		panic(fmt.Sprintf("unknown tag storage '%s'", tagStorage))
+	}
 	inTableTag = viper.GetBool("in-table-partition-tag")
 	hashWorkers = viper.GetBool("hash-workers")
+	hypertableAffinity = viper.GetBool("hypertable-affinity")
+	if hypertableAffinity && hashWorkers {
+		panic("-hypertable-affinity cannot be used with -hash-workers")
+	}
+	ordered = viper.GetBool("ordered")
+	if ordered {
+		if hashWorkers || hypertableAffinity || len(config.FileNames) > 0 {
+			panic("-ordered cannot be used with -hash-workers, -hypertable-affinity or -files")
+		}
+		config.Workers = 1
+	}
 
-	numberPartitions = viper.GetInt("partitions")
-	chunkTime = viper.GetDuration("chunk-time")
+	numberPartitions, tablePartitions, err = parsePartitions(viper.GetString("partitions"))
+	if err != nil {
+		panic(fmt.Errorf("invalid partitions: %s", err))
+	}
+	checkPartitions = viper.GetInt("check-partitions")
+	if pc := viper.GetString("partition-columns"); len(pc) > 0 {
+		partitionColumns = strings.Split(pc, ",")
+	}
+	chunkTime, tableChunkTimes, err = parseChunkTimes(viper.GetString("chunk-time"))
+	if err != nil {
+		panic(fmt.Errorf("invalid chunk time: %s", err))
+	}
+	timeColumn, tableTimeColumns, err = parseTimeColumns(viper.GetString("time-column"))
+	if err != nil {
+		panic(fmt.Errorf("invalid time column: %s", err))
+	}
+	chunkTargetSize, err = parseChunkTargetSize(viper.GetString("chunk-target-size"))
+	if err != nil {
+		panic(fmt.Errorf("invalid chunk target size: %s", err))
+	}
+	compressChunkInterval = viper.GetDuration("compress-chunk-interval")
+	retention = viper.GetDuration("retention")
+	if ca := viper.GetString("continuous-aggregate"); len(ca) > 0 {
+		continuousAggBucket, continuousAggFuncs, err = parseContinuousAggregate(ca)
+		if err != nil {
+			panic(fmt.Errorf("invalid continuous aggregate: %s", err))
+		}
+	}
 
 	timeIndex = viper.GetBool("time-index")
 	timePartitionIndex = viper.GetBool("time-partition-index")
 	partitionIndex = viper.GetBool("partition-index")
 	fieldIndex = viper.GetString("field-index")
 	fieldIndexCount = viper.GetInt("field-index-count")
+	if f := viper.GetString("index-fields"); len(f) > 0 {
+		indexFields = make(map[string]bool)
+		for _, field := range strings.Split(f, ",") {
+			indexFields[strings.TrimSpace(field)] = true
+		}
+		if fieldIndexCount != 0 {
+			warnf("-index-fields overrides -field-index-count=%d", fieldIndexCount)
+		}
+	}
+	if f := viper.GetString("index-include"); len(f) > 0 {
+		indexInclude = make(map[string]bool)
+		for _, field := range strings.Split(f, ",") {
+			indexInclude[strings.TrimSpace(field)] = true
+		}
+		if !strings.Contains(fieldIndex, timeValueIncludeIdx) {
+			warnf("-index-include has no effect without -field-index=%s", timeValueIncludeIdx)
+		}
+	}
+	if f := viper.GetString("post-schema-sql"); len(f) > 0 {
+		postSchemaSQL, err = readPostSchemaSQL(f)
+		if err != nil {
+			panic(fmt.Sprintf("cannot read -post-schema-sql: %v", err))
+		}
+	}
+	indexAfterLoad = viper.GetBool("index-after-load")
+	indexWorkers = viper.GetInt("index-workers")
+	createIndexConcurrently = viper.GetBool("create-index-concurrently")
+	fieldTypes, err = parseFieldTypes(viper.GetString("field-types"))
+	if err != nil {
+		panic(fmt.Errorf("invalid field types: %s", err))
+	}
+	inferTypes = viper.GetBool("infer-types")
+
+	partitioning = viper.GetString("partitioning")
+	switch partitioning {
+	case partitioningHypertable:
+	case partitioningNative:
+		if compressChunkInterval > 0 || retention > 0 || continuousAggBucket > 0 || createIndexConcurrently || len(chunkTargetSize) > 0 {
+			panic("-compress-chunk-interval, -retention, -continuous-aggregate, -create-index-concurrently and -chunk-target-size are not supported with -partitioning=native")
+		}
+		// The partitioned tables take the place of hypertables
+		useHypertable = false
+		timeStart, timeEnd, err = parseTimeRange(viper.GetString("time-start"), viper.GetString("time-end"))
+		if err != nil {
+			panic(fmt.Errorf("invalid time range for -partitioning=native: %s", err))
+		}
+		chunkTimes := []time.Duration{chunkTime}
+		for _, ct := range tableChunkTimes {
+			chunkTimes = append(chunkTimes, ct)
+		}
+		for _, ct := range chunkTimes {
+			if _, err := nativePartitionBounds(timeStart, timeEnd, ct); err != nil {
+				panic(fmt.Errorf("invalid chunk time for -partitioning=native: %s", err))
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unknown partitioning '%s'", partitioning))
+	}
+
+	// Checked after -partitioning, which clears useHypertable
+	unlogged = viper.GetBool("unlogged")
+	if unlogged && (useHypertable || partitioning == partitioningNative) {
+		panic("-unlogged requires -use-hypertable=false: hypertables and partitioned tables cannot be unlogged")
+	}
+
+	tableKey, tableKeyConstraint, err = parseTableKey(viper.GetString("primary-key"), viper.GetString("unique-key"))
+	if err == nil && len(tableKey) > 0 && len(tableTimeColumns) > 0 {
+		// A key of the same columns cannot include each table's time column
+		err = fmt.Errorf("-primary-key and -unique-key are not supported with a per-hypertable -time-column")
+	}
+	if err == nil {
+		err = checkPartitionedKey(tableKey)
+	}
+	if err != nil {
+		panic(fmt.Errorf("invalid key: %s", err))
+	}
+
+	layout = viper.GetString("layout")
+	if layout != layoutWide && layout != layoutNarrow {
+		panic(fmt.Sprintf("unknown layout '%s'", layout))
+	}
+	if layout == layoutNarrow && (continuousAggBucket > 0 || len(fieldTypes) > 0 || inferTypes) {
+		panic("-continuous-aggregate, -field-types and -infer-types are not supported with -layout=narrow")
+	}
 
 	profileFile = viper.GetString("write-profile")
+	cpuProfile = viper.GetString("cpuprofile")
+	memProfile = viper.GetString("memprofile")
 	replicationStatsFile = viper.GetString("write-replication-stats")
+	resultsDB = viper.GetString("results-db")
+	maxReplicationLag = viper.GetDuration("max-replication-lag")
+	if maxReplicationLag < 0 {
+		panic("-max-replication-lag cannot be negative")
+	}
+	replicationLagQuery = viper.GetString("replication-lag-query")
+	replicationLagPostgres = viper.GetString("replication-lag-postgres")
 	createMetricsTable = viper.GetBool("create-metrics-table")
 
 	forceTextFormat = viper.GetBool("force-text-format")
+	copyFormat = viper.GetString("copy-format")
+	if copyFormat != copyFormatBinary && copyFormat != copyFormatText {
+		panic(fmt.Sprintf("unknown -copy-format '%s'", copyFormat))
+	}
+	if forceTextFormat {
+		copyFormat = copyFormatText
+	}
+	forceTextFormat = copyFormat == copyFormatText
+	insertStrategy = viper.GetString("insert-strategy")
+	if insertStrategy != insertStrategyCopy && insertStrategy != insertStrategyInsert {
+		panic(fmt.Sprintf("unknown insert strategy '%s'", insertStrategy))
+	}
+	onMissingExtension = viper.GetString("on-missing-extension")
+	if onMissingExtension != missingExtensionFail && onMissingExtension != missingExtensionFallback {
+		panic(fmt.Sprintf("unknown -on-missing-extension policy '%s'", onMissingExtension))
+	}
+	resetMode = viper.GetString("reset")
+	if resetMode != resetDrop && resetMode != resetTruncate {
+		panic(fmt.Sprintf("unknown reset mode '%s'", resetMode))
+	}
+	onConflict = viper.GetBool("on-conflict")
+	if onConflict {
+		// COPY cannot skip conflicting rows
+		insertStrategy = insertStrategyInsert
+	}
+
+	maxRetries = viper.GetInt("max-retries")
+	if maxRetries < 0 {
+		panic("-max-retries cannot be negative")
+	}
+	continueOnError = viper.GetBool("continue-on-error")
+	statementTimeout = viper.GetDuration("statement-timeout")
+	isolation = viper.GetString("isolation")
+	switch isolation {
+	case isolationReadCommitted, isolationRepeatableRead, isolationSerializable:
+	default:
+		panic(fmt.Sprintf("unknown isolation level '%s'", isolation))
+	}
+	if statementTimeout < 0 {
+		panic("-statement-timeout cannot be negative")
+	}
+	errorFile = viper.GetString("error-file")
+	if len(errorFile) > 0 && !continueOnError {
+		panic("-error-file requires -continue-on-error")
+	}
+	rejectsFile = viper.GetString("rejects-file")
+	topErrors = viper.GetInt("top-errors")
+	if topErrors < 0 {
+		panic("-top-errors cannot be negative")
+	}
+	txPer = viper.GetString("tx-per")
+	if txPer != txPerBatch && txPer != txPerWorker {
+		panic(fmt.Sprintf("unknown transaction scope '%s'", txPer))
+	}
+	if txPer == txPerWorker && (maxRetries > 0 || continueOnError) {
+		// A failed batch aborts the transaction of all of the worker's batches
+		panic("-max-retries and -continue-on-error are not supported with -tx-per=worker")
+	}
+	maxOpenConns = viper.GetInt("max-open-conns")
+	maxIdleConns = viper.GetInt("max-idle-conns")
+	verify = viper.GetBool("verify")
+	checksum = viper.GetBool("checksum")
+	dropOnFinish = viper.GetBool("drop-on-finish")
+	sortBatch = viper.GetBool("sort-batch")
+	if sortBatch && ordered {
+		panic("-sort-batch cannot be used with -ordered, which writes rows in input order")
+	}
+	printDDL = viper.GetBool("print-ddl")
+	preflight = viper.GetBool("preflight")
+	timeUnit = viper.GetString("time-unit")
+	switch timeUnit {
+	case timeUnitNs, timeUnitUs, timeUnitMs, timeUnitS, timeUnitRFC3339:
+	default:
+		panic(fmt.Sprintf("unknown time unit '%s'", timeUnit))
+	}
+	timeColumnType = viper.GetString("time-column-type")
+	switch timeColumnType {
+	case timeColumnTimestamptz, timeColumnTimestamp:
+	case timeColumnBigint:
+		// These need intervals, or an integer_now function for integer time
+		if compressChunkInterval > 0 || retention > 0 || continuousAggBucket > 0 || partitioning == partitioningNative {
+			panic("-compress-chunk-interval, -retention, -continuous-aggregate and -partitioning=native are not supported with -time-column-type=bigint")
+		}
+	default:
+		panic(fmt.Sprintf("unknown time column type '%s'", timeColumnType))
+	}
+	delimiter, err = parseDelimiter(viper.GetString("delimiter"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid delimiter: %v", err))
+	}
+	nullAs = viper.GetString("null-as")
+	if err := validateNullAs(nullAs); err != nil {
+		panic(fmt.Sprintf("invalid null-as: %v", err))
+	}
+	inputFormat = viper.GetString("input-format")
+	onlyHypertables = parseHypertables(viper.GetString("only-hypertables"))
+	skipHypertables = parseHypertables(viper.GetString("skip-hypertables"))
+	if onlyHypertables != nil && skipHypertables != nil {
+		panic("-only-hypertables and -skip-hypertables cannot both be set")
+	}
+	if (onlyHypertables != nil || skipHypertables != nil) && inputFormat == inputFormatParquet {
+		panic("-only-hypertables and -skip-hypertables are not supported with -input-format=parquet")
+	}
+	parquetHypertable = viper.GetString("parquet-hypertable")
+	switch inputFormat {
+	case inputFormatCSV:
+	case inputFormatParquet:
+		// The Parquet footer is at the end of the file, so it cannot be streamed
+		if len(config.FileName) == 0 || len(config.FileNames) > 0 {
+			panic("-input-format=parquet requires the input to be read from a single -file")
+		}
+		// These read the text of the input
+		if len(headerFile) > 0 || startLine > 0 || inferTypes || checkPartitions > 0 {
+			panic("-header-file, -start-line, -infer-types and -check-partitions are not supported with -input-format=parquet")
+		}
+		if len(parquetHypertable) == 0 {
+			base := filepath.Base(config.FileName)
+			parquetHypertable = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	default:
+		panic(fmt.Sprintf("unknown input format '%s'", inputFormat))
+	}
+
+	targetName := viper.GetString("target")
+	target, err = newLoader(targetName)
+	if err != nil {
+		panic(err)
+	}
+	if dropOnFinish && (!config.DoCreateDB || targetName == targetQuestDB) {
+		panic("-drop-on-finish cannot be used with -do-create-db=false, which loads into an existing database, or -target=questdb")
+	}
+	if targetName == targetQuestDB {
+		if useJSON || onConflict || !config.DoCreateDB || len(pgSchema) > 0 || resetMode == resetTruncate || txPer == txPerWorker || partitioning == partitioningNative || unlogged || len(tableKey) > 0 || timeColumnType != timeColumnTimestamptz || timeColumn != defaultTimeColumn || len(tableTimeColumns) > 0 {
+			panic("-use-jsonb-tags (-tag-storage=jsonb), -on-conflict, -do-create-db=false, -pg-schema, -reset=truncate, -tx-per=worker, -partitioning=native, -unlogged, -primary-key, -unique-key, -time-column and -time-column-type are not supported with -target=questdb")
+		}
+		// QuestDB does not support COPY
+		insertStrategy = insertStrategyInsert
+	}
+	if len(rejectsFile) > 0 && (insertStrategy != insertStrategyInsert || targetName == targetQuestDB || txPer == txPerWorker) {
+		// Rows are rolled back to a savepoint in the batch transaction
+		panic("-rejects-file requires -insert-strategy=insert, and is not supported with -target=questdb or -tx-per=worker")
+	}
+	if len(postgresHosts) > 0 {
+		if targetName == targetQuestDB || hashWorkers || hypertableAffinity || ordered || indexAfterLoad || verify || printDDL || len(replicationStatsFile) > 0 {
+			panic("-target=questdb, -hash-workers, -hypertable-affinity, -ordered, -index-after-load, -verify, -print-ddl and -write-replication-stats are not supported with -postgres-hosts")
+		}
+		if config.Workers%uint(len(postgresHosts)) != 0 {
+			panic(fmt.Sprintf("-workers (%d) must be a multiple of the number of -postgres-hosts (%d)", config.Workers, len(postgresHosts)))
+		}
+		hostSyncCSIs = make([]*syncCSI, len(postgresHosts))
+		for i := range hostSyncCSIs {
+			hostSyncCSIs[i] = newSyncCSI()
+		}
+	}
+
+	distributed = viper.GetBool("distributed")
+	if dn := viper.GetString("data-nodes"); len(dn) > 0 {
+		dataNodes = strings.Split(dn, ",")
+	}
+	replicationFactor = viper.GetInt("replication-factor")
+	if distributed {
+		if !useHypertable || targetName == targetQuestDB || len(postgresHosts) > 0 {
+			panic("-use-hypertable=false, -partitioning=native, -target=questdb and -postgres-hosts are not supported with -distributed")
+		}
+		if replicationFactor < 1 {
+			panic("-replication-factor must be at least 1")
+		}
+		if len(dataNodes) > 0 && replicationFactor > len(dataNodes) {
+			panic(fmt.Sprintf("-replication-factor (%d) cannot exceed the number of -data-nodes (%d)", replicationFactor, len(dataNodes)))
+		}
+	} else if len(dataNodes) > 0 || replicationFactor != 1 {
+		panic("-data-nodes and -replication-factor require -distributed")
+	}
+
+	if len(chunkTargetSize) > 0 && (!useHypertable || targetName == targetQuestDB) {
+		warnf("-chunk-target-size only applies to hypertables and is ignored")
+		chunkTargetSize = ""
+	}
+	copyFreeze = viper.GetBool("copy-freeze")
+	if copyFreeze && useHypertable {
+		// Rows are copied into the chunks, not the hypertable itself
+		warnf("-copy-freeze does not apply to hypertables and is ignored")
+		copyFreeze = false
+	}
+	if copyFreeze {
+		// COPY FREEZE needs the table to be created or truncated in the same
+		// transaction, so a single worker truncates the new tables in its
+		// transaction before copying into them
+		if !forceTextFormat || txPer != txPerWorker || config.Workers != 1 || insertStrategy != insertStrategyCopy {
+			panic("-copy-freeze requires -force-text-format, -tx-per=worker, -workers=1 and -insert-strategy=copy")
+		}
+		if !config.DoCreateDB || !createMetricsTable || partitioning == partitioningNative {
+			panic("-copy-freeze is not supported with -do-create-db=false, -create-metrics-table=false or -partitioning=native")
+		}
+	}
+	if copyFormat == copyFormatBinary && insertStrategy == insertStrategyCopy {
+		if err := checkBinaryCopyTypes(fieldTypes); err != nil {
+			panic(err.Error())
+		}
+	}
+	copyFlushRows = viper.GetInt("copy-flush-rows")
+	if copyFlushRows < 0 {
+		panic("-copy-flush-rows cannot be negative")
+	}
+	if copyFlushRows > 0 && insertStrategy != insertStrategyCopy {
+		panic("-copy-flush-rows requires -insert-strategy=copy (and is not supported with -on-conflict or -target=questdb)")
+	}
 
 	loader = load.GetBenchmarkRunner(config)
 }
 
-type benchmark struct{}
+type benchmark struct {
+	dbc *dbCreator
+}
 
 func (b *benchmark) GetPointDecoder(br *bufio.Reader) load.PointDecoder {
-	return &decoder{scanner: bufio.NewScanner(br)}
+	if parquetIn != nil {
+		return parquetIn
+	}
+	return &decoder{scanner: bufio.NewScanner(br), lines: b.dbc.inputHeaderLines(), startLine: startLine}
+}
+
+// SkipHeader discards the schema header of additional input files, since
+// the schema is only read from the first file. Input files have no header
+// when it is read from -header-file.
+func (b *benchmark) SkipHeader(br *bufio.Reader) {
+	if len(headerFile) > 0 {
+		return
+	}
+	(&dbCreator{}).readDataHeader(br)
 }
 
 func (b *benchmark) GetBatchFactory() load.BatchFactory {
@@ -160,9 +782,19 @@ func (b *benchmark) GetBatchFactory() load.BatchFactory {
 }
 
 func (b *benchmark) GetPointIndexer(maxPartitions uint) load.PointIndexer {
+	if len(postgresHosts) > 0 {
+		return &shardIndexer{partitions: maxPartitions, hosts: len(postgresHosts)}
+	}
 	if hashWorkers {
 		return &hostnameIndexer{partitions: maxPartitions}
 	}
+	if hypertableAffinity {
+		// The tags key holds the tag names rather than a hypertable
+		if tables := len(tableCols) - 1; tables > 0 && uint(tables) < maxPartitions {
+			warnf("only %d hypertables for %d workers; some workers stay idle with -hypertable-affinity", tables, maxPartitions)
+		}
+		return &hypertableIndexer{partitions: maxPartitions}
+	}
 	return &load.ConstantIndexer{}
 }
 
@@ -171,38 +803,180 @@ func (b *benchmark) GetProcessor() load.Processor {
 }
 
 func (b *benchmark) GetDBCreator() load.DBCreator {
-	return &dbCreator{
-		br:      loader.GetBufferedReader(),
-		connStr: getConnectString(),
-		connDB:  connDB,
+	if b.dbc == nil {
+		b.dbc = &dbCreator{
+			br:         loader.GetBufferedReader(),
+			headerFile: headerFile,
+			connStr:    getConnectString(),
+			connDB:     connDB,
+		}
 	}
+	return b.dbc
 }
 
 func main() {
+	// Profiles are also written when the load exits early on -timeout or an
+	// interrupt, which skips deferred calls
+	stopPprof := startPprof(cpuProfile, memProfile)
+	defer stopPprof()
+	loader.OnExit(stopPprof)
+
+	b := &benchmark{}
+	if inputFormat == inputFormatParquet {
+		var err error
+		parquetIn, err = newParquetInput(loader.FileName, parquetHypertable)
+		if err != nil {
+			fatal("cannot read Parquet file %s: %v", loader.FileName, err)
+		}
+	}
+	if printDDL {
+		dbc := b.GetDBCreator().(*dbCreator)
+		dbc.Init()
+		if err := dbc.PostCreateDB(loader.DatabaseName()); err != nil {
+			fatal("could not generate schema: %v", err)
+		}
+		dbc.createDeferredIndexes()
+		return
+	}
+
 	if forceTextFormat {
 		driver = pqDriver
 	} else {
 		driver = pgxDriver
 	}
+	// Before reading any input, so that it is not generated for nothing
+	if preflight && loader.DoLoad {
+		if err := b.GetDBCreator().(*dbCreator).runPreflight(); err != nil {
+			fatal("pre-flight check failed: %v", redactErr(err))
+		}
+	}
+
 	// If specified, generate a performance profile
 	if len(profileFile) > 0 {
 		go profileCPUAndMem(profileFile)
 	}
 
+	if len(errorFile) > 0 {
+		f, err := os.Create(errorFile)
+		if err != nil {
+			fatal("cannot create error file: %v", err)
+		}
+		// Unbuffered, so that no rows are lost if the load is interrupted
+		skipped.w = f
+		defer f.Close()
+	}
+
+	if len(rejectsFile) > 0 {
+		f, err := os.Create(rejectsFile)
+		if err != nil {
+			fatal("cannot create rejects file: %v", err)
+		}
+		rejects.w = f
+		defer f.Close()
+	}
+
 	var replicationStatsWaitGroup sync.WaitGroup
 	if len(replicationStatsFile) > 0 {
 		go OutputReplicationStats(getConnectString(), replicationStatsFile, &replicationStatsWaitGroup)
 	}
 
-	if hashWorkers {
-		loader.RunBenchmark(&benchmark{}, load.WorkerPerQueue)
+	// The DBCreator, which reads the header, is only used when loading, so
+	// otherwise read the header here for the input to start at the data rows
+	if !loader.DoLoad {
+		b.GetDBCreator().(*dbCreator).readHeader()
+	}
+
+	stopLagThrottle := func() {}
+	if maxReplicationLag > 0 && loader.DoLoad {
+		connStr := replicationLagPostgres
+		if len(connStr) == 0 {
+			connStr = getConnectString()
+		}
+		stopLagThrottle = startLagThrottle(connStr, replicationLagQuery, maxReplicationLag)
+	}
+
+	if hashWorkers || hypertableAffinity || len(postgresHosts) > 0 {
+		loader.RunBenchmark(b, load.WorkerPerQueue)
 	} else {
-		loader.RunBenchmark(&benchmark{}, load.SingleQueue)
+		loader.RunBenchmark(b, load.SingleQueue)
+	}
+	stopLagThrottle()
+
+	if b.dbc != nil {
+		target.Finish(b.dbc)
+	}
+
+	if continueOnError && loader.DoLoad {
+		batches, rows := skipped.counts()
+		loader.Reportf("skipped %d batches (%d rows) that failed to insert\n", batches, rows)
+		if topErrors > 0 {
+			classes, others := skipped.topErrors(topErrors)
+			for _, c := range classes {
+				loader.Reportf("  %d batches (%d rows) failed with: %s\n", c.batches, c.rows, c.msg)
+			}
+			if others > 0 {
+				loader.Reportf("  %d other classes of errors (see -top-errors)\n", others)
+			}
+		}
+	}
+
+	if layout == layoutNarrow && loader.DoLoad {
+		if n := skipped.nullRowCount(); n > 0 {
+			loader.Reportf("skipped %d rows whose field values are all NULL (-layout=narrow has no row to write for them)\n", n)
+		}
+	}
+
+	if len(rejectsFile) > 0 && loader.DoLoad {
+		loader.Reportf("rejected %d rows that failed to insert, written to %s\n", rejects.count(), rejectsFile)
+	}
+
+	if onlyHypertables != nil || skipHypertables != nil {
+		loader.Reportf("dropped %d rows of hypertables not selected with -only-hypertables or -skip-hypertables\n", atomic.LoadUint64(&filteredRows))
 	}
 
+	if onConflict && loader.DoLoad {
+		loader.Reportf("skipped %d duplicate rows (-on-conflict uses INSERT ... ON CONFLICT DO NOTHING, which loads slower than COPY)\n", duplicateRows.total())
+	}
+
+	if sortBatch && loader.DoLoad {
+		loader.Reportf("sorting batches by time took %v in total across workers (-sort-batch)\n", time.Duration(atomic.LoadInt64(&batchSortTime)))
+	}
+
+	if checksum {
+		loader.Reportf("checksum of the rows processed: %016x\n", atomic.LoadUint64(&loadChecksum))
+	}
+
+	if verify && loader.DoLoad && b.dbc != nil {
+		mismatches := b.dbc.verifyRowCounts()
+		for _, m := range mismatches {
+			loader.Reportf("verify: hypertable %s has %d rows, expected %d\n", m.table, m.got, m.want)
+		}
+		if len(mismatches) > 0 {
+			fatal("verify failed: %d hypertables have unexpected row counts", len(mismatches))
+		}
+		loader.Reportf("verify: all hypertable row counts match\n")
+	}
+
+	// The run is still reported if its results cannot be recorded
+	if r, ok := loader.Results(); ok && len(resultsDB) > 0 {
+		if err := recordResults(resultsDB, r); err != nil {
+			warnf("could not record the results in -results-db: %v", redactErr(err))
+		} else {
+			infof("recorded the results in %s (-results-db)", resultsTable)
+		}
+	}
+
+	closeSharedPool()
+
 	if len(replicationStatsFile) > 0 {
 		replicationStatsWaitGroup.Wait()
 	}
+
+	// Once every connection to the database is closed
+	if dropOnFinish && loader.DoLoad && b.dbc != nil {
+		b.dbc.dropDB(loader.DatabaseName())
+		infof("dropped database %s (-drop-on-finish)", loader.DatabaseName())
+	}
 }
 
 func getConnectString() string {
@@ -219,6 +993,12 @@ func getConnectString() string {
 	if len(pass) > 0 {
 		connectString = fmt.Sprintf("%s password=%s", connectString, pass)
 	}
+	connectString = addSSLOptions(connectString)
+	if len(pgSchema) > 0 {
+		// Unqualified names (e.g., in CREATE TABLE and COPY) then refer to
+		// -pg-schema, while the TimescaleDB functions are still found in public
+		connectString = fmt.Sprintf("%s search_path=%s", connectString, quoteConnValue(pq.QuoteIdentifier(pgSchema)+",public"))
+	}
 
 	if forceTextFormat {
 		// we assume we're using pq driver
@@ -227,3 +1007,33 @@ func getConnectString() string {
 
 	return connectString
 }
+
+// addSSLOptions appends the SSL settings given by flags to connectString. An
+// -ssl-mode replaces any sslmode already in the connection string.
+func addSSLOptions(connectString string) string {
+	if len(sslMode) > 0 {
+		re := regexp.MustCompile(`sslmode=\S*`)
+		connectString = strings.Join(strings.Fields(re.ReplaceAllString(connectString, "")), " ")
+		connectString = fmt.Sprintf("%s sslmode=%s", connectString, sslMode)
+	}
+	if len(sslRootCert) > 0 {
+		connectString = fmt.Sprintf("%s sslrootcert=%s", connectString, quoteConnValue(sslRootCert))
+	}
+	if len(sslCert) > 0 {
+		connectString = fmt.Sprintf("%s sslcert=%s", connectString, quoteConnValue(sslCert))
+	}
+	if len(sslKey) > 0 {
+		connectString = fmt.Sprintf("%s sslkey=%s", connectString, quoteConnValue(sslKey))
+	}
+	return connectString
+}
+
+// quoteConnValue quotes v for use as a value in a key=value connection
+// string if it contains spaces, quotes or backslashes, e.g., file paths.
+func quoteConnValue(v string) string {
+	if !strings.ContainsAny(v, " '\\") {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(v) + "'"
+}
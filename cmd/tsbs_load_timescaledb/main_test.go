@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -38,3 +39,72 @@ func TestGetConnectString(t *testing.T) {
 		}
 	}
 }
+
+func TestGetConnectStringSchema(t *testing.T) {
+	oldPGSchema := pgSchema
+	defer func() { pgSchema = oldPGSchema }()
+	host = "localhost"
+	user = "postgres"
+	postgresConnect = "sslmode=disable"
+	cases := []struct {
+		schema string
+		want   string
+	}{
+		{schema: "bench", want: `search_path="bench",public`},
+		{schema: "My Bench", want: `search_path='"My Bench",public'`},
+	}
+	for _, c := range cases {
+		pgSchema = c.schema
+		if cstr := getConnectString(); !strings.HasSuffix(cstr, " "+c.want) {
+			t.Errorf("%s: incorrect connect string: got %s want suffix %s", c.schema, cstr, c.want)
+		}
+	}
+}
+
+func TestAddSSLOptions(t *testing.T) {
+	cases := []struct {
+		desc     string
+		connStr  string
+		mode     string
+		rootCert string
+		cert     string
+		key      string
+		want     string
+	}{
+		{
+			desc:    "no ssl flags",
+			connStr: "host=localhost sslmode=disable",
+			want:    "host=localhost sslmode=disable",
+		},
+		{
+			desc:    "mode replaces existing sslmode",
+			connStr: "host=localhost sslmode=disable port=5432",
+			mode:    "require",
+			want:    "host=localhost port=5432 sslmode=require",
+		},
+		{
+			desc:     "all flags",
+			connStr:  "host=localhost",
+			mode:     "verify-full",
+			rootCert: "/etc/ssl/ca.pem",
+			cert:     "/etc/ssl/client.crt",
+			key:      "/etc/ssl/client.key",
+			want:     "host=localhost sslmode=verify-full sslrootcert=/etc/ssl/ca.pem sslcert=/etc/ssl/client.crt sslkey=/etc/ssl/client.key",
+		},
+		{
+			desc:     "paths needing quotes",
+			connStr:  "host=localhost",
+			rootCert: "/my certs/ca.pem",
+			key:      `/o'brien/client.key`,
+			want:     `host=localhost sslrootcert='/my certs/ca.pem' sslkey='/o\'brien/client.key'`,
+		},
+	}
+
+	for _, c := range cases {
+		sslMode, sslRootCert, sslCert, sslKey = c.mode, c.rootCert, c.cert, c.key
+		if got := addSSLOptions(c.connStr); got != c.want {
+			t.Errorf("%s: incorrect connect string: got %s want %s", c.desc, got, c.want)
+		}
+	}
+	sslMode, sslRootCert, sslCert, sslKey = "", "", "", ""
+}
@@ -0,0 +1,245 @@
+//go:build parquet
+// +build parquet
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/timescale/tsbs/load"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetReadRows is the number of rows read from each column at a time
+const parquetReadRows = 1000
+
+// parquetDecoder reads the rows of a Parquet file with a flat schema: a time
+// column, string columns that are tags, and numeric or boolean columns that
+// are the fields of a single hypertable
+type parquetDecoder struct {
+	file       source.ParquetFile
+	pr         *reader.ParquetReader
+	hypertable string
+	numCols    int
+	// timeCol, tagCols and fieldCols are the indexes of the time, tag and
+	// field columns among the columns of the file
+	timeCol    int
+	tagCols    []int
+	tagNames   []string
+	fieldCols  []int
+	fieldNames []string
+	types      map[string]string
+
+	// values holds the values read from each column, of which the row at pos
+	// is decoded next
+	values    [][]interface{}
+	pos       int
+	remaining int64
+	rows      uint64
+}
+
+// newParquetInput opens the Parquet file at path to load its rows into hypertable
+func newParquetInput(path, hypertable string) (parquetInput, error) {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	d := &parquetDecoder{file: file, pr: pr, hypertable: hypertable, remaining: pr.GetNumRows()}
+	if err := d.mapColumns(); err != nil {
+		pr.ReadStop()
+		file.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// mapColumns maps the columns of the file's schema to the time, tags and fields
+func (d *parquetDecoder) mapColumns() error {
+	d.timeCol = -1
+	d.types = make(map[string]string)
+	// The first element of the schema is its root
+	schema := d.pr.Footer.GetSchema()
+	for i, col := range schema[1:] {
+		// The reader renames the schema to Go identifiers, keeping the names
+		// in the file as the external names
+		name := d.pr.SchemaHandler.Infos[i+1].ExName
+		if col.GetNumChildren() > 0 || col.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+			return fmt.Errorf("column %s is nested or repeated; only flat schemas are supported", name)
+		}
+		if name == "time" {
+			if err := checkParquetTime(col); err != nil {
+				return err
+			}
+			d.timeCol = i
+			continue
+		}
+		switch col.GetType() {
+		case parquet.Type_BYTE_ARRAY:
+			d.tagCols = append(d.tagCols, i)
+			d.tagNames = append(d.tagNames, name)
+			continue
+		case parquet.Type_DOUBLE:
+		case parquet.Type_FLOAT:
+			d.types[name] = "REAL"
+		case parquet.Type_INT32:
+			d.types[name] = "INTEGER"
+		case parquet.Type_INT64:
+			d.types[name] = "BIGINT"
+		case parquet.Type_BOOLEAN:
+			d.types[name] = "BOOLEAN"
+		default:
+			return fmt.Errorf("column %s has unsupported type %s", name, col.GetType())
+		}
+		d.fieldCols = append(d.fieldCols, i)
+		d.fieldNames = append(d.fieldNames, name)
+	}
+	if d.timeCol < 0 {
+		return fmt.Errorf("schema has no time column")
+	}
+	d.numCols = len(schema) - 1
+	return nil
+}
+
+// checkParquetTime checks that the time column matches -time-unit
+func checkParquetTime(col *parquet.SchemaElement) error {
+	switch col.GetType() {
+	case parquet.Type_INT64:
+		if !col.IsSetConvertedType() {
+			if timeUnit == timeUnitRFC3339 {
+				return fmt.Errorf("time column is an integer; set -time-unit to its unit")
+			}
+			return nil
+		}
+		var unit string
+		switch col.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			unit = timeUnitMs
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			unit = timeUnitUs
+		default:
+			return fmt.Errorf("time column has unsupported type %s", col.GetConvertedType())
+		}
+		if timeUnit != unit {
+			return fmt.Errorf("time column is %s; use -time-unit=%s", col.GetConvertedType(), unit)
+		}
+	case parquet.Type_BYTE_ARRAY:
+		if timeUnit != timeUnitRFC3339 {
+			return fmt.Errorf("time column is a string; use -time-unit=%s", timeUnitRFC3339)
+		}
+	default:
+		return fmt.Errorf("time column has unsupported type %s", col.GetType())
+	}
+	return nil
+}
+
+func (d *parquetDecoder) header() (string, []string) {
+	tags := []string{tagsKey}
+	for _, name := range d.tagNames {
+		tags = append(tags, name+" string")
+	}
+	fields := append([]string{d.hypertable}, d.fieldNames...)
+	return strings.Join(tags, delimiter), []string{strings.Join(fields, delimiter)}
+}
+
+func (d *parquetDecoder) fieldTypes() map[string]map[string]string {
+	return map[string]map[string]string{d.hypertable: d.types}
+}
+
+// readValues reads the values of the next rows of each column, returning
+// false at the end of the file
+func (d *parquetDecoder) readValues() bool {
+	if d.remaining <= 0 {
+		return false
+	}
+	n := int64(parquetReadRows)
+	if n > d.remaining {
+		n = d.remaining
+	}
+	d.values = make([][]interface{}, d.numCols)
+	for i := range d.values {
+		values, _, _, err := d.pr.ReadColumnByIndex(int64(i), n)
+		if err != nil {
+			fatal("cannot read Parquet column %d: %v", i, err)
+			return false
+		}
+		if int64(len(values)) != n {
+			fatal("Parquet column %d has %d values after row %d, expected %d", i, len(values), d.rows, n)
+			return false
+		}
+		d.values[i] = values
+	}
+	d.remaining -= n
+	d.pos = 0
+	return true
+}
+
+func (d *parquetDecoder) Decode(_ *bufio.Reader) *load.Point {
+	if d.values == nil || d.pos == len(d.values[0]) {
+		if !d.readValues() {
+			d.pr.ReadStop()
+			d.file.Close()
+			return nil
+		}
+	}
+	d.rows++
+	tags := make([]string, len(d.tagCols))
+	for i, c := range d.tagCols {
+		v := parquetValue(d.values[c][d.pos])
+		if strings.Contains(v, delimiter) {
+			fatal("row %d: value '%s' of tag %s contains the delimiter", d.rows, v, d.tagNames[i])
+			return nil
+		}
+		tags[i] = d.tagNames[i] + "=" + v
+	}
+	fields := make([]string, 0, len(d.fieldCols)+1)
+	fields = append(fields, parquetValue(d.values[d.timeCol][d.pos]))
+	for _, c := range d.fieldCols {
+		fields = append(fields, parquetValue(d.values[c][d.pos]))
+	}
+	d.pos++
+
+	return load.NewPoint(&point{
+		hypertable: d.hypertable,
+		row: &insertData{
+			tags:   strings.Join(tags, delimiter),
+			fields: strings.Join(fields, delimiter),
+			row:    d.rows,
+			// The lines of the row in text input with -header-file
+			line: 2 * d.rows,
+		},
+	})
+}
+
+// parquetValue formats a value read from a Parquet column as in text input,
+// where NULL is empty
+func parquetValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !parquet
+// +build !parquet
+
+package main
+
+import "errors"
+
+// newParquetInput returns an error, since reading Parquet input requires the
+// loader to be built with the parquet build tag
+func newParquetInput(path, hypertable string) (parquetInput, error) {
+	return nil, errors.New("the loader was built without Parquet support; build it with -tags parquet")
+}
@@ -0,0 +1,114 @@
+//go:build parquet
+// +build parquet
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type parquetTestRow struct {
+	Time      int64    `parquet:"name=time, type=INT64"`
+	Hostname  string   `parquet:"name=hostname, type=UTF8"`
+	UsageUser float64  `parquet:"name=usage_user, type=DOUBLE"`
+	Region    string   `parquet:"name=region, type=UTF8"`
+	Count     *int64   `parquet:"name=count, type=INT64"`
+	Ratio     *float32 `parquet:"name=ratio, type=FLOAT"`
+}
+
+func writeParquetTestFile(t *testing.T, path string, rows []parquetTestRow) {
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		t.Fatalf("cannot create Parquet file: %v", err)
+	}
+	defer fw.Close()
+	pw, err := writer.NewParquetWriter(fw, new(parquetTestRow), 1)
+	if err != nil {
+		t.Fatalf("cannot create Parquet writer: %v", err)
+	}
+	for _, r := range rows {
+		if err := pw.Write(r); err != nil {
+			t.Fatalf("cannot write Parquet row: %v", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatalf("cannot finish Parquet file: %v", err)
+	}
+}
+
+func TestParquetInput(t *testing.T) {
+	oldDelimiter, oldTimeUnit := delimiter, timeUnit
+	defer func() { delimiter, timeUnit = oldDelimiter, oldTimeUnit }()
+	delimiter, timeUnit = ",", timeUnitNs
+
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cpu.parquet")
+	count := int64(7)
+	ratio := float32(0.5)
+	writeParquetTestFile(t, path, []parquetTestRow{
+		{Time: 1451606400000000000, Hostname: "host_0", UsageUser: 58.25, Region: "eu", Count: &count, Ratio: &ratio},
+		{Time: 1451606410000000000, Hostname: "host_1", UsageUser: 2, Region: "us"},
+	})
+
+	in, err := newParquetInput(path, "cpu")
+	if err != nil {
+		t.Fatalf("cannot open Parquet file: %v", err)
+	}
+	tags, cols := in.header()
+	if want := "tags,hostname string,region string"; tags != want {
+		t.Errorf("incorrect tags: got %s want %s", tags, want)
+	}
+	if want := []string{"cpu,usage_user,count,ratio"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("incorrect tables: got %v want %v", cols, want)
+	}
+	wantTypes := map[string]map[string]string{"cpu": {"count": "BIGINT", "ratio": "REAL"}}
+	if got := in.fieldTypes(); !reflect.DeepEqual(got, wantTypes) {
+		t.Errorf("incorrect field types: got %v want %v", got, wantTypes)
+	}
+
+	want := []insertData{
+		{tags: "hostname=host_0,region=eu", fields: "1451606400000000000,58.25,7,0.5", row: 1, line: 2},
+		{tags: "hostname=host_1,region=us", fields: "1451606410000000000,2,,", row: 2, line: 4},
+	}
+	for i, w := range want {
+		p := in.Decode(nil)
+		if p == nil {
+			t.Fatalf("row %d: expected a row but got none", i)
+		}
+		data := p.Data.(*point)
+		if data.hypertable != "cpu" || *data.row != w {
+			t.Errorf("row %d: incorrect row: got %s %+v want cpu %+v", i, data.hypertable, *data.row, w)
+		}
+	}
+	if p := in.Decode(nil); p != nil {
+		t.Errorf("expected no more rows but got %+v", *p.Data.(*point).row)
+	}
+}
+
+func TestParquetInputTimeUnit(t *testing.T) {
+	oldTimeUnit := timeUnit
+	defer func() { timeUnit = oldTimeUnit }()
+	timeUnit = timeUnitRFC3339
+
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cpu.parquet")
+	writeParquetTestFile(t, path, []parquetTestRow{{Time: 1, Hostname: "host_0"}})
+	if _, err := newParquetInput(path, "cpu"); err == nil {
+		t.Errorf("expected error for an integer time column with -time-unit=%s but got none", timeUnit)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// postSchemaSQL are the statements of -post-schema-sql, run after the schema
+// is created
+var postSchemaSQL []string
+
+// readPostSchemaSQL returns the statements of the SQL script fileName
+func readPostSchemaSQL(fileName string) ([]string, error) {
+	script, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return splitStatements(string(script)), nil
+}
+
+// dollarQuoteRe matches the tag opening a dollar-quoted string, e.g., $$ or $body$
+var dollarQuoteRe = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// splitStatements splits script into its SQL statements on the semicolons that
+// are not within quotes, dollar quotes or comments. Statements holding nothing
+// but comments are left out.
+func splitStatements(script string) []string {
+	var stmts []string
+	start := 0
+	hasCode := false
+	// skipTo returns the position of the last byte of the first end in script
+	// from from on, or the end of script if there is none
+	skipTo := func(from int, end string) int {
+		if j := strings.Index(script[from:], end); j >= 0 {
+			return from + j + len(end) - 1
+		}
+		return len(script)
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipTo(i, "\n")
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipTo(i+2, "*/")
+		case c == '\'' || c == '"':
+			hasCode = true
+			i = skipTo(i+1, string(c))
+		case c == '$' && dollarQuoteRe.MatchString(script[i:]):
+			hasCode = true
+			tag := dollarQuoteRe.FindString(script[i:])
+			i = skipTo(i+len(tag), tag)
+		case c == ';':
+			if hasCode {
+				stmts = append(stmts, strings.TrimSpace(script[start:i]))
+			}
+			start, hasCode = i+1, false
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			hasCode = true
+		}
+	}
+	if hasCode {
+		stmts = append(stmts, strings.TrimSpace(script[start:]))
+	}
+	return stmts
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		desc   string
+		script string
+		want   []string
+	}{
+		{desc: "empty"},
+		{
+			desc:   "statements",
+			script: "ALTER TABLE cpu SET (fillfactor = 90);\nALTER TABLE cpu ALTER COLUMN usage_user SET STATISTICS 1000;\n",
+			want:   []string{"ALTER TABLE cpu SET (fillfactor = 90)", "ALTER TABLE cpu ALTER COLUMN usage_user SET STATISTICS 1000"},
+		},
+		{
+			desc:   "no trailing semicolon",
+			script: "ANALYZE cpu; ANALYZE mem",
+			want:   []string{"ANALYZE cpu", "ANALYZE mem"},
+		},
+		{
+			desc:   "quotes",
+			script: `COMMENT ON TABLE cpu IS 'a;b''c'; SELECT 1 AS "x;y"`,
+			want:   []string{`COMMENT ON TABLE cpu IS 'a;b''c'`, `SELECT 1 AS "x;y"`},
+		},
+		{
+			desc:   "dollar quotes",
+			script: "DO $body$ BEGIN PERFORM 1; END $body$; DO $$ BEGIN NULL; END $$;",
+			want:   []string{"DO $body$ BEGIN PERFORM 1; END $body$", "DO $$ BEGIN NULL; END $$"},
+		},
+		{
+			desc:   "comments",
+			script: "-- tweaks; for cpu\nANALYZE cpu; /* done; */\n-- trailing;\n",
+			want:   []string{"-- tweaks; for cpu\nANALYZE cpu"},
+		},
+		{
+			desc:   "empty statements",
+			script: ";; ANALYZE cpu;;",
+			want:   []string{"ANALYZE cpu"},
+		},
+	}
+	for _, c := range cases {
+		if got := splitStatements(c.script); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect statements: got %q want %q", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestReadPostSchemaSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postschema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "tweaks.sql")
+	if err := ioutil.WriteFile(fileName, []byte("ANALYZE cpu;\nANALYZE mem;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readPostSchemaSQL(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"ANALYZE cpu", "ANALYZE mem"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect statements: got %q want %q", got, want)
+	}
+	if _, err := readPostSchemaSQL(filepath.Join(dir, "missing.sql")); err == nil {
+		t.Errorf("expected error for a missing file but got none")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// runPreflight checks that the database can be connected to, and that the user
+// can create the benchmark database and hypertables, before any input is
+// read. A misconfiguration is then reported before the data is generated
+// into the loader's input rather than at the first batch.
+func (d *dbCreator) runPreflight() error {
+	// Without -do-create-db, the benchmark database must already exist
+	connStrs := benchConnectStrings()
+	if loader.DoCreateDB && target.HasDatabases() {
+		d.initConnectString()
+		connStrs = d.adminConnStrs()
+	}
+	for i, connStr := range connStrs {
+		if err := preflightHost(connStr); err != nil {
+			if len(postgresHosts) > 0 {
+				return fmt.Errorf("host '%s': %v", postgresHosts[i], err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// preflightHost runs the pre-flight checks against the database at connStr
+func preflightHost(connStr string) error {
+	db, err := sql.Open(driver, connStr)
+	if err != nil {
+		return fmt.Errorf("invalid connection settings: %v; check -postgres", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("cannot connect to %s as user %s: %v; check -host, -port, -user, -pass and -postgres", host, user, err)
+	}
+	if !target.HasDatabases() {
+		return nil
+	}
+
+	if loader.DoCreateDB {
+		var canCreate bool
+		err := db.QueryRow("SELECT rolcreatedb OR rolsuper FROM pg_roles WHERE rolname = current_user").Scan(&canCreate)
+		if err != nil {
+			return fmt.Errorf("cannot check the privileges of user %s: %v", user, err)
+		}
+		if !canCreate {
+			return fmt.Errorf("user %s cannot create databases; grant it CREATEDB, or create database %s beforehand and use -do-create-db=false", user, loader.DatabaseName())
+		}
+	}
+
+	if useHypertable {
+		var available bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").Scan(&available)
+		if err != nil {
+			return fmt.Errorf("cannot check for the timescaledb extension: %v", err)
+		}
+		if !available {
+			return missingExtension("the timescaledb extension is not installed on the server", "install it")
+		}
+		// Only superusers and members of pg_read_all_settings may read the
+		// setting, so it is only checked if it can be
+		var preload string
+		if err := db.QueryRow("SHOW shared_preload_libraries").Scan(&preload); err == nil && !strings.Contains(preload, "timescaledb") {
+			return missingExtension("timescaledb is not in shared_preload_libraries of the server", "add it to postgresql.conf and restart the server")
+		}
+	}
+	return nil
+}
+
+// missingExtension handles the timescaledb extension being unavailable for
+// cause according to -on-missing-extension: an error suggesting fix is
+// returned with 'fail', while with 'fallback' a warning is logged and the
+// tables are created as plain PostgreSQL tables instead of hypertables.
+func missingExtension(cause, fix string) error {
+	if onMissingExtension == missingExtensionFallback && !distributed {
+		warnf("%s; falling back to plain PostgreSQL tables as with -use-hypertable=false", cause)
+		useHypertable = false
+		return nil
+	}
+	return fmt.Errorf("%s; %s, or use -use-hypertable=false or -on-missing-extension=fallback", cause, fix)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestMissingExtension(t *testing.T) {
+	oldPolicy, oldUseHypertable, oldDistributed := onMissingExtension, useHypertable, distributed
+	defer func() {
+		onMissingExtension, useHypertable, distributed = oldPolicy, oldUseHypertable, oldDistributed
+	}()
+	cases := []struct {
+		policy            string
+		distributed       bool
+		wantErr           bool
+		wantUseHypertable bool
+	}{
+		{policy: missingExtensionFail, wantErr: true, wantUseHypertable: true},
+		{policy: missingExtensionFallback, wantUseHypertable: false},
+		{policy: missingExtensionFallback, distributed: true, wantErr: true, wantUseHypertable: true},
+	}
+	for _, c := range cases {
+		onMissingExtension, useHypertable, distributed = c.policy, true, c.distributed
+		err := missingExtension("the timescaledb extension is not installed on the server", "install it")
+		if c.wantErr && err == nil {
+			t.Errorf("%s (distributed %v): expected error but got none", c.policy, c.distributed)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s (distributed %v): unexpected error: %v", c.policy, c.distributed, err)
+		}
+		if useHypertable != c.wantUseHypertable {
+			t.Errorf("%s (distributed %v): incorrect use of hypertables: got %v want %v", c.policy, c.distributed, useHypertable, c.wantUseHypertable)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +19,13 @@ import (
 const (
 	insertCSI    = `INSERT INTO %s(time,tags_id,%s%s,additional_tags) VALUES %s`
 	numExtraCols = 2 // one for json, one for tags_id
+
+	insertValues      = `INSERT INTO %s(%s) VALUES %s`
+	maxBindParams     = 65535 // PostgreSQL limit on bound parameters per statement
+	onConflictNothing = ` ON CONFLICT (tags_id, %s) DO NOTHING`
+
+	retryBackoffBase = 100 * time.Millisecond
+	retryBackoffMax  = 30 * time.Second
 )
 
 type syncCSI struct {
@@ -73,49 +79,88 @@ func insertTags(db *sql.DB, tagRows [][]string, returnResults bool) map[string]i
 			values = append(values, row)
 		}
 	}
-	tx := MustBegin(db)
+	ctx := loader.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The load timed out; its batches are aborted as well
+			return nil
+		}
+		fatal("could not insert tags: %v", redactErr(err))
+		return nil
+	}
 	defer tx.Commit()
-	res, err := tx.Query(fmt.Sprintf(`INSERT INTO tags(%s) VALUES %s ON CONFLICT DO NOTHING RETURNING *`, strings.Join(cols, ","), strings.Join(values, ",")))
+	res, err := tx.QueryContext(ctx, fmt.Sprintf(`INSERT INTO tags(%s) VALUES %s ON CONFLICT DO NOTHING RETURNING *`, strings.Join(quoteIdentifiers(cols), ","), strings.Join(values, ",")))
 	if err != nil {
-		panic(err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		fatal("could not insert tags: %v", redactErr(err))
+		return nil
 	}
 
 	// Results will be used to make a Golang index for faster inserts
 	if returnResults {
-		resCols, _ := res.Columns()
-		resVals := make([]interface{}, len(resCols))
-		resValsPtrs := make([]interface{}, len(resCols))
-		for i := range resVals {
-			resValsPtrs[i] = &resVals[i]
-		}
-		ret := make(map[string]int64)
-		for res.Next() {
-			err = res.Scan(resValsPtrs...)
-			if err != nil {
-				panic(err)
-			}
+		return scanTagIDs(res)
+	}
+	return nil
+}
 
-			var key string
-			if useJSON {
-				decodedTagset := map[string]string{}
-				json.Unmarshal(resVals[1].([]byte), &decodedTagset)
-				key = decodedTagset[tagCols[0]]
-			} else {
-				key = fmt.Sprintf("%v", resVals[1])
-			}
-			ret[key] = resVals[0].(int64)
+// scanTagIDs reads rows of the tags table from res, returning a map from the
+// primary tag value to the row's id.
+func scanTagIDs(res *sql.Rows) map[string]int64 {
+	defer res.Close()
+	tagCols := tableCols[tagsKey]
+	resCols, _ := res.Columns()
+	resVals := make([]interface{}, len(resCols))
+	resValsPtrs := make([]interface{}, len(resCols))
+	for i := range resVals {
+		resValsPtrs[i] = &resVals[i]
+	}
+	ret := make(map[string]int64)
+	for res.Next() {
+		err := res.Scan(resValsPtrs...)
+		if err != nil {
+			fatal("could not read tag ids: %v", err)
+			return nil
+		}
+
+		var key string
+		if useJSON {
+			decodedTagset := map[string]string{}
+			json.Unmarshal(resVals[1].([]byte), &decodedTagset)
+			key = decodedTagset[tagCols[0]]
+		} else {
+			key = fmt.Sprintf("%v", resVals[1])
 		}
-		res.Close()
-		return ret
+		ret[key] = resVals[0].(int64)
 	}
-	return nil
+	return ret
+}
+
+// loadExistingTags adds the ids of tags already in the tags table to csi, so
+// rows appended to existing tables reference them instead of NULL.
+func loadExistingTags(db *sql.DB, csi *syncCSI) {
+	cols := strings.Join(quoteIdentifiers(tableCols[tagsKey]), ",")
+	if useJSON {
+		cols = "tagset"
+	}
+	res := MustQuery(db, fmt.Sprintf("SELECT id, %s FROM tags", cols))
+	existing := scanTagIDs(res)
+	csi.mutex.Lock()
+	for k, v := range existing {
+		csi.m[k] = v
+	}
+	csi.mutex.Unlock()
 }
 
 // splitTagsAndMetrics takes an array of insertData (sharded by hypertable) and
 // divides the tags from data into appropriate slices that can then be used in
 // SQL queries to insert into their respective tables. Additionally, it also
 // returns the number of metrics (i.e., non-tag fields) for the data processed.
-func splitTagsAndMetrics(rows []*insertData, dataCols int) ([][]string, [][]interface{}, uint64) {
+// Fields marked in rawFields are kept as strings rather than parsed as floats,
+// leaving it to the database to parse them for their column type.
+func splitTagsAndMetrics(rows []*insertData, dataCols int, rawFields []bool) ([][]string, [][]interface{}, uint64) {
 	tagRows := make([][]string, 0, len(rows))
 	dataRows := make([][]interface{}, 0, len(rows))
 	numMetrics := uint64(0)
@@ -126,24 +171,33 @@ func splitTagsAndMetrics(rows []*insertData, dataCols int) ([][]string, [][]inte
 		// for non-common tags that need to be added separately. For each of
 		// the common tags, remove everything before = in the form <label>=<val>
 		// since we won't need it.
-		tags := strings.SplitN(data.tags, ",", commonTagsLen+1)
+		tags := strings.SplitN(data.tags, delimiter, commonTagsLen+1)
+		if len(tags) < commonTagsLen {
+			fatal("input line %d has %d tags, expected at least %d: %s", data.line-1, len(tags), commonTagsLen, data.tags)
+			return nil, nil, 0
+		}
 		for i := 0; i < commonTagsLen; i++ {
-			tags[i] = strings.Split(tags[i], "=")[1]
+			kv := strings.SplitN(tags[i], "=", 2)
+			if len(kv) != 2 {
+				fatal("input line %d, column %d: tag '%s' is not in the form <label>=<value>", data.line-1, i+2, tags[i])
+				return nil, nil, 0
+			}
+			tags[i] = kv[1]
 		}
 
 		var json interface{}
 		if len(tags) > commonTagsLen {
-			json = subsystemTagsToJSON(strings.Split(tags[commonTagsLen], ","))
+			json = subsystemTagsToJSON(strings.Split(tags[commonTagsLen], delimiter))
 		}
 
-		metrics := strings.Split(data.fields, ",")
+		metrics := strings.Split(data.fields, delimiter)
 		numMetrics += uint64(len(metrics) - 1) // 1 field is timestamp
 
-		timeInt, err := strconv.ParseInt(metrics[0], 10, 64)
+		ts, err := parseTime(metrics[0])
 		if err != nil {
-			panic(err)
+			fatal("input line %d, column 2: invalid timestamp: %v", data.line, err)
+			return nil, nil, 0
 		}
-		ts := time.Unix(0, timeInt)
 
 		// use nil at 2nd position as placeholder for tagKey
 		r := make([]interface{}, 3, dataCols)
@@ -151,15 +205,24 @@ func splitTagsAndMetrics(rows []*insertData, dataCols int) ([][]string, [][]inte
 		if inTableTag {
 			r = append(r, tags[0])
 		}
-		for _, v := range metrics[1:] {
-			if v == "" {
+		if len(partitionColumnIdx) > 0 {
+			r = append(r, partitionKey(tags))
+		}
+		for i, v := range metrics[1:] {
+			if v == "" || v == nullAs {
 				r = append(r, nil)
 				continue
 			}
+			if i < len(rawFields) && rawFields[i] {
+				r = append(r, v)
+				continue
+			}
 
 			num, err := strconv.ParseFloat(v, 64)
 			if err != nil {
-				panic(err)
+				// Columns count from 1, with the hypertable and time first
+				fatal("input line %d, column %d: invalid value '%s': %v", data.line, i+3, v, err)
+				return nil, nil, 0
 			}
 
 			r = append(r, num)
@@ -172,12 +235,118 @@ func splitTagsAndMetrics(rows []*insertData, dataCols int) ([][]string, [][]inte
 	return tagRows, dataRows, numMetrics
 }
 
-func (p *processor) processCSI(hypertable string, rows []*insertData) uint64 {
+// unpivot turns each of dataRows, whose values after the first prefixLen are
+// the given fields, into a row per non-NULL field value holding the first
+// prefixLen values followed by the field name and value, for -layout=narrow.
+// It also returns the row of rows that each unpivoted row comes from, and the
+// number of rows with no non-NULL field value, which have no unpivoted row.
+func unpivot(rows []*insertData, dataRows [][]interface{}, fields []string, prefixLen int) ([][]interface{}, []*insertData, int) {
+	narrowRows := make([][]interface{}, 0, len(dataRows)*len(fields))
+	sources := make([]*insertData, 0, cap(narrowRows))
+	nullRows := 0
+	for i, r := range dataRows {
+		before := len(narrowRows)
+		for j, v := range r[prefixLen:] {
+			if v == nil {
+				continue
+			}
+			nr := make([]interface{}, prefixLen, prefixLen+2)
+			copy(nr, r[:prefixLen])
+			narrowRows = append(narrowRows, append(nr, fields[j], v))
+			sources = append(sources, rows[i])
+		}
+		if len(narrowRows) == before {
+			nullRows++
+		}
+	}
+	return narrowRows, sources, nullRows
+}
+
+// validateNullAs checks that the -null-as marker cannot be mistaken for a
+// field value: it must not be a number, which would be loaded as NULL
+// instead of its value, nor contain the delimiter, which separates fields.
+func validateNullAs(marker string) error {
+	if len(marker) == 0 {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(marker, 64); err == nil {
+		return fmt.Errorf("'%s' is a number and would collide with field values", marker)
+	}
+	if strings.ContainsAny(marker, delimiter+"\n") {
+		return fmt.Errorf("'%s' contains a field or row separator", marker)
+	}
+	return nil
+}
+
+// partitionKey returns the value of the partition key column for a row with
+// the given common tag values: the -partition-columns tags joined by commas.
+// TimescaleDB hashes it to pick the space partition.
+func partitionKey(tags []string) string {
+	vals := make([]string, len(partitionColumnIdx))
+	for i, idx := range partitionColumnIdx {
+		vals[i] = tags[idx]
+	}
+	return strings.Join(vals, ",")
+}
+
+// parseTime converts the value of the time column to a value that can be
+// inserted into the time column, according to -time-unit and
+// -time-column-type. RFC3339 timestamps are passed through as strings for
+// the database to parse into a timestamptz column, unless they are encoded in
+// binary with -copy-format=binary.
+func parseTime(s string) (interface{}, error) {
+	if timeUnit == timeUnitRFC3339 {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an RFC3339 timestamp", s)
+		}
+		if timeColumnType != timeColumnTimestamptz || copyFormat == copyFormatBinary {
+			return timeColumnValue(t), nil
+		}
+		return s, nil
+	}
+
+	timeInt, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not an integer timestamp in %s", s, timeUnit)
+	}
+	switch timeUnit {
+	case timeUnitUs:
+		return timeColumnValue(time.Unix(0, timeInt*int64(time.Microsecond))), nil
+	case timeUnitMs:
+		return timeColumnValue(time.Unix(0, timeInt*int64(time.Millisecond))), nil
+	case timeUnitS:
+		return timeColumnValue(time.Unix(timeInt, 0)), nil
+	default:
+		return timeColumnValue(time.Unix(0, timeInt)), nil
+	}
+}
+
+// timeColumnValue returns t as the value of a time column of -time-column-type:
+// as is for timestamptz, as its UTC wall clock time for timestamp (the drivers
+// drop the time zone) and as nanoseconds since the epoch for bigint.
+func timeColumnValue(t time.Time) interface{} {
+	switch timeColumnType {
+	case timeColumnTimestamp:
+		return t.UTC()
+	case timeColumnBigint:
+		return t.UnixNano()
+	default:
+		return t
+	}
+}
+
+// processCSI writes rows to hypertable, returning the number of metrics and
+// rows written. Nothing is written if the load times out first.
+func (p *processor) processCSI(hypertable string, rows []*insertData) (uint64, uint64) {
 	colLen := len(tableCols[hypertable]) + numExtraCols
 	if inTableTag {
 		colLen++
 	}
-	tagRows, dataRows, numMetrics := splitTagsAndMetrics(rows, colLen)
+	if len(partitionColumnIdx) > 0 {
+		colLen++
+	}
+	tagRows, dataRows, numMetrics := splitTagsAndMetrics(rows, colLen, tableRawFields[hypertable])
 
 	// Check if any of these tags has yet to be inserted
 	newTags := make([][]string, 0, len(rows))
@@ -190,9 +359,18 @@ func (p *processor) processCSI(hypertable string, rows []*insertData) uint64 {
 	p.csi.mutex.RUnlock()
 	if len(newTags) > 0 {
 		p.csi.mutex.Lock()
-		res := insertTags(p.db, newTags, true)
-		for k, v := range res {
-			p.csi.m[k] = v
+		// Another worker may have inserted some of the tags since they were checked
+		stillNew := newTags[:0]
+		for _, cols := range newTags {
+			if _, ok := p.csi.m[cols[0]]; !ok {
+				stillNew = append(stillNew, cols)
+			}
+		}
+		if len(stillNew) > 0 {
+			res := target.InsertTags(p.db, stillNew)
+			for k, v := range res {
+				p.csi.m[k] = v
+			}
 		}
 		p.csi.mutex.Unlock()
 	}
@@ -204,107 +382,599 @@ func (p *processor) processCSI(hypertable string, rows []*insertData) uint64 {
 	}
 	p.csi.mutex.RUnlock()
 
+	if sortBatch {
+		rows, dataRows = sortByTime(rows, dataRows)
+	}
+
+	// Rows are written with their columns listed explicitly in the order of
+	// the header, so existing tables may have their columns in any order
 	cols := make([]string, 0, colLen)
-	cols = append(cols, "time", "tags_id", "additional_tags")
+	cols = append(cols, timeColumnFor(hypertable), "tags_id", "additional_tags")
 	if inTableTag {
 		cols = append(cols, tableCols[tagsKey][0])
 	}
-	cols = append(cols, tableCols[hypertable]...)
+	if len(partitionColumnIdx) > 0 {
+		cols = append(cols, partitionKeyColumn)
+	}
+	// written holds the input row of each of dataRows
+	written := rows
+	if layout == layoutNarrow {
+		var nullRows int
+		dataRows, written, nullRows = unpivot(rows, dataRows, tableCols[hypertable], len(cols))
+		cols = append(cols, narrowNameColumn, narrowValueColumn)
+		numMetrics = uint64(len(dataRows))
+		if nullRows > 0 {
+			debugf("skipping %d rows of %s whose field values are all NULL", nullRows, hypertable)
+			skipped.addNullRows(nullRows)
+		}
+		if len(dataRows) == 0 {
+			return 0, 0
+		}
+	} else {
+		cols = append(cols, tableCols[hypertable]...)
+	}
 
-	if forceTextFormat {
-		tx := MustBegin(p.db)
-		stmt, err := tx.Prepare(pq.CopyIn(hypertable, cols...))
+	var rejected []rowReject
+	for attempt := 0; ; attempt++ {
+		var err error
+		if len(rejectsFile) > 0 {
+			rejected, err = p.insertRowsRejecting(hypertable, cols, dataRows)
+		} else {
+			err = target.WriteBatch(p, hypertable, cols, dataRows)
+		}
+		if err == nil {
+			break
+		}
+		if loader.Context().Err() != nil {
+			warnf("insert into %s aborted: %v", hypertable, redactErr(err))
+			return 0, 0
+		}
+		if attempt >= maxRetries {
+			if continueOnError {
+				skipBatch(hypertable, rows, written, err)
+				return 0, 0
+			}
+			fatal("failed to insert batch into %s after %d retries: %v; %s", hypertable, attempt, redactErr(err), describeFailingRow(written, err))
+			return 0, 0
+		}
+		backoff := retryBackoff(attempt)
+		warnf("insert into %s failed (attempt %d of %d), retrying in %v: %v", hypertable, attempt+1, maxRetries+1, backoff, redactErr(err))
+		time.Sleep(backoff)
+		if err := p.reconnect(); err != nil {
+			warnf("could not re-establish connection: %v", redactErr(err))
+		}
+	}
+
+	numRows := uint64(len(dataRows))
+	if len(rejected) > 0 {
+		rejectedMetrics, rejectedCount := rejectRows(hypertable, written, rejected)
+		numMetrics -= rejectedMetrics
+		numRows -= rejectedCount
+	}
+	return numMetrics, numRows
+}
+
+// writeRows sends dataRows to hypertable using the configured insert strategy.
+func (p *processor) writeRows(hypertable string, cols []string, dataRows [][]interface{}) error {
+	if insertStrategy == insertStrategyInsert {
+		return p.insertRows(hypertable, cols, dataRows)
+	}
+	return p.copyRows(hypertable, cols, dataRows)
+}
+
+// insertRows sends dataRows to hypertable as multi-row INSERT statements with
+// bound parameters, splitting them so no statement exceeds maxBindParams.
+// All statements for the batch are run in a single transaction.
+func (p *processor) insertRows(hypertable string, cols []string, dataRows [][]interface{}) error {
+	ctx := loader.Context()
+	tx, err := p.beginBatch(ctx)
+	if err != nil {
+		return err
+	}
+	inserted := int64(0)
+	rowsPerStmt := maxBindParams / len(cols)
+	for start := 0; start < len(dataRows); start += rowsPerStmt {
+		end := start + rowsPerStmt
+		if end > len(dataRows) {
+			end = len(dataRows)
+		}
+		query, args := buildInsert(hypertable, cols, dataRows[start:end])
+		res, err := tx.ExecContext(ctx, query, args...)
 		if err != nil {
-			panic(err)
+			tx.Rollback()
+			return err
 		}
+		if onConflict {
+			n, err := res.RowsAffected()
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			inserted += n
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if onConflict {
+		duplicateRows.add(hypertable, uint64(int64(len(dataRows))-inserted))
+	}
+	return nil
+}
 
-		for _, r := range dataRows {
-			stmt.Exec(r...)
+// insertRowsRejecting sends each of dataRows to hypertable as its own INSERT,
+// all in a single transaction, for -rejects-file. A row that fails is rolled
+// back to a savepoint taken before it and returned among the rejects, while
+// the other rows are committed. Errors that abort more than a row, e.g., a
+// lost connection, fail the whole batch.
+func (p *processor) insertRowsRejecting(hypertable string, cols []string, dataRows [][]interface{}) ([]rowReject, error) {
+	ctx := loader.Context()
+	tx, err := p.beginBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rejected []rowReject
+	inserted := int64(0)
+	for i := range dataRows {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT tsbs_row"); err != nil {
+			tx.Rollback()
+			return nil, err
 		}
-		_, err = stmt.Exec()
+		query, args := buildInsert(hypertable, cols, dataRows[i:i+1])
+		res, err := tx.ExecContext(ctx, query, args...)
 		if err != nil {
-			panic(err)
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT tsbs_row"); rbErr != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			rejected = append(rejected, rowReject{index: i, err: err})
+			continue
+		}
+		if onConflict {
+			n, err := res.RowsAffected()
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			inserted += n
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT tsbs_row"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if onConflict {
+		duplicateRows.add(hypertable, uint64(int64(len(dataRows)-len(rejected))-inserted))
+	}
+	return rejected, nil
+}
+
+// buildInsert returns a multi-row INSERT statement for rows along with the
+// arguments to bind to its placeholders. With -on-conflict, rows whose time
+// and tags already exist are skipped.
+func buildInsert(hypertable string, cols []string, rows [][]interface{}) (string, []interface{}) {
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(cols))
+	placeholders := make([]string, len(cols))
+	for _, r := range rows {
+		for i, v := range r {
+			args = append(args, toInsertArg(v))
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
 		}
+		values = append(values, "("+strings.Join(placeholders[:len(r)], ",")+")")
+	}
+	query := fmt.Sprintf(insertValues, pq.QuoteIdentifier(hypertable), strings.Join(quoteIdentifiers(cols), ","), strings.Join(values, ","))
+	if onConflict {
+		query += onConflictClause(hypertable)
+	}
+	return query, args
+}
+
+// onConflictClause returns the ON CONFLICT clause skipping rows that conflict
+// with those already loaded: on the -primary-key or -unique-key columns if set,
+// and otherwise on the unique index on tags and the time column of hypertable,
+// and the partition key with -partition-columns.
+func onConflictClause(hypertable string) string {
+	if len(tableKey) > 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(quoteIdentifiers(tableKey), ","))
+	}
+	return fmt.Sprintf(onConflictNothing, pq.QuoteIdentifier(timeColumnFor(hypertable))+uniquePartitionKey())
+}
 
-		err = stmt.Close()
+// toInsertArg converts a value prepared for COPY into one that every driver
+// can bind as a parameter. The additional tags map is sent as JSON text.
+func toInsertArg(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		b, err := json.Marshal(m)
 		if err != nil {
 			panic(err)
 		}
+		return string(b)
+	}
+	return v
+}
+
+// binaryCopyTypes are the column types whose values the pgx driver can encode
+// in binary from the unparsed strings of fields with a non-default type
+var binaryCopyTypes = map[string]bool{
+	"bigint": true, "int8": true, "integer": true, "int": true, "int4": true,
+	"smallint": true, "int2": true, "double precision": true, "float8": true,
+	"real": true, "float4": true, "numeric": true, "decimal": true,
+	"boolean": true, "bool": true, "text": true, "varchar": true,
+	"character varying": true, "json": true, "jsonb": true, "uuid": true,
+}
+
+// checkBinaryCopyTypes returns an error if any of types, given with
+// -field-types, cannot be sent with -copy-format=binary
+func checkBinaryCopyTypes(types map[string]string) error {
+	for field, t := range types {
+		name := strings.ToLower(strings.TrimSpace(t))
+		// Modifiers such as in varchar(20) or numeric(10,2) do not change the encoding
+		if i := strings.Index(name, "("); i >= 0 && strings.HasSuffix(name, ")") {
+			name = strings.TrimSpace(name[:i])
+		}
+		if !binaryCopyTypes[name] {
+			return fmt.Errorf("type '%s' of field '%s' cannot be sent with -copy-format=binary, use -copy-format=text", t, field)
+		}
+	}
+	return nil
+}
 
-		err = tx.Commit()
+// copyRows sends dataRows to hypertable in a single transaction, returning
+// an error instead of panicking so that the caller may retry the batch.
+func (p *processor) copyRows(hypertable string, cols []string, dataRows [][]interface{}) error {
+	ctx := loader.Context()
+	if forceTextFormat {
+		tx, err := p.beginBatch(ctx)
 		if err != nil {
-			panic(err)
+			return err
 		}
-	} else {
-		rows := pgx.CopyFromRows(dataRows)
-		inserted, err := p.pgxConn.CopyFrom(context.Background(), pgx.Identifier{hypertable}, cols, rows)
+		if copyFreeze && !p.truncated[hypertable] {
+			// The table is new, so no rows are lost
+			if _, err := tx.ExecContext(ctx, "TRUNCATE "+pq.QuoteIdentifier(hypertable)); err != nil {
+				tx.Rollback()
+				return err
+			}
+			p.truncated[hypertable] = true
+		}
+		for _, chunk := range copyChunks(dataRows) {
+			if err := copyIn(ctx, tx, hypertable, cols, chunk); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	chunks := copyChunks(dataRows)
+	tx := p.pgxTx
+	var flushTx pgx.Tx
+	if tx == nil && (len(chunks) > 1 || isolation != isolationReadCommitted) {
+		// The flushes of a batch are committed together, and a COPY outside
+		// of a transaction would run at the default isolation level
+		var err error
+		flushTx, err = p.pgxConn.BeginTx(ctx, pgxTxOptions())
 		if err != nil {
-			panic(err)
+			return err
+		}
+		tx = flushTx
+	}
+	for _, chunk := range chunks {
+		rows := pgx.CopyFromRows(chunk)
+		var inserted int64
+		var err error
+		if tx != nil {
+			inserted, err = tx.CopyFrom(ctx, pgx.Identifier{hypertable}, cols, rows)
+		} else {
+			inserted, err = p.pgxConn.CopyFrom(ctx, pgx.Identifier{hypertable}, cols, rows)
+		}
+		if err != nil {
+			if flushTx != nil {
+				flushTx.Rollback(context.Background())
+			}
+			return err
+		}
+		if inserted != int64(len(chunk)) {
+			fatal("failed to insert all the data into %s: expected %d rows, got %d", hypertable, len(chunk), inserted)
+			return nil
+		}
+	}
+	if flushTx != nil {
+		return flushTx.Commit(ctx)
+	}
+	return nil
+}
+
+// copyIn copies dataRows into hypertable with a single COPY statement in tx
+func copyIn(ctx context.Context, tx *batchTx, hypertable string, cols []string, dataRows [][]interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, copyInStmt(hypertable, cols))
+	if err != nil {
+		return err
+	}
+	for _, r := range dataRows {
+		if _, err = stmt.ExecContext(ctx, r...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+// copyChunks splits dataRows into the rows of each COPY statement of a batch.
+// With -copy-flush-rows, the COPY is ended, flushing the driver's buffer, and
+// another started every that many rows; otherwise all rows are copied at once.
+func copyChunks(dataRows [][]interface{}) [][][]interface{} {
+	if copyFlushRows <= 0 || len(dataRows) <= copyFlushRows {
+		return [][][]interface{}{dataRows}
+	}
+	chunks := make([][][]interface{}, 0, (len(dataRows)+copyFlushRows-1)/copyFlushRows)
+	for start := 0; start < len(dataRows); start += copyFlushRows {
+		end := start + copyFlushRows
+		if end > len(dataRows) {
+			end = len(dataRows)
 		}
-		if inserted != int64(len(dataRows)) {
-			fmt.Fprintf(os.Stderr, "Failed to insert all the data! Expected: %d, Got: %d", len(dataRows), inserted)
-			os.Exit(1)
+		chunks = append(chunks, dataRows[start:end])
+	}
+	return chunks
+}
+
+// copyInStmt returns the COPY statement for cols of hypertable with pq. With
+// -copy-freeze, the rows are frozen as they are copied, which requires the
+// table to be truncated in the same transaction first.
+func copyInStmt(hypertable string, cols []string) string {
+	stmt := pq.CopyIn(hypertable, cols...)
+	if copyFreeze {
+		stmt += " WITH (FREEZE)"
+	}
+	return stmt
+}
+
+// batchTx is the transaction a batch is written in. With -tx-per=worker it is
+// the worker's transaction, which is only committed once the worker is done,
+// so committing or rolling it back for a batch does nothing.
+type batchTx struct {
+	*sql.Tx
+	worker bool
+}
+
+func (t *batchTx) Commit() error {
+	if t.worker {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *batchTx) Rollback() error {
+	if t.worker {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// beginBatch returns the transaction to write a batch in
+func (p *processor) beginBatch(ctx context.Context) (*batchTx, error) {
+	if p.tx != nil {
+		return &batchTx{Tx: p.tx, worker: true}, nil
+	}
+	tx, err := p.db.BeginTx(ctx, txOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &batchTx{Tx: tx}, nil
+}
+
+// txOptions returns the options of the transactions batches are written in,
+// with the isolation level of -isolation
+func txOptions() *sql.TxOptions {
+	switch isolation {
+	case isolationRepeatableRead:
+		return &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+	case isolationSerializable:
+		return &sql.TxOptions{Isolation: sql.LevelSerializable}
+	default:
+		return nil
+	}
+}
+
+// pgxTxOptions returns txOptions for transactions begun with pgx
+func pgxTxOptions() pgx.TxOptions {
+	switch isolation {
+	case isolationRepeatableRead:
+		return pgx.TxOptions{IsoLevel: pgx.RepeatableRead}
+	case isolationSerializable:
+		return pgx.TxOptions{IsoLevel: pgx.Serializable}
+	default:
+		return pgx.TxOptions{}
+	}
+}
+
+// beginWorkerTx begins the transaction all of the worker's batches are written
+// in with -tx-per=worker. COPY with pgx uses the worker's pgx connection, while
+// INSERT and COPY with pq go through database/sql.
+func (p *processor) beginWorkerTx() {
+	var err error
+	if p.pgxConn != nil && insertStrategy != insertStrategyInsert {
+		p.pgxTx, err = p.pgxConn.BeginTx(loader.Context(), pgxTxOptions())
+	} else {
+		p.tx, err = p.db.BeginTx(loader.Context(), txOptions())
+	}
+	if err != nil {
+		fatal("could not begin the transaction of worker %d: %v", p.workerNum, redactErr(err))
+	}
+}
+
+// commitWorkerTx commits the worker's transaction with -tx-per=worker, or
+// rolls it back if the load timed out, since its last batch may be incomplete.
+func (p *processor) commitWorkerTx() {
+	var err error
+	if loader.Context().Err() != nil {
+		warnf("rolling back the transaction of worker %d as the load timed out", p.workerNum)
+		if p.pgxTx != nil {
+			p.pgxTx.Rollback(context.Background())
+		} else {
+			p.tx.Rollback()
 		}
+		return
+	}
+	if p.pgxTx != nil {
+		err = p.pgxTx.Commit(context.Background())
+	} else {
+		err = p.tx.Commit()
 	}
+	if err != nil {
+		fatal("could not commit the transaction of worker %d: %v", p.workerNum, redactErr(err))
+	}
+}
+
+// retryBackoff returns how long to wait before retrying a failed batch,
+// doubling with each attempt starting from retryBackoffBase, up to retryBackoffMax.
+func retryBackoff(attempt int) time.Duration {
+	backoff := retryBackoffBase
+	for i := 0; i < attempt && backoff < retryBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > retryBackoffMax {
+		return retryBackoffMax
+	}
+	return backoff
+}
 
-	return numMetrics
+// reconnect re-establishes the worker's connection to the database if it
+// has been lost, so that a retried batch does not fail again for the same reason.
+func (p *processor) reconnect() error {
+	if err := p.db.Ping(); err != nil {
+		return err
+	}
+	if forceTextFormat || !p.dedicated || (p.pgxConn != nil && !p.pgxConn.IsClosed()) {
+		return nil
+	}
+	if p.pgxConn != nil {
+		// The connection is already broken, so an error releasing it is expected
+		stdlib.ReleaseConn(p.db, p.pgxConn)
+		p.pgxConn = nil
+	}
+	conn, err := stdlib.AcquireConn(p.db)
+	if err != nil {
+		return err
+	}
+	p.pgxConn = conn
+	return nil
 }
 
 type processor struct {
-	db      *sql.DB
-	csi     *syncCSI
-	pgxConn *pgx.Conn
+	workerNum int
+	db        *sql.DB
+	csi       *syncCSI
+	pgxConn   *pgx.Conn
+	// dedicated is set when db is the worker's own rather than the shared pool
+	dedicated bool
+	// tx or pgxTx is the worker's transaction with -tx-per=worker
+	tx    *sql.Tx
+	pgxTx pgx.Tx
+	// checksum is the sum of the checksums of the rows processed with -checksum
+	checksum uint64
+	// truncated holds the tables truncated in the worker's transaction with -copy-freeze
+	truncated map[string]bool
+}
+
+// needsDedicatedConn returns whether workers need their own connection rather
+// than drawing from the shared pool. COPY holds its connection for the whole
+// batch, so only the insert strategy can share. A worker's transaction holds
+// its connection for the whole load, and with -postgres-hosts each worker
+// connects to its own host.
+func needsDedicatedConn() bool {
+	return insertStrategy != insertStrategyInsert || txPer == txPerWorker || len(postgresHosts) > 0
 }
 
 func (p *processor) Init(workerNum int, doLoad bool) {
+	p.workerNum = workerNum
 	if doLoad {
-		p.db = MustConnect(driver, getConnectString())
-		if hashWorkers {
+		p.dedicated = needsDedicatedConn()
+		if p.dedicated {
+			p.db = MustConnect(driver, workerConnectString(workerNum))
+		} else {
+			p.db = getSharedPool()
+		}
+		if len(postgresHosts) > 0 {
+			p.csi = hostSyncCSIs[workerNum%len(postgresHosts)]
+		} else if hashWorkers {
 			p.csi = newSyncCSI()
 		} else {
 			p.csi = globalSyncCSI
 		}
-		if !forceTextFormat {
+		if appendToExistingTags {
+			loadExistingTags(p.db, p.csi)
+		}
+		if !forceTextFormat && p.dedicated {
 			conn, err := stdlib.AcquireConn(p.db)
 			if err != nil {
-				panic(err)
+				fatal("could not acquire connection of worker %d: %v", p.workerNum, redactErr(err))
+				return
 			}
 			p.pgxConn = conn
 		}
+		if txPer == txPerWorker {
+			p.beginWorkerTx()
+		}
+		p.truncated = make(map[string]bool)
 	}
 }
 
 func (p *processor) Close(doLoad bool) {
-	if doLoad {
-		p.db.Close()
+	if checksum {
+		addChecksum(p.checksum)
+	}
+	if p.tx != nil || p.pgxTx != nil {
+		p.commitWorkerTx()
 	}
 	if p.pgxConn != nil {
 		err := stdlib.ReleaseConn(p.db, p.pgxConn)
 		if err != nil {
-			panic(err)
+			fatal("could not release connection of worker %d: %v", p.workerNum, redactErr(err))
 		}
 	}
+	// The shared pool is closed once all workers are done with it
+	if doLoad && p.dedicated {
+		p.db.Close()
+	}
 }
 
 func (p *processor) ProcessBatch(b load.Batch, doLoad bool) (uint64, uint64) {
 	batches := b.(*hypertableArr)
 	rowCnt := 0
 	metricCnt := uint64(0)
-	for hypertable, rows := range batches.m {
-		rowCnt += len(rows)
-		if doLoad {
+	for _, t := range batches.tables() {
+		hypertable, rows := t.hypertable, t.rows
+		if checksum {
+			p.checksum += rowsChecksum(hypertable, rows)
+		}
+		if !doLoad {
+			rowCnt += len(rows)
+			loader.AddTableCounts(hypertable, 0, uint64(len(rows)))
+		} else {
 			start := time.Now()
-			metricCnt += p.processCSI(hypertable, rows)
+			metrics, loaded := p.processCSI(hypertable, rows)
+			metricCnt += metrics
+			rowCnt += int(loaded)
+			loader.AddTableCounts(hypertable, metrics, loaded)
 
 			if logBatches {
 				now := time.Now()
 				took := now.Sub(start)
 				batchSize := len(rows)
-				fmt.Printf("BATCH: batchsize %d row rate %f/sec (took %v)\n", batchSize, float64(batchSize)/float64(took.Seconds()), took)
+				loader.Reportf("BATCH: worker %d hypertable %s batchsize %d row rate %f/sec (took %v)\n", p.workerNum, hypertable, batchSize, float64(batchSize)/float64(took.Seconds()), took)
 			}
 		}
 	}
 	batches.m = map[string][]*insertData{}
+	batches.runs = nil
 	batches.cnt = 0
 	return metricCnt, uint64(rowCnt)
 }
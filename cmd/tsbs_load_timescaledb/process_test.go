@@ -1,10 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"log"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 func TestSubsystemTagsToJSON(t *testing.T) {
@@ -86,10 +91,11 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 		desc        string
 		rows        []*insertData
 		inTableTag  bool
+		nullAs      string
 		wantMetrics uint64
 		wantTags    [][]string
 		wantData    [][]interface{}
-		shouldPanic bool
+		shouldFatal bool
 	}{
 		{
 			desc:        "just common tags",
@@ -141,7 +147,28 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 					fields: "not_a_timestamp,1,5,42",
 				},
 			},
-			shouldPanic: true,
+			shouldFatal: true,
+		},
+		{
+			desc: "invalid value",
+			rows: []*insertData{
+				{
+					tags:   "tag1=foo,tag2=bar",
+					fields: "100,1,x,42",
+					line:   12,
+				},
+			},
+			shouldFatal: true,
+		},
+		{
+			desc: "tag without label",
+			rows: []*insertData{
+				{
+					tags:   "tag1=foo,bar",
+					fields: "100,1,5,42",
+				},
+			},
+			shouldFatal: true,
 		},
 		{
 			desc: "empty tag value",
@@ -151,7 +178,8 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 					fields: "100,1,5,42",
 				},
 			},
-			wantTags: [][]string{{"", "bar"}},
+			wantMetrics: 3,
+			wantTags:    [][]string{{"", "bar"}},
 			wantData: [][]interface{}{
 				[]interface{}{toTS("100"), nil, nil, 1.0, 5.0, 42.0},
 			},
@@ -164,7 +192,8 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 					fields: "100,1,5,42",
 				},
 			},
-			wantTags: [][]string{{"foo", "bar"}},
+			wantMetrics: 3,
+			wantTags:    [][]string{{"foo", "bar"}},
 			wantData: [][]interface{}{
 				[]interface{}{toTS("100"), nil, map[string]interface{}{"tag3": ""}, 1.0, 5.0, 42.0},
 			},
@@ -177,27 +206,49 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 					fields: "100,,5,42",
 				},
 			},
-			wantTags: [][]string{{"foo", "bar"}},
+			wantMetrics: 3,
+			wantTags:    [][]string{{"foo", "bar"}},
 			wantData: [][]interface{}{
 				[]interface{}{toTS("100"), nil, nil, nil, 5.0, 42.0},
 			},
 		},
+		{
+			desc: "null marker field value",
+			rows: []*insertData{
+				{
+					tags:   "tag1=foo,tag2=bar",
+					fields: "100,NULL,5,",
+				},
+			},
+			nullAs:      "NULL",
+			wantMetrics: 3,
+			wantTags:    [][]string{{"foo", "bar"}},
+			wantData: [][]interface{}{
+				[]interface{}{toTS("100"), nil, nil, nil, 5.0, nil},
+			},
+		},
 	}
 
 	for _, c := range cases {
-		if c.shouldPanic {
-			defer func() {
-				if re := recover(); re == nil {
-					t.Errorf("%s: did not panic when should", c.desc)
-				}
-			}()
-			splitTagsAndMetrics(c.rows, numCols+numExtraCols)
+		if c.shouldFatal {
+			isCalled := false
+			fatal = func(fmt string, args ...interface{}) {
+				isCalled = true
+				log.Printf(fmt, args...)
+			}
+			splitTagsAndMetrics(c.rows, numCols+numExtraCols, nil)
+			if !isCalled {
+				t.Errorf("%s: did not call fatal when it should", c.desc)
+			}
+			continue
 		}
 
 		oldInTableTag := inTableTag
 		inTableTag = c.inTableTag
+		oldNullAs := nullAs
+		nullAs = c.nullAs
 
-		gotTags, gotData, numMetrics := splitTagsAndMetrics(c.rows, numCols+numExtraCols)
+		gotTags, gotData, numMetrics := splitTagsAndMetrics(c.rows, numCols+numExtraCols, nil)
 		if numMetrics != c.wantMetrics {
 			t.Errorf("%s: number of metrics incorrect: got %d want %d", c.desc, numMetrics, c.wantMetrics)
 		}
@@ -248,6 +299,7 @@ func TestSplitTagsAndMetrics(t *testing.T) {
 		}
 
 		inTableTag = oldInTableTag
+		nullAs = oldNullAs
 	}
 }
 
@@ -260,3 +312,405 @@ func TestConvertValsToSQLBasedOnType(t *testing.T) {
 		t.Errorf("error converting to sql values\nexpected: %v\ngot: %v", expected, converted)
 	}
 }
+
+func TestRetryBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 100 * time.Millisecond},
+		{attempt: 1, want: 200 * time.Millisecond},
+		{attempt: 2, want: 400 * time.Millisecond},
+		{attempt: 5, want: 3200 * time.Millisecond},
+		{attempt: 8, want: 25600 * time.Millisecond},
+		{attempt: 9, want: retryBackoffMax},
+		{attempt: 20, want: retryBackoffMax},
+		{attempt: 100, want: retryBackoffMax},
+	}
+
+	for _, c := range cases {
+		if got := retryBackoff(c.attempt); got != c.want {
+			t.Errorf("attempt %d: incorrect backoff: got %v want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+// failingTarget fails the first fails batches written to it
+type failingTarget struct {
+	timescaleLoader
+	fails  int
+	writes int
+}
+
+func (f *failingTarget) WriteBatch(_ *processor, _ string, _ []string, _ [][]interface{}) error {
+	f.writes++
+	if f.writes <= f.fails {
+		return errors.New("connection reset by peer")
+	}
+	return nil
+}
+
+func TestProcessCSIRetry(t *testing.T) {
+	oldTarget, oldMaxRetries, oldTableCols, oldFatal := target, maxRetries, tableCols, fatal
+	defer func() {
+		target, maxRetries, tableCols, fatal = oldTarget, oldMaxRetries, oldTableCols, oldFatal
+	}()
+	maxRetries = 2
+	tableCols = map[string][]string{tagsKey: {"hostname"}, "cpu": {"usage_user"}}
+	// Reconnecting fails without a database, which only logs a warning
+	db, err := sql.Open(pqDriver, "host=/nonexistent")
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+	defer db.Close()
+
+	cases := []struct {
+		desc       string
+		fails      int
+		wantWrites int
+		wantRows   uint64
+		wantFatal  bool
+	}{
+		{desc: "no failure", fails: 0, wantWrites: 1, wantRows: 2},
+		{desc: "succeeds on retry", fails: 2, wantWrites: 3, wantRows: 2},
+		{desc: "retries exhausted", fails: 3, wantWrites: 3, wantFatal: true},
+	}
+	for _, c := range cases {
+		ft := &failingTarget{fails: c.fails}
+		target = ft
+		fatalCalled := false
+		fatal = func(format string, args ...interface{}) {
+			fatalCalled = true
+		}
+		p := &processor{db: db, csi: newSyncCSI()}
+		p.csi.m["host_0"] = 1
+		rows := []*insertData{
+			{tags: "hostname=host_0", fields: "100,1"},
+			{tags: "hostname=host_0", fields: "200,2"},
+		}
+		metrics, numRows := p.processCSI("cpu", rows)
+		if ft.writes != c.wantWrites {
+			t.Errorf("%s: incorrect number of attempts: got %d want %d", c.desc, ft.writes, c.wantWrites)
+		}
+		if fatalCalled != c.wantFatal {
+			t.Errorf("%s: incorrect fatal: got %v want %v", c.desc, fatalCalled, c.wantFatal)
+		}
+		if numRows != c.wantRows || metrics != c.wantRows {
+			t.Errorf("%s: incorrect counts: got %d metrics %d rows want %d of each", c.desc, metrics, numRows, c.wantRows)
+		}
+	}
+}
+
+func TestBuildInsert(t *testing.T) {
+	ts := time.Unix(0, 100)
+	cols := []string{"time", "tags_id", "additional_tags", "usage_user"}
+	rows := [][]interface{}{
+		{ts, int64(1), nil, 5.0},
+		{ts, int64(2), map[string]interface{}{"foo": "bar"}, nil},
+	}
+	wantQuery := `INSERT INTO "cpu"("time","tags_id","additional_tags","usage_user") VALUES ($1,$2,$3,$4),($5,$6,$7,$8)`
+	wantArgs := []interface{}{ts, int64(1), nil, 5.0, ts, int64(2), `{"foo":"bar"}`, nil}
+
+	query, args := buildInsert("cpu", cols, rows)
+	if query != wantQuery {
+		t.Errorf("incorrect query: got\n%s\nwant\n%s", query, wantQuery)
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("incorrect args: got %v want %v", args, wantArgs)
+	}
+
+	onConflict = true
+	query, _ = buildInsert("cpu", cols, rows)
+	onConflict = false
+	if want := wantQuery + ` ON CONFLICT (tags_id, "time") DO NOTHING`; query != want {
+		t.Errorf("incorrect on conflict query: got\n%s\nwant\n%s", query, want)
+	}
+
+	oldTableTimeColumns := tableTimeColumns
+	onConflict, tableTimeColumns = true, map[string]string{"cpu": "ts"}
+	query, _ = buildInsert("cpu", cols, rows)
+	onConflict, tableTimeColumns = false, oldTableTimeColumns
+	if want := wantQuery + ` ON CONFLICT (tags_id, "ts") DO NOTHING`; query != want {
+		t.Errorf("incorrect on conflict query with -time-column: got\n%s\nwant\n%s", query, want)
+	}
+
+	oldPartitionColumns := partitionColumns
+	onConflict, partitionColumns = true, []string{"region"}
+	query, _ = buildInsert("cpu", cols, rows)
+	onConflict, partitionColumns = false, oldPartitionColumns
+	if want := wantQuery + ` ON CONFLICT (tags_id, "time", "partition_key") DO NOTHING`; query != want {
+		t.Errorf("incorrect on conflict query with -partition-columns: got\n%s\nwant\n%s", query, want)
+	}
+
+	onConflict = true
+	tableKey = []string{"time", "tags_id", "usage_user"}
+	query, _ = buildInsert("cpu", cols, rows)
+	onConflict = false
+	tableKey = nil
+	if want := wantQuery + ` ON CONFLICT ("time","tags_id","usage_user") DO NOTHING`; query != want {
+		t.Errorf("incorrect on conflict query with key: got\n%s\nwant\n%s", query, want)
+	}
+}
+
+func TestSplitTagsAndMetricsRawFields(t *testing.T) {
+	tableCols[tagsKey] = []string{"tag1"}
+	rows := []*insertData{
+		{
+			tags:   "tag1=foo",
+			fields: "100,1,5,",
+		},
+	}
+	_, gotData, numMetrics := splitTagsAndMetrics(rows, 6, []bool{true, false, true})
+	if numMetrics != 3 {
+		t.Errorf("number of metrics incorrect: got %d want %d", numMetrics, 3)
+	}
+	want := []interface{}{"1", 5.0, nil}
+	if got := gotData[0][3:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect metric values: got %v want %v", got, want)
+	}
+}
+
+func TestUnpivot(t *testing.T) {
+	rows := []*insertData{{row: 1}, {row: 2}}
+	ts := time.Unix(0, 100)
+	dataRows := [][]interface{}{
+		{ts, int64(1), nil, 1.0, nil, 3.0},
+		{ts, int64(2), nil, nil, nil, nil},
+	}
+	gotRows, gotSources, gotNullRows := unpivot(rows, dataRows, []string{"a", "b", "c"}, 3)
+	want := [][]interface{}{
+		{ts, int64(1), nil, "a", 1.0},
+		{ts, int64(1), nil, "c", 3.0},
+	}
+	if !reflect.DeepEqual(gotRows, want) {
+		t.Errorf("incorrect unpivoted rows: got %v want %v", gotRows, want)
+	}
+	if len(gotSources) != 2 || gotSources[0] != rows[0] || gotSources[1] != rows[0] {
+		t.Errorf("incorrect source rows: got %v", gotSources)
+	}
+	if gotNullRows != 1 {
+		t.Errorf("incorrect rows with all NULL values: got %d want 1", gotNullRows)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2016, 1, 1, 0, 0, 1, 0, time.UTC)
+	cases := []struct {
+		unit    string
+		format  string
+		in      string
+		want    interface{}
+		wantErr bool
+	}{
+		{unit: timeUnitNs, in: "1451606401000000000", want: want},
+		{unit: timeUnitUs, in: "1451606401000000", want: want},
+		{unit: timeUnitMs, in: "1451606401000", want: want},
+		{unit: timeUnitS, in: "1451606401", want: want},
+		{unit: timeUnitRFC3339, format: copyFormatText, in: "2016-01-01T00:00:01Z", want: "2016-01-01T00:00:01Z"},
+		{unit: timeUnitRFC3339, format: copyFormatBinary, in: "2016-01-01T02:00:01+02:00", want: want},
+		{unit: timeUnitNs, in: "2016-01-01T00:00:01Z", wantErr: true},
+		{unit: timeUnitS, in: "", wantErr: true},
+		{unit: timeUnitRFC3339, in: "1451606401", wantErr: true},
+	}
+
+	oldTimeUnit, oldCopyFormat := timeUnit, copyFormat
+	for _, c := range cases {
+		timeUnit, copyFormat = c.unit, c.format
+		got, err := parseTime(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s %s: expected error but got none", c.unit, c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", c.unit, c.in, err)
+			continue
+		}
+		if ts, ok := got.(time.Time); ok {
+			if !ts.Equal(c.want.(time.Time)) {
+				t.Errorf("%s %s: incorrect time: got %v want %v", c.unit, c.in, ts, c.want)
+			}
+		} else if got != c.want {
+			t.Errorf("%s %s: incorrect value: got %v want %v", c.unit, c.in, got, c.want)
+		}
+	}
+	timeUnit, copyFormat = oldTimeUnit, oldCopyFormat
+}
+
+func TestCheckBinaryCopyTypes(t *testing.T) {
+	cases := []struct {
+		desc    string
+		types   map[string]string
+		wantErr bool
+	}{
+		{desc: "none"},
+		{desc: "supported", types: map[string]string{"a": "BIGINT", "b": "text", "c": "DOUBLE PRECISION"}},
+		{desc: "modifiers", types: map[string]string{"a": "VARCHAR(20)", "b": "numeric(10, 2)"}},
+		{desc: "unsupported", types: map[string]string{"a": "BIGINT", "b": "INET"}, wantErr: true},
+		{desc: "array", types: map[string]string{"a": "INTEGER[]"}, wantErr: true},
+	}
+	for _, c := range cases {
+		err := checkBinaryCopyTypes(c.types)
+		if c.wantErr && err == nil {
+			t.Errorf("%s: expected error but got none", c.desc)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestParseTimeColumnType(t *testing.T) {
+	oldTimeUnit, oldTimeColumnType := timeUnit, timeColumnType
+	defer func() { timeUnit, timeColumnType = oldTimeUnit, oldTimeColumnType }()
+	want := time.Date(2016, 1, 1, 0, 0, 1, 0, time.UTC)
+	cases := []struct {
+		columnType string
+		unit       string
+		in         string
+		want       interface{}
+	}{
+		{columnType: timeColumnTimestamp, unit: timeUnitS, in: "1451606401", want: want},
+		{columnType: timeColumnTimestamp, unit: timeUnitRFC3339, in: "2016-01-01T02:00:01+02:00", want: want},
+		{columnType: timeColumnBigint, unit: timeUnitMs, in: "1451606401000", want: want.UnixNano()},
+		{columnType: timeColumnBigint, unit: timeUnitRFC3339, in: "2016-01-01T00:00:01Z", want: want.UnixNano()},
+	}
+	for _, c := range cases {
+		timeUnit, timeColumnType = c.unit, c.columnType
+		got, err := parseTime(c.in)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", c.columnType, c.in, err)
+			continue
+		}
+		if ts, ok := got.(time.Time); ok {
+			// The wall clock time is stored in timestamp columns, so it must be UTC
+			if !ts.Equal(c.want.(time.Time)) || ts.Location() != time.UTC {
+				t.Errorf("%s %s: incorrect time: got %v want %v", c.columnType, c.in, ts, c.want)
+			}
+		} else if got != c.want {
+			t.Errorf("%s %s: incorrect value: got %v want %v", c.columnType, c.in, got, c.want)
+		}
+	}
+}
+
+func TestValidateNullAs(t *testing.T) {
+	cases := []struct {
+		marker  string
+		wantErr bool
+	}{
+		{marker: ""},
+		{marker: "NULL"},
+		{marker: `\N`},
+		{marker: "0", wantErr: true},
+		{marker: "-1.5", wantErr: true},
+		{marker: "NaN", wantErr: true},
+		{marker: "a,b", wantErr: true},
+	}
+	for _, c := range cases {
+		err := validateNullAs(c.marker)
+		if c.wantErr && err == nil {
+			t.Errorf("%s: expected an error", c.marker)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.marker, err)
+		}
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	oldIdx := partitionColumnIdx
+	defer func() { partitionColumnIdx = oldIdx }()
+	partitionColumnIdx = []int{2, 0}
+	if got, want := partitionKey([]string{"host_0", "eu-west-1", "eu-west-1a"}), "eu-west-1a,host_0"; got != want {
+		t.Errorf("incorrect partition key: got %s want %s", got, want)
+	}
+}
+
+func TestNeedsDedicatedConn(t *testing.T) {
+	oldStrategy, oldTxPer := insertStrategy, txPer
+	defer func() { insertStrategy, txPer = oldStrategy, oldTxPer }()
+	txPer = txPerBatch
+	insertStrategy = insertStrategyCopy
+	if !needsDedicatedConn() {
+		t.Errorf("copy strategy should use a dedicated connection")
+	}
+	insertStrategy = insertStrategyInsert
+	if needsDedicatedConn() {
+		t.Errorf("insert strategy should use the shared pool")
+	}
+	txPer = txPerWorker
+	if !needsDedicatedConn() {
+		t.Errorf("transaction per worker should use a dedicated connection")
+	}
+}
+
+func TestCopyInStmt(t *testing.T) {
+	oldCopyFreeze := copyFreeze
+	defer func() { copyFreeze = oldCopyFreeze }()
+	copyFreeze = false
+	if got, want := copyInStmt("cpu", []string{"time", "usage_user"}), `COPY "cpu" ("time", "usage_user") FROM STDIN`; got != want {
+		t.Errorf("incorrect statement: got %s want %s", got, want)
+	}
+	copyFreeze = true
+	if got, want := copyInStmt("cpu", []string{"time", "usage_user"}), `COPY "cpu" ("time", "usage_user") FROM STDIN WITH (FREEZE)`; got != want {
+		t.Errorf("incorrect statement with -copy-freeze: got %s want %s", got, want)
+	}
+}
+
+func TestTxOptions(t *testing.T) {
+	oldIsolation := isolation
+	defer func() { isolation = oldIsolation }()
+	cases := []struct {
+		isolation string
+		want      *sql.TxOptions
+		wantPgx   pgx.TxOptions
+	}{
+		{isolation: isolationReadCommitted},
+		{isolation: isolationRepeatableRead, want: &sql.TxOptions{Isolation: sql.LevelRepeatableRead}, wantPgx: pgx.TxOptions{IsoLevel: pgx.RepeatableRead}},
+		{isolation: isolationSerializable, want: &sql.TxOptions{Isolation: sql.LevelSerializable}, wantPgx: pgx.TxOptions{IsoLevel: pgx.Serializable}},
+	}
+	for _, c := range cases {
+		isolation = c.isolation
+		if got := txOptions(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect options: got %v want %v", c.isolation, got, c.want)
+		}
+		if got := pgxTxOptions(); got != c.wantPgx {
+			t.Errorf("%s: incorrect pgx options: got %v want %v", c.isolation, got, c.wantPgx)
+		}
+	}
+}
+
+func TestCopyChunks(t *testing.T) {
+	oldCopyFlushRows := copyFlushRows
+	defer func() { copyFlushRows = oldCopyFlushRows }()
+	rows := make([][]interface{}, 5)
+	for i := range rows {
+		rows[i] = []interface{}{i}
+	}
+	cases := []struct {
+		flushRows int
+		want      []int
+	}{
+		{flushRows: 0, want: []int{5}},
+		{flushRows: 2, want: []int{2, 2, 1}},
+		{flushRows: 5, want: []int{5}},
+		{flushRows: 10, want: []int{5}},
+	}
+	for _, c := range cases {
+		copyFlushRows = c.flushRows
+		chunks := copyChunks(rows)
+		sizes := make([]int, len(chunks))
+		next := 0
+		for i, chunk := range chunks {
+			sizes[i] = len(chunk)
+			for _, r := range chunk {
+				if r[0] != next {
+					t.Errorf("flush rows %d: got row %v want %d", c.flushRows, r[0], next)
+				}
+				next++
+			}
+		}
+		if !reflect.DeepEqual(sizes, c.want) {
+			t.Errorf("flush rows %d: incorrect chunk sizes: got %v want %v", c.flushRows, sizes, c.want)
+		}
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"runtime/pprof"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/process"
@@ -13,7 +14,8 @@ import (
 func profileCPUAndMem(file string) {
 	f, err := os.Create(file)
 	if err != nil {
-		log.Fatal(err)
+		fatal("cannot create profile file: %v", err)
+		return
 	}
 	defer f.Close()
 
@@ -22,7 +24,8 @@ func profileCPUAndMem(file string) {
 		if proc == nil {
 			procs, err := process.Processes()
 			if err != nil {
-				panic(err)
+				fatal("could not list processes to profile: %v", err)
+				return
 			}
 			for _, p := range procs {
 				cmd, _ := p.Cmdline()
@@ -47,3 +50,48 @@ func profileCPUAndMem(file string) {
 		}
 	}
 }
+
+// startPprof starts a CPU profile of the loader written to cpuFile, if set, and
+// returns a function that stops it and writes a heap profile to memFile, if
+// set. The returned function only has an effect the first time it is called.
+func startPprof(cpuFile, memFile string) func() {
+	var cpu *os.File
+	if len(cpuFile) > 0 {
+		var err error
+		cpu, err = os.Create(cpuFile)
+		if err != nil {
+			fatal("cannot create CPU profile: %v", err)
+			return func() {}
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			fatal("cannot start CPU profile: %v", err)
+			return func() {}
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if cpu != nil {
+				pprof.StopCPUProfile()
+				cpu.Close()
+			}
+			if len(memFile) > 0 {
+				writeHeapProfile(memFile)
+			}
+		})
+	}
+}
+
+// writeHeapProfile writes a profile of the live heap to file
+func writeHeapProfile(file string) {
+	f, err := os.Create(file)
+	if err != nil {
+		warnf("cannot create memory profile: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		warnf("cannot write memory profile: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartPprof(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pprof")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpuFile := filepath.Join(dir, "cpu.pprof")
+	memFile := filepath.Join(dir, "mem.pprof")
+
+	stop := startPprof(cpuFile, memFile)
+	stop()
+	// Later calls, e.g., deferred after an early exit ran it, do nothing
+	stop()
+	for _, file := range []string{cpuFile, memFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Errorf("profile %s was not written: %v", file, err)
+		} else if info.Size() == 0 {
+			t.Errorf("profile %s is empty", file)
+		}
+	}
+
+	// Nothing is written without files
+	startPprof("", "")()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+const redactedPassword = "xxxxx"
+
+var (
+	// passwordRe matches the password of a key/value connection string,
+	// quoted or not, or of the query of a URL connection string
+	passwordRe = regexp.MustCompile(`(password\s*=\s*)('(?:\\.|[^'])*'|[^\s&]+)`)
+	// urlPasswordRe matches the password in the user info of a URL connection string
+	urlPasswordRe = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:@/\s]*):[^@\s]*@`)
+)
+
+// redactPasswords replaces the passwords of any connection strings in s, so
+// that s can be logged
+func redactPasswords(s string) string {
+	s = passwordRe.ReplaceAllString(s, "${1}"+redactedPassword)
+	return urlPasswordRe.ReplaceAllString(s, "${1}:"+redactedPassword+"@")
+}
+
+// redactErr returns err with the passwords of connection strings in its
+// message redacted. Database errors may contain the connection string, so
+// they are redacted before being logged or panicked with.
+func redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(redactPasswords(err.Error()))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// rejectErrorPrefix starts the line following each row of a -rejects-file,
+// which holds the error the row was rejected with
+const rejectErrorPrefix = "-- error: "
+
+// rejectedRows keeps count of the rows rejected by the database with
+// -rejects-file, writing them to w if it is set. It is safe for concurrent use.
+type rejectedRows struct {
+	mutex sync.Mutex
+	w     io.Writer
+	rows  uint64
+}
+
+// rejects is the global record of rejected rows
+var rejects = &rejectedRows{}
+
+// rowReject is a row that failed to insert, by its index among the rows of
+// its batch, and the error it failed with
+type rowReject struct {
+	index int
+	err   error
+}
+
+// add records that row of hypertable was rejected with err. It is written to
+// r.w in the input format, without the header, followed by a line holding the
+// error, so that the rejected rows can be loaded again using -header-file once
+// those lines are removed, e.g., with grep -v.
+func (r *rejectedRows) add(hypertable string, row *insertData, err error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rows++
+	if r.w == nil {
+		return nil
+	}
+	msg := strings.Replace(redactErr(err).Error(), "\n", " ", -1)
+	_, werr := fmt.Fprintf(r.w, "%s%s%s\n%s%s%s\n%s%s\n", tagsKey, delimiter, row.tags, hypertable, delimiter, row.fields, rejectErrorPrefix, msg)
+	return werr
+}
+
+func (r *rejectedRows) count() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rows
+}
+
+// rejectRows records the rows of hypertable in rejected, from a batch whose
+// input rows are written, returning the number of rows and metrics they held.
+// With -layout=narrow, an input row is only recorded once even if several of
+// its values were rejected, keeping only the rejected values, since the others
+// were committed and loading them again would duplicate them.
+func rejectRows(hypertable string, written []*insertData, rejected []rowReject) (uint64, uint64) {
+	var metrics uint64
+	var last *insertData
+	var lastErr error
+	var keep map[int]bool
+	flush := func() {
+		if last == nil {
+			return
+		}
+		row := last
+		if layout == layoutNarrow {
+			row = keepValues(last, keep)
+		}
+		if err := rejects.add(hypertable, row, lastErr); err != nil {
+			fatal("could not write rejected rows to rejects file: %v", err)
+		}
+	}
+	for _, rej := range rejected {
+		row := written[rej.index]
+		if layout == layoutNarrow {
+			metrics++
+		} else {
+			metrics += uint64(strings.Count(row.fields, delimiter))
+		}
+		if row != last {
+			flush()
+			last, lastErr, keep = row, rej.err, make(map[int]bool)
+		}
+		if layout == layoutNarrow {
+			keep[valueOrdinal(written, rej.index)] = true
+		}
+	}
+	flush()
+	return metrics, uint64(len(rejected))
+}
+
+// valueOrdinal returns which of the non-NULL field values of its input row
+// the unpivoted row i of written holds, since the unpivoted rows of an input
+// row are consecutive and in the order of its fields
+func valueOrdinal(written []*insertData, i int) int {
+	first := i
+	for first > 0 && written[first-1] == written[i] {
+		first--
+	}
+	return i - first
+}
+
+// keepValues returns a copy of row with only the non-NULL field values whose
+// ordinals are in keep, the others made NULL
+func keepValues(row *insertData, keep map[int]bool) *insertData {
+	values := strings.Split(row.fields, delimiter)
+	n := 0
+	// The first value is the time
+	for i := 1; i < len(values); i++ {
+		if values[i] == "" || values[i] == nullAs {
+			continue
+		}
+		if !keep[n] {
+			values[i] = ""
+		}
+		n++
+	}
+	kept := *row
+	kept.fields = strings.Join(values, delimiter)
+	return &kept
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRejectRows(t *testing.T) {
+	oldRejects, oldLayout := rejects, layout
+	defer func() { rejects, layout = oldRejects, oldLayout }()
+	written := []*insertData{
+		{tags: "hostname=host_0", fields: "100,1,5"},
+		{tags: "hostname=host_1", fields: "100,2,x"},
+		{tags: "hostname=host_2", fields: "100,3,7"},
+	}
+	errBad := errors.New("invalid input syntax for type double precision: \"x\"\nLINE 1")
+
+	cases := []struct {
+		desc        string
+		layout      string
+		written     []*insertData
+		rejected    []rowReject
+		wantMetrics uint64
+		wantRows    uint64
+		want        string
+	}{
+		{
+			desc:        "wide",
+			layout:      layoutWide,
+			written:     written,
+			rejected:    []rowReject{{index: 1, err: errBad}},
+			wantMetrics: 2,
+			wantRows:    1,
+			want:        "tags,hostname=host_1\ncpu,100,2,x\n-- error: invalid input syntax for type double precision: \"x\" LINE 1\n",
+		},
+		{
+			desc:   "narrow",
+			layout: layoutNarrow,
+			// A row per field value
+			written:     []*insertData{written[0], written[0], written[1], written[1]},
+			rejected:    []rowReject{{index: 2, err: errBad}, {index: 3, err: errBad}},
+			wantMetrics: 2,
+			wantRows:    2,
+			want:        "tags,hostname=host_1\ncpu,100,2,x\n-- error: invalid input syntax for type double precision: \"x\" LINE 1\n",
+		},
+		{
+			desc:   "narrow with committed values",
+			layout: layoutNarrow,
+			// Only the second value of the row was rejected
+			written:     []*insertData{written[0], written[0], written[2], written[2]},
+			rejected:    []rowReject{{index: 3, err: errBad}},
+			wantMetrics: 1,
+			wantRows:    1,
+			want:        "tags,hostname=host_2\ncpu,100,,7\n-- error: invalid input syntax for type double precision: \"x\" LINE 1\n",
+		},
+	}
+	for _, c := range cases {
+		var b bytes.Buffer
+		rejects, layout = &rejectedRows{w: &b}, c.layout
+		metrics, rows := rejectRows("cpu", c.written, c.rejected)
+		if metrics != c.wantMetrics || rows != c.wantRows {
+			t.Errorf("%s: incorrect counts: got %d metrics %d rows want %d metrics %d rows", c.desc, metrics, rows, c.wantMetrics, c.wantRows)
+		}
+		if got := b.String(); got != c.want {
+			t.Errorf("%s: incorrect rejects file: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+		if got := rejects.count(); got != 1 {
+			t.Errorf("%s: incorrect rejected rows: got %d want 1", c.desc, got)
+		}
+	}
+}
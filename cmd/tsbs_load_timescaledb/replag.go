@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// replicationLagPeriod is how often the replication lag is measured with
+	// -max-replication-lag
+	replicationLagPeriod = time.Second
+	// defaultReplicationLagQuery measures the replay lag of the most lagging
+	// replica on the primary, in seconds
+	defaultReplicationLagQuery = "SELECT COALESCE(EXTRACT(EPOCH FROM max(replay_lag)), 0) FROM pg_stat_replication"
+)
+
+// lagThrottle pauses reading the input while the replication lag is above
+// max, and resumes it once the lag is back to half of max, so that the load
+// does not stop and start on every measurement around max
+type lagThrottle struct {
+	max    time.Duration
+	lag    func() (time.Duration, error)
+	pause  func(reason string)
+	resume func()
+	paused bool
+}
+
+// check measures the replication lag and pauses or resumes reading the input
+// accordingly. Reading is never held back while the lag cannot be measured.
+func (t *lagThrottle) check() {
+	lag, err := t.lag()
+	if err != nil {
+		warnf("could not measure the replication lag: %v", redactErr(err))
+		if t.paused {
+			t.paused = false
+			t.resume()
+		}
+		return
+	}
+	switch {
+	case !t.paused && lag > t.max:
+		t.paused = true
+		t.pause(fmt.Sprintf("replication lag %v is above -max-replication-lag %v", lag, t.max))
+	case t.paused && lag <= t.max/2:
+		t.paused = false
+		t.resume()
+	}
+}
+
+// run checks the replication lag every replicationLagPeriod until stop is
+// closed, resuming reading if it is paused then
+func (t *lagThrottle) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(replicationLagPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if t.paused {
+				t.resume()
+			}
+			return
+		case <-ticker.C:
+			t.check()
+		}
+	}
+}
+
+// startLagThrottle starts pausing the load while the replication lag measured
+// by query, on the database at connStr, is above max. The returned function
+// stops it.
+func startLagThrottle(connStr, query string, max time.Duration) func() {
+	db, err := sql.Open(driver, connStr)
+	if err != nil {
+		fatal("could not connect to measure the replication lag: %v", redactErr(err))
+		return func() {}
+	}
+	t := &lagThrottle{
+		max: max,
+		lag: func() (time.Duration, error) {
+			var secs float64
+			if err := db.QueryRow(query).Scan(&secs); err != nil {
+				return 0, err
+			}
+			return time.Duration(secs * float64(time.Second)), nil
+		},
+		pause:  loader.PauseScan,
+		resume: loader.ResumeScan,
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.run(stop)
+	}()
+	return func() {
+		close(stop)
+		<-done
+		db.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLagThrottleCheck(t *testing.T) {
+	errLag := errors.New("connection refused")
+	cases := []struct {
+		desc string
+		lags []time.Duration
+		errs []error
+		want []string
+	}{
+		{
+			desc: "below max",
+			lags: []time.Duration{time.Second, 9 * time.Second},
+			want: nil,
+		},
+		{
+			desc: "above max then recovered",
+			lags: []time.Duration{11 * time.Second, 20 * time.Second, 7 * time.Second, 5 * time.Second, 12 * time.Second},
+			want: []string{"pause", "resume", "pause"},
+		},
+		{
+			desc: "lag not measured while paused",
+			lags: []time.Duration{11 * time.Second, 0, 0},
+			errs: []error{nil, errLag, errLag},
+			want: []string{"pause", "resume"},
+		},
+	}
+	for _, c := range cases {
+		var got []string
+		i := 0
+		th := &lagThrottle{
+			max: 10 * time.Second,
+			lag: func() (time.Duration, error) {
+				var err error
+				if i < len(c.errs) {
+					err = c.errs[i]
+				}
+				return c.lags[i], err
+			},
+			pause:  func(string) { got = append(got, "pause") },
+			resume: func() { got = append(got, "resume") },
+		}
+		for i = range c.lags {
+			th.check()
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect actions: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
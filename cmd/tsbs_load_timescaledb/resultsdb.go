@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timescale/tsbs/load"
+)
+
+const (
+	// resultsTable is the hypertable of -results-db that each run is recorded in
+	resultsTable = "tsbs_runs"
+	// resultsDBTimeout bounds how long recording the results may take, so
+	// that an unreachable -results-db does not hold up the end of the run
+	resultsDBTimeout = 10 * time.Second
+)
+
+// createResultsTableSQL creates resultsTable, as a hypertable if the results
+// database has the timescaledb extension
+var createResultsTableSQL = []string{
+	`CREATE TABLE IF NOT EXISTS ` + resultsTable + ` (
+	time TIMESTAMPTZ NOT NULL,
+	workers INTEGER,
+	batch_size INTEGER,
+	rows BIGINT,
+	seconds DOUBLE PRECISION,
+	row_rate DOUBLE PRECISION,
+	col_rate DOUBLE PRECISION,
+	git_commit TEXT
+)`,
+	`DO $$ BEGIN
+	IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+		PERFORM create_hypertable('` + resultsTable + `', 'time', if_not_exists => TRUE);
+	END IF;
+END $$`,
+}
+
+// insertResultsSQL inserts the row of a run into resultsTable
+const insertResultsSQL = "INSERT INTO " + resultsTable + " (time, workers, batch_size, rows, seconds, row_rate, col_rate, git_commit) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+
+// resultsConnStr returns connStr with a connect_timeout of resultsDBTimeout,
+// unless it sets its own. The drivers do not honor a context while connecting.
+func resultsConnStr(connStr string) string {
+	if strings.Contains(connStr, "://") {
+		// Parameters cannot be prepended to a URL
+		return connStr
+	}
+	// Later settings override earlier ones
+	return fmt.Sprintf("connect_timeout=%d %s", int(resultsDBTimeout.Seconds()), connStr)
+}
+
+// recordResults inserts the results r of the run into resultsTable of the
+// database at connStr, creating the table if it does not exist. It gives up
+// after resultsDBTimeout.
+func recordResults(connStr string, r load.RunResults) error {
+	db, err := sql.Open(driver, resultsConnStr(connStr))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), resultsDBTimeout)
+	defer cancel()
+	for _, stmt := range createResultsTableSQL {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err = db.ExecContext(ctx, insertResultsSQL, r.Time, r.Workers, r.BatchSize, r.TotalRows, r.ElapsedSeconds, r.MeanRowRate, r.MeanColRate, r.Build.Commit)
+	return err
+}
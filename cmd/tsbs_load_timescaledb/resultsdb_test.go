@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestResultsConnStr(t *testing.T) {
+	cases := []struct {
+		connStr string
+		want    string
+	}{
+		{connStr: "host=localhost dbname=benchmarks", want: "connect_timeout=10 host=localhost dbname=benchmarks"},
+		{connStr: "host=localhost connect_timeout=2", want: "connect_timeout=10 host=localhost connect_timeout=2"},
+		{connStr: "postgres://localhost/benchmarks", want: "postgres://localhost/benchmarks"},
+	}
+	for _, c := range cases {
+		if got := resultsConnStr(c.connStr); got != c.want {
+			t.Errorf("incorrect connection string for %s: got %s want %s", c.connStr, got, c.want)
+		}
+	}
+}
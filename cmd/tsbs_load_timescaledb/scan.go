@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"hash/fnv"
 	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/timescale/tsbs/load"
 )
@@ -15,80 +18,230 @@ type hostnameIndexer struct {
 
 func (i *hostnameIndexer) GetIndex(item *load.Point) int {
 	p := item.Data.(*point)
-	hostname := strings.SplitN(p.row.tags, ",", 2)[0]
+	hostname := strings.SplitN(p.row.tags, delimiter, 2)[0]
 	h := fnv.New32a()
 	h.Write([]byte(hostname))
 	return int(h.Sum32()) % int(i.partitions)
 }
 
+// hypertableIndexer sends all the rows of a hypertable to the same worker, for
+// -hypertable-affinity
+type hypertableIndexer struct {
+	partitions uint
+}
+
+func (i *hypertableIndexer) GetIndex(item *load.Point) int {
+	h := fnv.New32a()
+	h.Write([]byte(item.Data.(*point).hypertable))
+	return int(h.Sum32() % uint32(i.partitions))
+}
+
 // point is a single row of data keyed by which hypertable it belongs
 type point struct {
 	hypertable string
 	row        *insertData
 }
 
+// tableRows are rows of a single hypertable
+type tableRows struct {
+	hypertable string
+	rows       []*insertData
+}
+
 type hypertableArr struct {
-	m   map[string][]*insertData
-	cnt int
+	m map[string][]*insertData
+	// runs holds the rows instead of m with -ordered, as runs of consecutive
+	// rows of the same hypertable in input order
+	runs []tableRows
+	cnt  int
+	// bytes is the approximate size of the rows of each hypertable
+	bytes    map[string]int
+	maxBytes int
 }
 
 func (ha *hypertableArr) Len() int {
 	return ha.cnt
 }
 
+// Bytes returns the approximate size of the largest hypertable's rows, since
+// each hypertable is written to the database separately.
+func (ha *hypertableArr) Bytes() int {
+	return ha.maxBytes
+}
+
 func (ha *hypertableArr) Append(item *load.Point) {
 	that := item.Data.(*point)
 	k := that.hypertable
-	ha.m[k] = append(ha.m[k], that.row)
+	if ordered {
+		if n := len(ha.runs); n > 0 && ha.runs[n-1].hypertable == k {
+			ha.runs[n-1].rows = append(ha.runs[n-1].rows, that.row)
+		} else {
+			ha.runs = append(ha.runs, tableRows{hypertable: k, rows: []*insertData{that.row}})
+		}
+	} else {
+		ha.m[k] = append(ha.m[k], that.row)
+	}
 	ha.cnt++
+	ha.bytes[k] += len(that.row.tags) + len(that.row.fields)
+	if ha.bytes[k] > ha.maxBytes {
+		ha.maxBytes = ha.bytes[k]
+	}
+}
+
+// tables returns the rows of the batch, grouped by hypertable. With -ordered,
+// the rows are in input order.
+func (ha *hypertableArr) tables() []tableRows {
+	if ordered {
+		return ha.runs
+	}
+	ret := make([]tableRows, 0, len(ha.m))
+	for hypertable, rows := range ha.m {
+		ret = append(ret, tableRows{hypertable: hypertable, rows: rows})
+	}
+	return ret
 }
 
 type factory struct{}
 
 func (f *factory) New() load.Batch {
 	return &hypertableArr{
-		m:   map[string][]*insertData{},
-		cnt: 0,
+		m:     map[string][]*insertData{},
+		cnt:   0,
+		bytes: map[string]int{},
 	}
 }
 
+// parseDelimiter parses the -delimiter flag, which must be a single character
+// other than those used within values. The escape '\t' is accepted for a tab.
+func parseDelimiter(s string) (string, error) {
+	if s == `\t` {
+		s = "\t"
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return "", fmt.Errorf("'%s' is not a single character", s)
+	}
+	if strings.ContainsAny(s, "= \n\r") {
+		return "", fmt.Errorf("'%s' cannot be used as it appears within values", s)
+	}
+	return s, nil
+}
+
+// parquetInput decodes the rows of a Parquet file, with -input-format=parquet,
+// into the same form as those of the text input
+type parquetInput interface {
+	load.PointDecoder
+	// header returns the tags line and table lines of the header that the
+	// Parquet schema is equivalent to
+	header() (string, []string)
+	// fieldTypes returns the column types of the fields whose Parquet type
+	// does not map to the default field type, keyed by table
+	fieldTypes() map[string]map[string]string
+}
+
 type decoder struct {
 	scanner *bufio.Scanner
+	rows    uint64
+	// lines is the number of lines of the input read so far, including its header
+	lines uint64
+	// startLine is the line to resume loading from with -start-line; the rows
+	// before it are skipped on the first Decode
+	startLine uint64
+}
+
+// skipRows reads and discards the rows whose values come before startLine,
+// returning false if the input ended first
+func (d *decoder) skipRows() bool {
+	skipped := uint64(0)
+	for d.lines+2 < d.startLine {
+		if !d.scanner.Scan() || !d.scanner.Scan() {
+			if d.scanner.Err() != nil {
+				fatal("scan error: %v", d.scanner.Err())
+			}
+			warnf("input ended at line %d, before -start-line %d", d.lines, d.startLine)
+			return false
+		}
+		d.lines += 2
+		d.rows++
+		skipped++
+	}
+	infof("skipped %d rows before line %d", skipped, d.startLine)
+	d.startLine = 0
+	return true
 }
 
 const tagsPrefix = tagsKey
 
 func (d *decoder) Decode(_ *bufio.Reader) *load.Point {
-	data := &insertData{}
-	ok := d.scanner.Scan()
-	if !ok && d.scanner.Err() == nil { // nothing scanned & no error = EOF
-		return nil
-	} else if !ok {
-		fatal("scan error: %v", d.scanner.Err())
+	if d.startLine > 0 && !d.skipRows() {
 		return nil
 	}
-
-	// The first line is a CSV line of tags with the first element being "tags"
-	parts := strings.SplitN(d.scanner.Text(), ",", 2) // prefix & then rest of line
-	prefix := parts[0]
-	if prefix != tagsPrefix {
-		fatal("data file in invalid format; got %s expected %s", prefix, tagsPrefix)
-		return nil
+	// Rows of hypertables that are not selected are dropped
+	for {
+		data := &insertData{}
+		ok := d.scanner.Scan()
+		if !ok && d.scanner.Err() == nil { // nothing scanned & no error = EOF
+			return nil
+		} else if !ok {
+			fatal("scan error: %v", d.scanner.Err())
+			return nil
+		}
+
+		// The first line is a CSV line of tags with the first element being "tags"
+		parts := strings.SplitN(d.scanner.Text(), delimiter, 2) // prefix & then rest of line
+		prefix := parts[0]
+		if prefix != tagsPrefix {
+			fatal("data file in invalid format; got %s expected %s", prefix, tagsPrefix)
+			return nil
+		}
+		data.tags = parts[1]
+		d.lines++
+
+		// Scan again to get the data line
+		ok = d.scanner.Scan()
+		if !ok {
+			fatal("scan error: %v", d.scanner.Err())
+			return nil
+		}
+		d.lines++
+		parts = strings.SplitN(d.scanner.Text(), delimiter, 2) // prefix & then rest of line
+		if len(parts) < 2 {
+			fatal("data file in invalid format; line %d has no values: %s", d.lines, d.scanner.Text())
+			return nil
+		}
+		prefix = parts[0]
+		d.rows++
+		if !hypertableSelected(prefix) {
+			atomic.AddUint64(&filteredRows, 1)
+			continue
+		}
+		data.fields = parts[1]
+		if strictColumns {
+			if err := checkFieldCount(prefix, data.fields); err != nil {
+				fatal("input line %d: %v", d.lines, err)
+				return nil
+			}
+		}
+		data.row = d.rows
+		data.line = d.lines
+
+		return load.NewPoint(&point{
+			hypertable: prefix,
+			row:        data,
+		})
 	}
-	data.tags = parts[1]
+}
 
-	// Scan again to get the data line
-	ok = d.scanner.Scan()
-	if !ok {
-		fatal("scan error: %v", d.scanner.Err())
-		return nil
+// checkFieldCount checks that fields, the time and field values of a row of
+// hypertable, has a value for each field of hypertable in the header, for
+// -strict-columns
+func checkFieldCount(hypertable, fields string) error {
+	cols, ok := tableCols[hypertable]
+	if !ok || hypertable == tagsKey {
+		return fmt.Errorf("hypertable %s is not in the header", hypertable)
+	}
+	// The time comes first, followed by a value per field
+	if n := strings.Count(fields, delimiter); n != len(cols) {
+		return fmt.Errorf("row of %s has %d values, expected %d (%s)", hypertable, n, len(cols), strings.Join(cols, delimiter))
 	}
-	parts = strings.SplitN(d.scanner.Text(), ",", 2) // prefix & then rest of line
-	prefix = parts[0]
-	data.fields = parts[1]
-
-	return load.NewPoint(&point{
-		hypertable: prefix,
-		row:        data,
-	})
+	return nil
 }
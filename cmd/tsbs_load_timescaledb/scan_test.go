@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"reflect"
 	"testing"
 
 	"github.com/timescale/tsbs/load"
@@ -64,6 +65,40 @@ func TestHostnameIndexer(t *testing.T) {
 	}
 }
 
+func TestHypertableIndexer(t *testing.T) {
+	tables := make([]string, 1000, 1000)
+	for i := range tables {
+		tables[i] = fmt.Sprintf("table%d", i)
+	}
+	for _, parts := range []uint{1, 2, 10, 100} {
+		indexer := &hypertableIndexer{parts}
+		counts := make([]int, parts, parts)
+		verifier := make(map[string]int)
+		for _, table := range tables {
+			p := &point{hypertable: table, row: &insertData{tags: "host0", fields: "0.0"}}
+			idx := indexer.GetIndex(load.NewPoint(p))
+			if idx >= int(parts) {
+				t.Errorf("got too large a partition: got %d want %d", idx, parts)
+			}
+			counts[idx]++
+			verifier[table] = idx
+		}
+		// with 1000 items, very unlikely some partition is empty
+		for _, c := range counts {
+			if c == 0 {
+				t.Errorf("unlikely result of 0 results in a partition for %d partitions", parts)
+			}
+		}
+		// the same hypertable goes to the same worker whatever its tags
+		for _, table := range tables {
+			p := &point{hypertable: table, row: &insertData{tags: "host1", fields: "1.0"}}
+			if idx := indexer.GetIndex(load.NewPoint(p)); idx != verifier[table] {
+				t.Errorf("indexer returned a different result on %d partitions: got %d want %d", parts, idx, verifier[table])
+			}
+		}
+	}
+}
+
 func TestHypertableArr(t *testing.T) {
 	f := &factory{}
 	ha := f.New().(*hypertableArr)
@@ -83,6 +118,9 @@ func TestHypertableArr(t *testing.T) {
 	if ha.Len() != 1 {
 		t.Errorf("hypertableArr count is not 1 after first append")
 	}
+	if ha.Bytes() != 12 {
+		t.Errorf("hypertableArr bytes is not 12 after first append: got %d", ha.Bytes())
+	}
 	p = &load.Point{
 		Data: &point{
 			hypertable: "table2",
@@ -99,12 +137,46 @@ func TestHypertableArr(t *testing.T) {
 	if len(ha.m) != 2 {
 		t.Errorf("hypertableArr does not have 2 different hypertables")
 	}
+	if ha.Bytes() != 12 {
+		t.Errorf("hypertableArr bytes is not size of largest hypertable: got %d", ha.Bytes())
+	}
+}
+
+func TestHypertableArrOrdered(t *testing.T) {
+	oldOrdered := ordered
+	defer func() { ordered = oldOrdered }()
+	for _, o := range []bool{false, true} {
+		ordered = o
+		ha := (&factory{}).New().(*hypertableArr)
+		for i, table := range []string{"cpu", "cpu", "mem", "cpu"} {
+			ha.Append(load.NewPoint(&point{hypertable: table, row: &insertData{row: uint64(i + 1)}}))
+		}
+		got := make(map[string][]uint64)
+		var order []string
+		for _, tr := range ha.tables() {
+			order = append(order, tr.hypertable)
+			for _, r := range tr.rows {
+				got[tr.hypertable] = append(got[tr.hypertable], r.row)
+			}
+		}
+		want := map[string][]uint64{"cpu": {1, 2, 4}, "mem": {3}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ordered=%v: incorrect rows per hypertable: got %v want %v", o, got, want)
+		}
+		if o && !reflect.DeepEqual(order, []string{"cpu", "mem", "cpu"}) {
+			t.Errorf("ordered=%v: incorrect order of runs: got %v", o, order)
+		}
+		if ha.Len() != 4 {
+			t.Errorf("ordered=%v: incorrect count: got %d want 4", o, ha.Len())
+		}
+	}
 }
 
 func TestDecode(t *testing.T) {
 	cases := []struct {
 		desc        string
 		input       string
+		delimiter   string
 		wantPrefix  string
 		wantFields  string
 		wantTags    string
@@ -117,6 +189,14 @@ func TestDecode(t *testing.T) {
 			wantFields: "140,0.0,0.0",
 			wantTags:   "tag1text,tag2text",
 		},
+		{
+			desc:       "tab delimiter",
+			input:      "tags\ttag1text\ttag2,text\ncpu\t140\t0.0\t0.0\n",
+			delimiter:  "\t",
+			wantPrefix: "cpu",
+			wantFields: "140\t0.0\t0.0",
+			wantTags:   "tag1text\ttag2,text",
+		},
 		{
 			desc:        "incorrect tags prefix",
 			input:       "foo,bar,baz\ncpu,140,0.0,0.0\n",
@@ -127,8 +207,18 @@ func TestDecode(t *testing.T) {
 			input:       "tags,tag1text,tag2text",
 			shouldFatal: true,
 		},
+		{
+			desc:        "values line without values",
+			input:       "tags,tag1text,tag2text\ncpu\n",
+			shouldFatal: true,
+		},
 	}
+	defer func() { delimiter = "," }()
 	for _, c := range cases {
+		delimiter = ","
+		if c.delimiter != "" {
+			delimiter = c.delimiter
+		}
 		br := bufio.NewReader(bytes.NewReader([]byte(c.input)))
 		decoder := &decoder{scanner: bufio.NewScanner(br)}
 		if c.shouldFatal {
@@ -154,6 +244,43 @@ func TestDecode(t *testing.T) {
 			if data.row.tags != c.wantTags {
 				t.Errorf("%s: incorrect tags: got %s want %s", c.desc, data.row.tags, c.wantTags)
 			}
+			if data.row.row != 1 {
+				t.Errorf("%s: incorrect row number: got %d want 1", c.desc, data.row.row)
+			}
+			if data.row.line != 2 {
+				t.Errorf("%s: incorrect line number: got %d want 2", c.desc, data.row.line)
+			}
+		}
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: ",", want: ","},
+		{in: `\t`, want: "\t"},
+		{in: "\t", want: "\t"},
+		{in: "|", want: "|"},
+		{in: "", wantErr: true},
+		{in: ",,", wantErr: true},
+		{in: "=", wantErr: true},
+		{in: " ", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseDelimiter(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error but got none", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+		} else if got != c.want {
+			t.Errorf("%q: incorrect delimiter: got %q want %q", c.in, got, c.want)
 		}
 	}
 }
@@ -169,3 +296,65 @@ func TestDecodeEOF(t *testing.T) {
 		t.Errorf("expected p to be nil, got %v", p)
 	}
 }
+
+func TestCheckFieldCount(t *testing.T) {
+	oldTableCols := tableCols
+	defer func() { tableCols = oldTableCols }()
+	tableCols = map[string][]string{
+		tagsKey: {"hostname"},
+		"cpu":   {"usage_user", "usage_system"},
+	}
+	cases := []struct {
+		desc       string
+		hypertable string
+		fields     string
+		wantErr    bool
+	}{
+		{desc: "all values", hypertable: "cpu", fields: "140,1,2"},
+		{desc: "empty values", hypertable: "cpu", fields: "140,,"},
+		{desc: "too few values", hypertable: "cpu", fields: "140,1", wantErr: true},
+		{desc: "too many values", hypertable: "cpu", fields: "140,1,2,3", wantErr: true},
+		{desc: "unknown hypertable", hypertable: "mem", fields: "140,1,2", wantErr: true},
+		{desc: "tags is not a hypertable", hypertable: tagsKey, fields: "140", wantErr: true},
+	}
+	for _, c := range cases {
+		err := checkFieldCount(c.hypertable, c.fields)
+		if c.wantErr && err == nil {
+			t.Errorf("%s: expected error but got none", c.desc)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestDecodeStartLine(t *testing.T) {
+	input := "tags,host_0\ncpu,100,1\ntags,host_1\ncpu,100,2\ntags,host_2\ncpu,100,3\n"
+	cases := []struct {
+		startLine uint64
+		wantRow   uint64
+	}{
+		{startLine: 1, wantRow: 1},
+		{startLine: 4, wantRow: 2},
+		{startLine: 5, wantRow: 3},
+		{startLine: 6, wantRow: 3},
+		{startLine: 7, wantRow: 0},
+	}
+	for _, c := range cases {
+		br := bufio.NewReader(bytes.NewReader([]byte(input)))
+		decoder := &decoder{scanner: bufio.NewScanner(br), startLine: c.startLine}
+		p := decoder.Decode(br)
+		if c.wantRow == 0 {
+			if p != nil {
+				t.Errorf("start line %d: expected no rows but got %v", c.startLine, p.Data.(*point).row)
+			}
+			continue
+		}
+		if p == nil {
+			t.Errorf("start line %d: expected row %d but got none", c.startLine, c.wantRow)
+			continue
+		}
+		if row := p.Data.(*point).row; row.row != c.wantRow || row.line != 2*c.wantRow {
+			t.Errorf("start line %d: incorrect row: got row %d line %d want row %d line %d", c.startLine, row.row, row.line, c.wantRow, 2*c.wantRow)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/timescale/tsbs/load"
+)
+
+// hostSyncCSIs are the tag ids of each of -postgres-hosts, since each host
+// assigns its own ids in its own tags table
+var hostSyncCSIs []*syncCSI
+
+// parsePostgresHosts parses a comma separated list of connection strings, e.g.,
+// 'host=node1,host=node2 port=5433'. The benchmark database and user are the
+// same on all hosts, so they cannot be set per host.
+func parsePostgresHosts(s string) ([]string, error) {
+	var hosts []string
+	if len(strings.TrimSpace(s)) == 0 {
+		return hosts, nil
+	}
+	re := regexp.MustCompile(`(^|\s)(dbname|user)=`)
+	for _, h := range strings.Split(s, ",") {
+		h = strings.TrimSpace(h)
+		if len(h) == 0 {
+			return nil, fmt.Errorf("empty connection string in '%s'", s)
+		}
+		if re.MatchString(h) {
+			return nil, fmt.Errorf("connection string '%s' cannot set dbname or user; use -db-name and -user", redactPasswords(h))
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// hostFor returns the index of the host, among numHosts, that owns hypertable
+func hostFor(hypertable string, numHosts int) int {
+	h := fnv.New32a()
+	h.Write([]byte(hypertable))
+	return int(h.Sum32() % uint32(numHosts))
+}
+
+// hostConnectString returns the connection string of the benchmark database on
+// the i-th of -postgres-hosts, whose settings override those of -postgres,
+// -host and -port
+func hostConnectString(i int) string {
+	return getConnectString() + " " + postgresHosts[i]
+}
+
+// benchConnectStrings returns the connection strings of the benchmark database
+// on each of -postgres-hosts, or on the single host if it is not set
+func benchConnectStrings() []string {
+	if len(postgresHosts) == 0 {
+		return []string{getConnectString()}
+	}
+	ret := make([]string, len(postgresHosts))
+	for i := range postgresHosts {
+		ret[i] = hostConnectString(i)
+	}
+	return ret
+}
+
+// workerConnectString returns the connection string a worker loads through.
+// With -postgres-hosts, workers are assigned to the hosts in turn.
+func workerConnectString(workerNum int) string {
+	if len(postgresHosts) == 0 {
+		return withStatementTimeout(getConnectString())
+	}
+	return withStatementTimeout(hostConnectString(workerNum % len(postgresHosts)))
+}
+
+// withStatementTimeout sets the statement_timeout of the connections made with
+// connectString to -statement-timeout, if any. Sub-millisecond timeouts are
+// rounded up, since 0 would disable it.
+func withStatementTimeout(connectString string) string {
+	if statementTimeout <= 0 {
+		return connectString
+	}
+	ms := int64((statementTimeout + time.Millisecond - 1) / time.Millisecond)
+	return fmt.Sprintf("%s statement_timeout=%d", connectString, ms)
+}
+
+// shardIndexer sends all rows of a hypertable to the workers of the host that
+// owns it, spreading them among those workers by hostname. Worker i, which
+// reads from queue i, loads into host i modulo the number of hosts.
+type shardIndexer struct {
+	partitions uint
+	hosts      int
+}
+
+func (i *shardIndexer) GetIndex(item *load.Point) int {
+	p := item.Data.(*point)
+	workersPerHost := int(i.partitions) / i.hosts
+	hostname := strings.SplitN(p.row.tags, delimiter, 2)[0]
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	return hostFor(p.hypertable, i.hosts) + i.hosts*int(h.Sum32()%uint32(workersPerHost))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timescale/tsbs/load"
+)
+
+func TestParsePostgresHosts(t *testing.T) {
+	cases := []struct {
+		desc      string
+		in        string
+		want      []string
+		shouldErr bool
+	}{
+		{desc: "empty", in: "", want: nil},
+		{desc: "single", in: "host=node1", want: []string{"host=node1"}},
+		{desc: "several", in: "host=node1, host=node2 port=5433", want: []string{"host=node1", "host=node2 port=5433"}},
+		{desc: "empty entry", in: "host=node1,,host=node2", shouldErr: true},
+		{desc: "dbname", in: "host=node1 dbname=other", shouldErr: true},
+		{desc: "user", in: "user=joe host=node1", shouldErr: true},
+	}
+	for _, c := range cases {
+		got, err := parsePostgresHosts(c.in)
+		if c.shouldErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect hosts: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestShardIndexer(t *testing.T) {
+	const hosts, workers = 3, 6
+	indexer := &shardIndexer{partitions: workers, hosts: hosts}
+	for _, hypertable := range []string{"cpu", "mem", "disk", "net", "redis"} {
+		want := hostFor(hypertable, hosts)
+		used := make(map[int]bool)
+		for i := 0; i < 100; i++ {
+			p := &point{hypertable: hypertable, row: &insertData{tags: fmt.Sprintf("host_%d,foo", i)}}
+			idx := indexer.GetIndex(load.NewPoint(p))
+			if idx < 0 || idx >= workers {
+				t.Fatalf("%s: worker %d out of range", hypertable, idx)
+			}
+			if idx%hosts != want {
+				t.Errorf("%s: row sent to worker %d of host %d, want host %d", hypertable, idx, idx%hosts, want)
+			}
+			used[idx] = true
+		}
+		if len(used) != workers/hosts {
+			t.Errorf("%s: rows sent to %d workers, want %d", hypertable, len(used), workers/hosts)
+		}
+	}
+}
+
+func TestBenchConnectStrings(t *testing.T) {
+	oldHosts := postgresHosts
+	defer func() { postgresHosts = oldHosts }()
+	host = "localhost"
+	user = "postgres"
+	postgresConnect = "sslmode=disable"
+
+	postgresHosts = nil
+	if got, want := benchConnectStrings(), []string{getConnectString()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect connect strings without hosts: got %v want %v", got, want)
+	}
+	if got, want := workerConnectString(3), getConnectString(); got != want {
+		t.Errorf("incorrect worker connect string without hosts: got %s want %s", got, want)
+	}
+
+	postgresHosts = []string{"host=node1", "host=node2 port=5433"}
+	want := []string{getConnectString() + " host=node1", getConnectString() + " host=node2 port=5433"}
+	if got := benchConnectStrings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect connect strings with hosts: got %v want %v", got, want)
+	}
+	if got := workerConnectString(3); got != want[1] {
+		t.Errorf("incorrect worker connect string with hosts: got %s want %s", got, want[1])
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	oldTimeout := statementTimeout
+	defer func() { statementTimeout = oldTimeout }()
+	cases := []struct {
+		timeout time.Duration
+		want    string
+	}{
+		{timeout: 0, want: "host=localhost"},
+		{timeout: 30 * time.Second, want: "host=localhost statement_timeout=30000"},
+		{timeout: 1500 * time.Microsecond, want: "host=localhost statement_timeout=2"},
+		{timeout: time.Nanosecond, want: "host=localhost statement_timeout=1"},
+	}
+	for _, c := range cases {
+		statementTimeout = c.timeout
+		if got := withStatementTimeout("host=localhost"); got != c.want {
+			t.Errorf("%v: incorrect connect string: got %s want %s", c.timeout, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+// skippedBatches keeps count of the batches that failed to load with
+// -continue-on-error, writing their rows to w if it is set, and of the classes
+// of errors they failed with. It is safe for concurrent use.
+type skippedBatches struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	batches uint64
+	rows    uint64
+	errors  map[string]*errorClass
+	// nullRows counts the rows with -layout=narrow whose field values are
+	// all NULL, which have no row to write
+	nullRows uint64
+}
+
+// errorClass counts the skipped batches that failed with errors of the same
+// normalized message
+type errorClass struct {
+	msg     string
+	batches uint64
+	rows    uint64
+}
+
+// skipped is the global record of skipped batches
+var skipped = &skippedBatches{}
+
+// add records that rows failed to load. They are written to s.w in the input
+// format, without the header, so they can be fixed and loaded again using
+// -header-file.
+func (s *skippedBatches) add(hypertable string, rows []*insertData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batches++
+	s.rows += uint64(len(rows))
+	if s.w == nil {
+		return nil
+	}
+	for _, r := range rows {
+		if _, err := fmt.Fprintf(s.w, "%s%s%s\n%s%s%s\n", tagsKey, delimiter, r.tags, hypertable, delimiter, r.fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *skippedBatches) counts() (uint64, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.batches, s.rows
+}
+
+// addNullRows records that n rows were skipped as their field values are all
+// NULL, with -layout=narrow
+func (s *skippedBatches) addNullRows(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nullRows += uint64(n)
+}
+
+func (s *skippedBatches) nullRowCount() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.nullRows
+}
+
+// addError records that a batch of numRows rows failed with an error of class
+// msg, returning whether it is the first to fail with it
+func (s *skippedBatches) addError(msg string, numRows int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.errors == nil {
+		s.errors = make(map[string]*errorClass)
+	}
+	c, ok := s.errors[msg]
+	if !ok {
+		c = &errorClass{msg: msg}
+		s.errors[msg] = c
+	}
+	c.batches++
+	c.rows += uint64(numRows)
+	return !ok
+}
+
+// topErrors returns the n classes of errors the most batches failed with, the
+// most frequent first, and the number of classes left out
+func (s *skippedBatches) topErrors(n int) ([]errorClass, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	classes := make([]errorClass, 0, len(s.errors))
+	for _, c := range s.errors {
+		classes = append(classes, *c)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].batches != classes[j].batches {
+			return classes[i].batches > classes[j].batches
+		}
+		return classes[i].msg < classes[j].msg
+	})
+	if len(classes) <= n {
+		return classes, 0
+	}
+	return classes[:n], len(classes) - n
+}
+
+var (
+	quotedRe = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	numberRe = regexp.MustCompile(`[0-9]+`)
+)
+
+// errorClassOf normalizes the message of err so that errors of the same kind,
+// e.g., the same constraint violated by different rows or connection resets
+// from different addresses, have the same class. The detail of database
+// errors, which describes the failing row, is left out.
+func errorClassOf(err error) string {
+	msg := err.Error()
+	switch e := err.(type) {
+	case *pgconn.PgError:
+		msg = e.Message
+	case *pq.Error:
+		msg = e.Message
+	}
+	msg = quotedRe.ReplaceAllString(redactPasswords(msg), `"?"`)
+	return numberRe.ReplaceAllString(msg, "N")
+}
+
+// copyLineRe matches the context of an error in a COPY, e.g., "COPY cpu, line 3, column usage_user"
+var copyLineRe = regexp.MustCompile(`^COPY [^,]+, line (\d+)`)
+
+// failingRow returns the index of the row of a batch that err, from writing
+// the batch, was caused by, or -1 if it is not known. Only errors in a COPY
+// give the row.
+func failingRow(err error) int {
+	var where string
+	switch e := err.(type) {
+	case *pgconn.PgError:
+		where = e.Where
+	case *pq.Error:
+		where = e.Where
+	}
+	m := copyLineRe.FindStringSubmatch(where)
+	if m == nil {
+		return -1
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line - 1
+}
+
+// describeFailingRow describes the row of rows that err, from writing them,
+// was caused by, or the first row if it is not known
+func describeFailingRow(rows []*insertData, err error) string {
+	desc := "failing row"
+	i := failingRow(err)
+	if i < 0 || i >= len(rows) {
+		desc, i = "first row of batch", 0
+	}
+	return fmt.Sprintf("%s: input row %d (line %d), tags %s fields %s", desc, rows[i].row, rows[i].line, rows[i].tags, rows[i].fields)
+}
+
+// skipBatch logs that rows could not be written to hypertable because of err
+// and records them as skipped, for -continue-on-error. written holds the input
+// row of each row written, which differs from rows with -layout=narrow. With
+// -top-errors, only the first batch to fail with each class of error is logged.
+func skipBatch(hypertable string, rows, written []*insertData, err error) {
+	first := skipped.addError(errorClassOf(err), len(rows))
+	if topErrors == 0 || first {
+		warnf("skipping batch of %d rows for %s: %v; %s", len(rows), hypertable, redactErr(err), describeFailingRow(written, err))
+	}
+	if err := skipped.add(hypertable, rows); err != nil {
+		fatal("could not write skipped rows to error file: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+func TestSkippedBatchesAdd(t *testing.T) {
+	var b bytes.Buffer
+	s := &skippedBatches{w: &b}
+	rows := []*insertData{
+		{tags: "hostname=host_0", fields: "100,1,5"},
+		{tags: "hostname=host_1", fields: "100,2,x"},
+	}
+	if err := s.add("cpu", rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.add("mem", rows[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "tags,hostname=host_0\ncpu,100,1,5\ntags,hostname=host_1\ncpu,100,2,x\ntags,hostname=host_0\nmem,100,1,5\n"
+	if got := b.String(); got != want {
+		t.Errorf("incorrect error file: got\n%s\nwant\n%s", got, want)
+	}
+	if batches, n := s.counts(); batches != 2 || n != 3 {
+		t.Errorf("incorrect counts: got %d batches %d rows want 2 batches 3 rows", batches, n)
+	}
+}
+
+func TestFailingRow(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		want int
+	}{
+		{
+			desc: "pgx copy error",
+			err:  &pgconn.PgError{Message: "invalid input syntax for type double precision", Where: "COPY cpu, line 3, column usage_user: \"x\""},
+			want: 2,
+		},
+		{
+			desc: "pq copy error",
+			err:  &pq.Error{Message: "null value in column", Where: "COPY cpu, line 1"},
+			want: 0,
+		},
+		{
+			desc: "error outside of copy",
+			err:  &pgconn.PgError{Message: "relation does not exist"},
+			want: -1,
+		},
+		{
+			desc: "not a database error",
+			err:  errors.New("connection reset"),
+			want: -1,
+		},
+	}
+	for _, c := range cases {
+		if got := failingRow(c.err); got != c.want {
+			t.Errorf("%s: incorrect row: got %d want %d", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestErrorClassOf(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		want string
+	}{
+		{
+			desc: "duplicate key",
+			err:  &pgconn.PgError{Message: `duplicate key value violates unique constraint "cpu_pkey"`, Detail: "Key (time, tags_id)=(2016-01-01 00:00:00+00, 3) already exists."},
+			want: `duplicate key value violates unique constraint "?"`,
+		},
+		{
+			desc: "invalid value",
+			err:  &pq.Error{Message: `invalid input syntax for type double precision: "x1"`},
+			want: `invalid input syntax for type double precision: "?"`,
+		},
+		{
+			desc: "connection reset",
+			err:  errors.New("read tcp 10.0.0.1:41234->10.0.0.2:5432: read: connection reset by peer"),
+			want: "read tcp N.N.N.N:N->N.N.N.N:N: read: connection reset by peer",
+		},
+	}
+	for _, c := range cases {
+		if got := errorClassOf(c.err); got != c.want {
+			t.Errorf("%s: incorrect class: got %s want %s", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestTopErrors(t *testing.T) {
+	s := &skippedBatches{}
+	for i, msg := range []string{"b", "a", "c", "a", "b", "a"} {
+		first := s.addError(msg, 10)
+		if wantFirst := i < 3; first != wantFirst {
+			t.Errorf("batch %d: incorrect first: got %v want %v", i, first, wantFirst)
+		}
+	}
+	classes, others := s.topErrors(2)
+	want := []errorClass{{msg: "a", batches: 3, rows: 30}, {msg: "b", batches: 2, rows: 20}}
+	if !reflect.DeepEqual(classes, want) || others != 1 {
+		t.Errorf("incorrect top errors: got %v and %d others want %v and 1 other", classes, others, want)
+	}
+	if classes, others := s.topErrors(5); len(classes) != 3 || others != 0 {
+		t.Errorf("incorrect top errors: got %d classes and %d others want 3 and 0", len(classes), others)
+	}
+}
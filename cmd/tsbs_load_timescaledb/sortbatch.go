@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// batchSortTime is the total time, in nanoseconds, that workers spent sorting
+// batches with -sort-batch, updated atomically
+var batchSortTime int64
+
+// sortByTime stably sorts dataRows by their time value, which comes first,
+// returning them along with rows, the input row of each, in the same order.
+// The time it takes is added to batchSortTime.
+func sortByTime(rows []*insertData, dataRows [][]interface{}) ([]*insertData, [][]interface{}) {
+	start := time.Now()
+	keys := make([]int64, len(dataRows))
+	idx := make([]int, len(dataRows))
+	for i, r := range dataRows {
+		keys[i] = timeSortKey(r[0])
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return keys[idx[a]] < keys[idx[b]] })
+
+	sortedRows := make([]*insertData, len(rows))
+	sortedData := make([][]interface{}, len(dataRows))
+	for i, j := range idx {
+		sortedRows[i] = rows[j]
+		sortedData[i] = dataRows[j]
+	}
+	atomic.AddInt64(&batchSortTime, int64(time.Since(start)))
+	return sortedRows, sortedData
+}
+
+// timeSortKey returns a time value as returned by parseTime as nanoseconds
+// since the epoch. RFC3339 timestamps kept as strings for timestamptz were
+// already checked to parse.
+func timeSortKey(v interface{}) int64 {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UnixNano()
+	case int64:
+		return v
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t.UnixNano()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortByTime(t *testing.T) {
+	t0 := time.Unix(1451606400, 0)
+	cases := []struct {
+		desc  string
+		times []interface{}
+		want  []uint64
+	}{
+		{
+			desc:  "timestamps",
+			times: []interface{}{t0.Add(2 * time.Second), t0, t0.Add(time.Second)},
+			want:  []uint64{2, 3, 1},
+		},
+		{
+			desc:  "bigint, stable on ties",
+			times: []interface{}{int64(20), int64(10), int64(20), int64(5)},
+			want:  []uint64{4, 2, 1, 3},
+		},
+		{
+			desc:  "RFC3339 strings with different offsets",
+			times: []interface{}{"2016-01-01T01:00:00+02:00", "2016-01-01T00:00:00Z", "2016-01-01T00:30:00.5Z"},
+			want:  []uint64{1, 2, 3},
+		},
+	}
+	for _, c := range cases {
+		rows := make([]*insertData, len(c.times))
+		dataRows := make([][]interface{}, len(c.times))
+		for i, ts := range c.times {
+			rows[i] = &insertData{row: uint64(i + 1)}
+			dataRows[i] = []interface{}{ts, uint64(i + 1)}
+		}
+		gotRows, gotData := sortByTime(rows, dataRows)
+		var got []uint64
+		for i, r := range gotRows {
+			got = append(got, r.row)
+			if gotData[i][1] != r.row {
+				t.Errorf("%s: row %d does not match its data row %v", c.desc, r.row, gotData[i])
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect order: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	targetTimescaleDB = "timescaledb"
+	targetQuestDB     = "questdb"
+)
+
+// schema describes the tables to create for the data being loaded
+type schema struct {
+	// createTags is false when an existing tags table is appended to
+	createTags bool
+	tagNames   []string
+	tagTypes   []string
+	tables     []schemaTable
+}
+
+// schemaTable describes a data table, with its field and index definitions
+// given as PostgreSQL column types and CREATE INDEX statements
+type schemaTable struct {
+	name      string
+	fieldDefs []string
+	indexDefs []string
+}
+
+// Loader is the part of loading that differs between the databases the data
+// can be loaded into over the PostgreSQL wire protocol, selected with -target.
+type Loader interface {
+	// HasDatabases returns whether the benchmark database can be created and
+	// dropped, rather than the tables being created in a fixed database
+	HasDatabases() bool
+	// CreateSchema creates the tags table and data tables described by s
+	CreateSchema(db *sql.DB, d *dbCreator, s *schema)
+	// InsertTags adds tagRows to the tags table, returning a map from the
+	// primary tag value of each inserted row to its id
+	InsertTags(db *sql.DB, tagRows [][]string) map[string]int64
+	// WriteBatch writes rows of the given columns to table using p's connection
+	WriteBatch(p *processor, table string, cols []string, rows [][]interface{}) error
+	// Finish is called once all data has been loaded
+	Finish(d *dbCreator)
+}
+
+// newLoader returns the Loader for the -target name
+func newLoader(name string) (Loader, error) {
+	switch name {
+	case targetTimescaleDB:
+		return &timescaleLoader{}, nil
+	case targetQuestDB:
+		return &questdbLoader{}, nil
+	default:
+		return nil, fmt.Errorf("unknown target '%s'", name)
+	}
+}
+
+// timescaleLoader loads data into TimescaleDB hypertables, or plain
+// PostgreSQL tables with -use-hypertable=false
+type timescaleLoader struct{}
+
+func (l *timescaleLoader) HasDatabases() bool {
+	return true
+}
+
+func (l *timescaleLoader) CreateSchema(db *sql.DB, d *dbCreator, s *schema) {
+	if s.createTags {
+		createTagsTable(db, s.tagNames, s.tagTypes)
+	}
+	for _, t := range s.tables {
+		d.createTableAndIndexes(db, t.name, t.fieldDefs, t.indexDefs)
+	}
+	if d.indexesCreated > 0 && !printDDL {
+		loader.Reportf("created %d indexes in %0.3fsec\n", d.indexesCreated, d.indexBuildTime.Seconds())
+	}
+}
+
+func (l *timescaleLoader) InsertTags(db *sql.DB, tagRows [][]string) map[string]int64 {
+	return insertTags(db, tagRows, true)
+}
+
+func (l *timescaleLoader) WriteBatch(p *processor, table string, cols []string, rows [][]interface{}) error {
+	return p.writeRows(table, cols, rows)
+}
+
+func (l *timescaleLoader) Finish(d *dbCreator) {
+	if !indexAfterLoad {
+		return
+	}
+	start := time.Now()
+	created := d.createDeferredIndexes()
+	took := time.Since(start)
+	loader.Reportf("created %d indexes after load in %0.3fsec\n", created, took.Seconds())
+}
+
+// questdbLoader loads data into QuestDB. QuestDB has no separate databases,
+// sequences, RETURNING or COPY, so tag ids are assigned by the loader and rows
+// are written with multi-row INSERT statements. Indexes and TimescaleDB
+// features such as hypertables and compression do not apply.
+type questdbLoader struct {
+	// lastTagID is the id of the last tag set inserted, updated atomically
+	lastTagID int64
+}
+
+func (l *questdbLoader) HasDatabases() bool {
+	return false
+}
+
+func (l *questdbLoader) CreateSchema(db *sql.DB, d *dbCreator, s *schema) {
+	if s.createTags {
+		MustExecDDL(db, "DROP TABLE IF EXISTS tags")
+		MustExecDDL(db, questdbTagsTableQuery(s.tagNames, s.tagTypes))
+	}
+	for _, t := range s.tables {
+		MustExecDDL(db, fmt.Sprintf("DROP TABLE IF EXISTS %s", pq.QuoteIdentifier(t.name)))
+		MustExecDDL(db, questdbTableQuery(t.name, t.fieldDefs))
+	}
+}
+
+func (l *questdbLoader) InsertTags(db *sql.DB, tagRows [][]string) map[string]int64 {
+	commonTagsLen := len(tableCols[tagsKey])
+	values := make([]string, 0, len(tagRows))
+	ret := make(map[string]int64, len(tagRows))
+	for _, row := range tagRows {
+		id := atomic.AddInt64(&l.lastTagID, 1)
+		sqlValues := convertValsToSQLBasedOnType(row[:commonTagsLen], tagColumnTypes[:commonTagsLen])
+		values = append(values, fmt.Sprintf("(%d,%s)", id, strings.Join(sqlValues, ",")))
+		ret[row[0]] = id
+	}
+	ctx := loader.Context()
+	_, err := db.ExecContext(ctx, fmt.Sprintf("INSERT INTO tags(id,%s) VALUES %s", strings.Join(quoteIdentifiers(tableCols[tagsKey]), ","), strings.Join(values, ",")))
+	if err != nil {
+		if ctx.Err() != nil {
+			// The load timed out; its batches are aborted as well
+			return nil
+		}
+		fatal("could not insert tags: %v", redactErr(err))
+		return nil
+	}
+	return ret
+}
+
+func (l *questdbLoader) WriteBatch(p *processor, table string, cols []string, rows [][]interface{}) error {
+	return p.insertRows(table, cols, rows)
+}
+
+func (l *questdbLoader) Finish(_ *dbCreator) {}
+
+// questdbTagsTableQuery returns the CREATE TABLE statement for the tags table
+func questdbTagsTableQuery(tagNames, tagTypes []string) string {
+	defs := make([]string, len(tagNames))
+	for i, tagName := range tagNames {
+		defs[i] = fmt.Sprintf("%s %s", pq.QuoteIdentifier(tagName), questdbType(serializedTypeToPgType(tagTypes[i])))
+	}
+	return fmt.Sprintf("CREATE TABLE tags(id LONG, %s)", strings.Join(defs, ", "))
+}
+
+// questdbTableQuery returns the CREATE TABLE statement for a data table with
+// the given field definitions, partitioned by day on the time column
+func questdbTableQuery(tableName string, fieldDefs []string) string {
+	defs := make([]string, len(fieldDefs))
+	for i, fieldDef := range fieldDefs {
+		parts := strings.SplitN(fieldDef, " ", 2)
+		defs[i] = fmt.Sprintf("%s %s", pq.QuoteIdentifier(parts[0]), questdbType(parts[1]))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (time TIMESTAMP, tags_id LONG, %s, additional_tags STRING) timestamp(time) PARTITION BY DAY",
+		pq.QuoteIdentifier(tableName), strings.Join(defs, ","))
+}
+
+// questdbType returns the QuestDB column type for a PostgreSQL column type.
+// Text is stored as SYMBOL, QuestDB's type for repeated string values such as
+// tags. Unknown types are assumed to be valid QuestDB types.
+func questdbType(pgType string) string {
+	switch strings.ToUpper(pgType) {
+	case "DOUBLE PRECISION":
+		return "DOUBLE"
+	case "TEXT":
+		return "SYMBOL"
+	case "BIGINT":
+		return "LONG"
+	case "INTEGER":
+		return "INT"
+	default:
+		return pgType
+	}
+}
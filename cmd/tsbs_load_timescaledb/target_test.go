@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestNewLoader(t *testing.T) {
+	if l, err := newLoader(targetTimescaleDB); err != nil || !l.HasDatabases() {
+		t.Errorf("incorrect timescaledb loader: got %v, err %v", l, err)
+	}
+	if l, err := newLoader(targetQuestDB); err != nil || l.HasDatabases() {
+		t.Errorf("incorrect questdb loader: got %v, err %v", l, err)
+	}
+	if _, err := newLoader("influx"); err == nil {
+		t.Errorf("expected error for unknown target but got none")
+	}
+}
+
+func TestQuestdbTableQuery(t *testing.T) {
+	fieldDefs := []string{"hostname TEXT", "usage_user DOUBLE PRECISION", "usage_count BIGINT", "created_at TIMESTAMP"}
+	want := `CREATE TABLE "cpu" (time TIMESTAMP, tags_id LONG, "hostname" SYMBOL,"usage_user" DOUBLE,"usage_count" LONG,"created_at" TIMESTAMP, additional_tags STRING) timestamp(time) PARTITION BY DAY`
+	if got := questdbTableQuery("cpu", fieldDefs); got != want {
+		t.Errorf("incorrect query: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestQuestdbTagsTableQuery(t *testing.T) {
+	want := `CREATE TABLE tags(id LONG, "hostname" SYMBOL, "rack" INT, "load" DOUBLE)`
+	got := questdbTagsTableQuery([]string{"hostname", "rack", "load"}, []string{"string", "int32", "float64"})
+	if got != want {
+		t.Errorf("incorrect query: got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// tableRowCounts keeps a row count per table. It is safe for concurrent use.
+type tableRowCounts struct {
+	mutex sync.Mutex
+	m     map[string]uint64
+}
+
+func newTableRowCounts() *tableRowCounts {
+	return &tableRowCounts{m: make(map[string]uint64)}
+}
+
+func (c *tableRowCounts) add(table string, n uint64) {
+	c.mutex.Lock()
+	c.m[table] += n
+	c.mutex.Unlock()
+}
+
+func (c *tableRowCounts) get(table string) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.m[table]
+}
+
+func (c *tableRowCounts) total() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	total := uint64(0)
+	for _, n := range c.m {
+		total += n
+	}
+	return total
+}
+
+// duplicateRows counts rows skipped by -on-conflict because a row with the
+// same time and tags already existed
+var duplicateRows = newTableRowCounts()
+
+// rowCountMismatch is a hypertable whose row count after the load differs
+// from what the loader sent
+type rowCountMismatch struct {
+	table string
+	want  uint64
+	got   uint64
+}
+
+// expectedRowCount returns how many rows table should hold after the load,
+// given that it held initial rows beforehand and the workers sent it loaded rows.
+func expectedRowCount(table string, initial, loaded uint64) uint64 {
+	return initial + loaded - duplicateRows.get(table)
+}
+
+// verifyRowCounts compares the number of rows in each hypertable with the
+// number the loader wrote to it, returning any that differ.
+func (d *dbCreator) verifyRowCounts() []rowCountMismatch {
+	dbBench := getSharedPool()
+
+	tables := make([]string, 0, len(tableCols))
+	for table := range tableCols {
+		if table != tagsKey {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	var mismatches []rowCountMismatch
+	for _, table := range tables {
+		want := expectedRowCount(table, d.initialRows[table], loader.TableRows(table))
+		got := countRows(dbBench, table)
+		if got != want {
+			mismatches = append(mismatches, rowCountMismatch{table: table, want: want, got: got})
+		}
+	}
+	return mismatches
+}
+
+// countRows returns the number of rows in table
+func countRows(db *sql.DB, table string) uint64 {
+	var cnt uint64
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", pq.QuoteIdentifier(table))).Scan(&cnt); err != nil {
+		fatal("could not count rows of %s: %v", table, redactErr(err))
+	}
+	return cnt
+}
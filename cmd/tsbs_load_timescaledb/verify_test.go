@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestExpectedRowCount(t *testing.T) {
+	oldDuplicate := duplicateRows
+	defer func() { duplicateRows = oldDuplicate }()
+	duplicateRows = newTableRowCounts()
+	duplicateRows.add("mem", 1)
+	duplicateRows.add("mem", 1)
+
+	cases := []struct {
+		desc    string
+		table   string
+		initial uint64
+		loaded  uint64
+		want    uint64
+	}{
+		{desc: "loaded only", table: "cpu", loaded: 15, want: 15},
+		{desc: "with initial rows", table: "cpu", initial: 100, loaded: 15, want: 115},
+		{desc: "with duplicates", table: "mem", loaded: 7, want: 5},
+		{desc: "nothing loaded", table: "disk", initial: 3, want: 3},
+	}
+	for _, c := range cases {
+		if got := expectedRowCount(c.table, c.initial, c.loaded); got != c.want {
+			t.Errorf("%s: incorrect row count: got %d want %d", c.desc, got, c.want)
+		}
+	}
+	if got := duplicateRows.total(); got != 2 {
+		t.Errorf("incorrect total: got %d want %d", got, 2)
+	}
+}
@@ -25,5 +25,7 @@ require (
 	github.com/spf13/viper v1.4.0
 	github.com/transceptor-technology/go-qpack v0.0.0-20190116123619-49a14b216a45
 	github.com/valyala/fasthttp v1.4.0
+	github.com/xitongsys/parquet-go v1.5.4
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
 	google.golang.org/appengine v1.6.1 // indirect
 )
@@ -1,15 +1,27 @@
 package utils
 
 import (
+	"strings"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// envPrefix is the prefix of the environment variables that flags are read
+// from, e.g., TSBS_DB_NAME for --db-name
+const envPrefix = "TSBS"
+
 // SetupConfigFile defines the settings for the configuration file support.
+// Flags that are not set on the command line are read from the environment
+// variable named after them, and then from the configuration file.
 func SetupConfigFile() error {
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
 
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
 	viper.BindPFlags(pflag.CommandLine)
 
 	if err := viper.ReadInConfig(); err != nil {
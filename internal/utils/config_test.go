@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestSetupConfigFileEnv(t *testing.T) {
+	pflag.String("test-env-unset", "default", "")
+	pflag.String("test-env-set", "default", "")
+	pflag.String("test-env-flag", "default", "")
+	if err := pflag.CommandLine.Set("test-env-flag", "flag"); err != nil {
+		t.Fatalf("cannot set flag: %v", err)
+	}
+	os.Setenv("TSBS_TEST_ENV_SET", "env")
+	os.Setenv("TSBS_TEST_ENV_FLAG", "env")
+	defer os.Unsetenv("TSBS_TEST_ENV_SET")
+	defer os.Unsetenv("TSBS_TEST_ENV_FLAG")
+
+	if err := SetupConfigFile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		flag string
+		want string
+	}{
+		{flag: "test-env-unset", want: "default"},
+		{flag: "test-env-set", want: "env"},
+		{flag: "test-env-flag", want: "flag"},
+	}
+	for _, c := range cases {
+		if got := viper.GetString(c.flag); got != c.want {
+			t.Errorf("%s: incorrect value: got %s want %s", c.flag, got, c.want)
+		}
+	}
+}
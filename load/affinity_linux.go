@@ -0,0 +1,45 @@
+package load
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// cpuSet is a CPU affinity mask of up to 1024 CPUs, the size of glibc's cpu_set_t
+type cpuSet [1024 / 64]uint64
+
+// schedAffinity gets or sets, depending on trap, the affinity of the calling thread
+func schedAffinity(trap uintptr, set *cpuSet) error {
+	// A pid of 0 is the calling thread
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*set), uintptr(unsafe.Pointer(set)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// allowedCPUs returns the CPUs the calling thread may run on, which are those
+// of the process unless the thread was pinned
+func allowedCPUs() ([]int, error) {
+	var set cpuSet
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &set); err != nil {
+		return nil, err
+	}
+	var cpus []int
+	for i, word := range set {
+		for bit := uint(0); bit < 64; bit++ {
+			if word&(1<<bit) != 0 {
+				cpus = append(cpus, i*64+int(bit))
+			}
+		}
+	}
+	return cpus, nil
+}
+
+// pinThread restricts the calling thread to cpu. The calling goroutine must be
+// locked to its thread.
+func pinThread(cpu int) error {
+	var set cpuSet
+	set[cpu/64] |= 1 << uint(cpu%64)
+	return schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &set)
+}
@@ -0,0 +1,36 @@
+package load
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestPinThread(t *testing.T) {
+	cpus, err := allowedCPUs()
+	if err != nil {
+		t.Fatalf("cannot get allowed CPUs: %v", err)
+	}
+	if len(cpus) == 0 {
+		t.Fatalf("no allowed CPUs")
+	}
+	want := []int{cpus[len(cpus)-1]}
+	got := make(chan []int)
+	go func() {
+		// Not unlocked, so the pinned thread exits with the goroutine
+		runtime.LockOSThread()
+		if err := pinThread(want[0]); err != nil {
+			t.Errorf("cannot pin thread: %v", err)
+			got <- nil
+			return
+		}
+		pinned, err := allowedCPUs()
+		if err != nil {
+			t.Errorf("cannot get allowed CPUs of pinned thread: %v", err)
+		}
+		got <- pinned
+	}()
+	if pinned := <-got; pinned != nil && !reflect.DeepEqual(pinned, want) {
+		t.Errorf("incorrect CPUs of pinned thread: got %v want %v", pinned, want)
+	}
+}
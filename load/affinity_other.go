@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package load
+
+import "errors"
+
+var errPinUnsupported = errors.New("pinning workers to CPUs is only supported on Linux")
+
+func allowedCPUs() ([]int, error) {
+	return nil, errPinUnsupported
+}
+
+func pinThread(cpu int) error {
+	return errPinUnsupported
+}
@@ -0,0 +1,79 @@
+package load
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// autotuneStartSize is the batch size that --autotune-batch starts from
+	autotuneStartSize = 100
+	// autotuneMaxSize is the largest batch size that --autotune-batch tries
+	autotuneMaxSize = 1 << 20
+	// autotuneSamples is the number of batches measured at each batch size
+	autotuneSamples = 10
+	// autotuneMinGain is the relative improvement in throughput needed to keep
+	// doubling the batch size
+	autotuneMinGain = 0.05
+)
+
+// batchTuner picks the batch size for --autotune-batch. Starting from
+// autotuneStartSize, it doubles the size after each autotuneSamples batches
+// while the throughput of the workers, measured from the time they take to
+// process each batch, keeps improving. It then settles on the best size seen
+// for the rest of the load. It is safe for concurrent use.
+type batchTuner struct {
+	size uint64 // current batch size, read by the scanner without locking
+
+	mutex    sync.Mutex
+	settled  bool
+	samples  int
+	items    uint64
+	busy     time.Duration
+	bestSize uint64
+	bestRate float64
+}
+
+func newBatchTuner() *batchTuner {
+	return &batchTuner{size: autotuneStartSize}
+}
+
+// batchSize returns the number of items to send in each batch
+func (t *batchTuner) batchSize() uint {
+	return uint(atomic.LoadUint64(&t.size))
+}
+
+// record feeds back that a worker took latency to process a batch of items.
+// Batches of another size than the current one, such as those filled before
+// the size last changed or the last partial batch, are not measured.
+func (t *batchTuner) record(items int, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	size := atomic.LoadUint64(&t.size)
+	if t.settled || uint64(items) != size {
+		return
+	}
+	t.samples++
+	t.items += uint64(items)
+	t.busy += latency
+	if t.samples < autotuneSamples {
+		return
+	}
+
+	rate := float64(t.items) / t.busy.Seconds()
+	log.Printf("autotune: batch size %d: %0.2f items/sec per worker", size, rate)
+	improved := rate > t.bestRate*(1+autotuneMinGain)
+	if improved {
+		t.bestSize, t.bestRate = size, rate
+	}
+	if !improved || size*2 > autotuneMaxSize {
+		t.settled = true
+		atomic.StoreUint64(&t.size, t.bestSize)
+		log.Printf("autotune: settled on batch size %d", t.bestSize)
+		return
+	}
+	t.samples, t.items, t.busy = 0, 0, 0
+	atomic.StoreUint64(&t.size, size*2)
+}
@@ -0,0 +1,47 @@
+package load
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchTuner(t *testing.T) {
+	// Each batch has a fixed overhead plus a cost per item, so throughput
+	// improves less and less as the batch size doubles
+	latency := func(items uint) time.Duration {
+		return 10*time.Millisecond + time.Duration(items)*time.Microsecond
+	}
+	tuner := newBatchTuner()
+	if got := tuner.batchSize(); got != autotuneStartSize {
+		t.Fatalf("incorrect initial batch size: got %d want %d", got, autotuneStartSize)
+	}
+	for i := 0; i < 1000 && !tuner.settled; i++ {
+		size := tuner.batchSize()
+		// Batches of a stale size are ignored
+		tuner.record(int(size)/2, time.Nanosecond)
+		tuner.record(int(size), latency(size))
+	}
+	if !tuner.settled {
+		t.Fatalf("tuner did not settle")
+	}
+	if got, want := tuner.batchSize(), uint(102400); got != want {
+		t.Errorf("incorrect settled batch size: got %d want %d", got, want)
+	}
+	// Once settled, the batch size no longer changes
+	tuner.record(102400, time.Nanosecond)
+	if got, want := tuner.batchSize(), uint(102400); got != want {
+		t.Errorf("batch size changed after settling: got %d want %d", got, want)
+	}
+}
+
+func TestBatchTunerMaxSize(t *testing.T) {
+	tuner := newBatchTuner()
+	for i := 0; i < 1000 && !tuner.settled; i++ {
+		size := tuner.batchSize()
+		// Throughput always improves with the batch size
+		tuner.record(int(size), time.Second)
+	}
+	if got := tuner.batchSize(); got > autotuneMaxSize || got*2 <= autotuneMaxSize {
+		t.Errorf("incorrect settled batch size: got %d want largest below %d", got, autotuneMaxSize)
+	}
+}
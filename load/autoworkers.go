@@ -0,0 +1,174 @@
+package load
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// autoWorkersStart is the number of workers --auto-workers starts with
+	autoWorkersStart = 2
+	// autoWorkersPeriod is how often --auto-workers samples the work queue
+	autoWorkersPeriod = time.Second
+	// autoWorkersSamples is the number of consecutive samples for which the
+	// work queue must stay full (or empty) for a worker to be started (or stopped)
+	autoWorkersSamples = 5
+)
+
+// workerScaler starts and stops workers for --auto-workers, between one and
+// --workers, according to the pressure on the work queue. A queue that stays
+// full means the workers cannot keep up with the input, so a worker is
+// started, while one that stays empty means the workers are idle, so one of
+// them is stopped between batches. Worker numbers are reused, so they stay
+// below --workers.
+type workerScaler struct {
+	c     *duplexChannel
+	max   int
+	spawn func(workerNum int, retire <-chan struct{})
+	// retire is received from by an idle worker to stop it
+	retire chan struct{}
+
+	mutex   sync.Mutex
+	free    []int // worker numbers not in use, lowest first
+	running int
+	peak    int
+
+	// full and empty are the numbers of consecutive samples the queue was full or empty
+	full  int
+	empty int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newWorkerScaler returns a workerScaler of up to max workers reading from c,
+// each started with spawn
+func newWorkerScaler(c *duplexChannel, max int, spawn func(workerNum int, retire <-chan struct{})) *workerScaler {
+	s := &workerScaler{
+		c:      c,
+		max:    max,
+		spawn:  spawn,
+		retire: make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < max; i++ {
+		s.free = append(s.free, i)
+	}
+	return s
+}
+
+// start starts n workers, or max if it is less, and begins scaling them
+func (s *workerScaler) start(n int) {
+	if n > s.max {
+		n = s.max
+	}
+	for i := 0; i < n; i++ {
+		s.add()
+	}
+	log.Printf("auto-workers: starting with %d workers, up to %d", s.running, s.max)
+	go s.run()
+}
+
+// add starts a worker, returning whether there was a worker number free for it
+func (s *workerScaler) add() bool {
+	s.mutex.Lock()
+	if len(s.free) == 0 {
+		// A stopped worker has not released its number yet
+		s.mutex.Unlock()
+		return false
+	}
+	workerNum := s.free[0]
+	s.free = s.free[1:]
+	s.running++
+	if s.running > s.peak {
+		s.peak = s.running
+	}
+	s.mutex.Unlock()
+	s.spawn(workerNum, s.retire)
+	return true
+}
+
+// release returns the number of a worker that stopped
+func (s *workerScaler) release(workerNum int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := 0
+	for i < len(s.free) && s.free[i] < workerNum {
+		i++
+	}
+	s.free = append(s.free[:i], append([]int{workerNum}, s.free[i:]...)...)
+}
+
+// sample records the number of batches queued out of capacity, returning 1 if
+// a worker should be started, -1 if one should be stopped and 0 otherwise
+func (s *workerScaler) sample(queued, capacity int) int {
+	switch {
+	case queued >= capacity:
+		s.full, s.empty = s.full+1, 0
+	case queued == 0:
+		s.full, s.empty = 0, s.empty+1
+	default:
+		s.full, s.empty = 0, 0
+	}
+	if s.full >= autoWorkersSamples {
+		s.full = 0
+		return 1
+	}
+	if s.empty >= autoWorkersSamples {
+		s.empty = 0
+		return -1
+	}
+	return 0
+}
+
+// run samples the work queue every autoWorkersPeriod until stopped
+func (s *workerScaler) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(autoWorkersPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		switch s.sample(len(s.c.toWorker), cap(s.c.toWorker)) {
+		case 1:
+			if s.workers() < s.max && s.add() {
+				log.Printf("auto-workers: work queue stayed full, started a worker (%d workers)", s.workers())
+			}
+		case -1:
+			if s.workers() <= 1 {
+				continue
+			}
+			select {
+			case s.retire <- struct{}{}:
+				s.mutex.Lock()
+				s.running--
+				s.mutex.Unlock()
+				log.Printf("auto-workers: work queue stayed empty, stopped a worker (%d workers)", s.workers())
+			default:
+				// No worker is idle after all
+			}
+		}
+	}
+}
+
+// workers returns the number of workers running
+func (s *workerScaler) workers() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.running
+}
+
+// finish stops scaling, so that no more workers are started, and logs the
+// number of workers the load settled on
+func (s *workerScaler) finish() {
+	close(s.stop)
+	<-s.done
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	log.Printf("auto-workers: finished with %d workers (at most %d)", s.running, s.peak)
+}
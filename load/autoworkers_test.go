@@ -0,0 +1,92 @@
+package load
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerScalerSample(t *testing.T) {
+	cases := []struct {
+		desc   string
+		queued []int
+		want   []int
+	}{
+		{
+			desc:   "stays full",
+			queued: []int{4, 4, 4, 4, 4, 4},
+			want:   []int{0, 0, 0, 0, 1, 0},
+		},
+		{
+			desc:   "stays empty",
+			queued: []int{0, 0, 0, 0, 0},
+			want:   []int{0, 0, 0, 0, -1},
+		},
+		{
+			desc:   "pressure changes",
+			queued: []int{4, 4, 4, 4, 2, 4, 0, 0, 0, 0, 4},
+			want:   []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+	}
+	for _, c := range cases {
+		s := newWorkerScaler(newDuplexChannel(4), 4, nil)
+		var got []int
+		for _, q := range c.queued {
+			got = append(got, s.sample(q, 4))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: incorrect decisions: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestWorkerScalerAddRelease(t *testing.T) {
+	var started []int
+	s := newWorkerScaler(newDuplexChannel(3), 3, func(workerNum int, _ <-chan struct{}) {
+		started = append(started, workerNum)
+	})
+	for i := 0; i < 3; i++ {
+		if !s.add() {
+			t.Errorf("worker %d not started", i)
+		}
+	}
+	if s.add() {
+		t.Errorf("started more than the maximum number of workers")
+	}
+	s.release(1)
+	s.release(0)
+	s.add()
+	if want := []int{0, 1, 2, 0}; !reflect.DeepEqual(started, want) {
+		t.Errorf("incorrect worker numbers: got %v want %v", started, want)
+	}
+	if got := s.peak; got != 4 {
+		// running is only decremented by run when a worker is retired
+		t.Errorf("incorrect peak: got %d want 4", got)
+	}
+}
+
+func TestWorkUntilRetire(t *testing.T) {
+	br := &BenchmarkRunner{}
+	b := &testBenchmark{processors: []*testProcessor{{}}}
+	c := newDuplexChannel(1)
+	retire := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go br.workUntil(b, &wg, c, 0, retire)
+
+	c.sendToWorker(&testBatch{})
+	<-c.toScanner
+	select {
+	case retire <- struct{}{}:
+	case <-time.After(time.Second):
+		t.Fatalf("idle worker did not take the retirement")
+	}
+	wg.Wait()
+	if !b.processors[0].closed {
+		t.Errorf("processor of retired worker not closed")
+	}
+	if got := br.metricCnt; got != 1 {
+		t.Errorf("incorrect metrics processed before retiring: got %d want 1", got)
+	}
+}
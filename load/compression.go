@@ -0,0 +1,69 @@
+package load
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+const (
+	// CompressionNone means the input is read as-is
+	CompressionNone = "none"
+	// CompressionGzip means the input is a gzip stream
+	CompressionGzip = "gzip"
+	// CompressionAuto means the input is checked for the gzip magic bytes
+	// and decompressed only if they are present
+	CompressionAuto = "auto"
+)
+
+// gzipMagic are the first two bytes of every gzip stream (RFC 1952)
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzipped peeks at the start of br to see whether it holds a gzip stream.
+// No bytes are consumed from br.
+func isGzipped(br *bufio.Reader) bool {
+	header, err := br.Peek(len(gzipMagic))
+	if err != nil {
+		// Input shorter than the magic bytes cannot be gzipped
+		return false
+	}
+	return header[0] == gzipMagic[0] && header[1] == gzipMagic[1]
+}
+
+// truncatedGzipReader reports a truncated gzip stream with a clearer error
+// than the bare io.ErrUnexpectedEOF returned by compress/gzip.
+type truncatedGzipReader struct {
+	r io.Reader
+}
+
+func (t *truncatedGzipReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("gzip input is truncated: %v", err)
+	}
+	return n, err
+}
+
+// wrapCompressedReader returns a bufio.Reader that yields the decompressed
+// contents of br according to the compression setting. If no decompression
+// is needed, br itself is returned.
+func wrapCompressedReader(br *bufio.Reader, compression string) (*bufio.Reader, error) {
+	switch compression {
+	case "", CompressionNone:
+		return br, nil
+	case CompressionAuto:
+		if !isGzipped(br) {
+			return br, nil
+		}
+	case CompressionGzip:
+	default:
+		return nil, fmt.Errorf("unknown input compression '%s'", compression)
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open gzip input: %v", err)
+	}
+	return bufio.NewReaderSize(&truncatedGzipReader{r: gz}, defaultReadSize), nil
+}
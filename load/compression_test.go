@@ -0,0 +1,120 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("could not write gzip data: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close gzip writer: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestWrapCompressedReader(t *testing.T) {
+	data := "tags,hostname string\ncpu,usage_user\n\nrow1\nrow2\n"
+	gzipped := gzipBytes(t, data)
+	cases := []struct {
+		desc        string
+		input       []byte
+		compression string
+		want        string
+		wantErr     bool
+	}{
+		{
+			desc:        "no compression set",
+			input:       []byte(data),
+			compression: "",
+			want:        data,
+		},
+		{
+			desc:        "none",
+			input:       []byte(data),
+			compression: CompressionNone,
+			want:        data,
+		},
+		{
+			desc:        "gzip",
+			input:       gzipped,
+			compression: CompressionGzip,
+			want:        data,
+		},
+		{
+			desc:        "auto w/ gzip input",
+			input:       gzipped,
+			compression: CompressionAuto,
+			want:        data,
+		},
+		{
+			desc:        "auto w/ plain input",
+			input:       []byte(data),
+			compression: CompressionAuto,
+			want:        data,
+		},
+		{
+			desc:        "auto w/ empty input",
+			input:       []byte{},
+			compression: CompressionAuto,
+			want:        "",
+		},
+		{
+			desc:        "gzip w/ plain input",
+			input:       []byte(data),
+			compression: CompressionGzip,
+			wantErr:     true,
+		},
+		{
+			desc:        "unknown compression",
+			input:       []byte(data),
+			compression: "zstd",
+			wantErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		br, err := wrapCompressedReader(bufio.NewReader(bytes.NewReader(c.input)), c.compression)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", c.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Errorf("%s: unexpected read error: %v", c.desc, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: incorrect output: got %q want %q", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestWrapCompressedReaderTruncated(t *testing.T) {
+	gzipped := gzipBytes(t, strings.Repeat("row\n", 1000))
+	truncated := gzipped[:len(gzipped)/2]
+	br, err := wrapCompressedReader(bufio.NewReader(bytes.NewReader(truncated)), CompressionGzip)
+	if err != nil {
+		t.Fatalf("unexpected error opening truncated input: %v", err)
+	}
+	_, err = ioutil.ReadAll(br)
+	if err == nil {
+		t.Fatalf("expected error reading truncated input")
+	}
+	if !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("incorrect error for truncated input: got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package load
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// interruptedExitCode is the exit code used when a load is stopped by a signal,
+// following the shell convention of 128 + SIGINT
+const interruptedExitCode = 130
+
+// timedOutExitCode is the exit code used when a load is stopped by --timeout,
+// following the convention of timeout(1)
+const timedOutExitCode = 124
+
+// interruptibleDecoder wraps a PointDecoder so that decoding stops, as if the
+// input had ended, once a signal is received on sigs. This lets the scanner
+// flush the batches it already has and wait for the workers to finish them.
+// Decoding also stops once done is closed, when the load times out. While
+// pause is paused, decoding waits for it to be resumed, or stopped.
+type interruptibleDecoder struct {
+	PointDecoder
+	sigs        chan os.Signal
+	done        <-chan struct{}
+	pause       *scanPause
+	interrupted bool
+	timedOut    bool
+}
+
+// Decode returns nil once interrupted, otherwise it defers to the wrapped PointDecoder
+func (d *interruptibleDecoder) Decode(br *bufio.Reader) *Point {
+	if !d.interrupted && !d.timedOut {
+		select {
+		case <-d.done:
+			d.timeout()
+		case sig := <-d.sigs:
+			d.interrupt(sig)
+		default:
+			if resumed := d.resumed(); resumed != nil {
+				select {
+				case <-d.done:
+					d.timeout()
+				case sig := <-d.sigs:
+					d.interrupt(sig)
+				case <-resumed:
+				}
+			}
+		}
+	}
+	if d.interrupted || d.timedOut {
+		return nil
+	}
+	return d.PointDecoder.Decode(br)
+}
+
+// resumed returns a channel closed when reading is resumed, or nil if it is not paused
+func (d *interruptibleDecoder) resumed() <-chan struct{} {
+	if d.pause == nil {
+		return nil
+	}
+	return d.pause.resumed()
+}
+
+func (d *interruptibleDecoder) timeout() {
+	log.Printf("timeout reached: no more data will be read, aborting in-flight batches")
+	d.timedOut = true
+}
+
+func (d *interruptibleDecoder) interrupt(sig os.Signal) {
+	log.Printf("received %v: no more data will be read, waiting for in-flight batches to finish (send again to abort immediately)", sig)
+	d.interrupted = true
+	// Restore the default behavior so a second signal kills the process
+	signal.Stop(d.sigs)
+}
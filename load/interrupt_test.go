@@ -0,0 +1,55 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestInterruptibleDecoder(t *testing.T) {
+	br := bufio.NewReader(bytes.NewReader([]byte("abcdef")))
+	sigs := make(chan os.Signal, 1)
+	inner := &testDecoder{}
+	d := &interruptibleDecoder{PointDecoder: inner, sigs: sigs}
+
+	for i := 0; i < 2; i++ {
+		if p := d.Decode(br); p == nil {
+			t.Fatalf("decode %d returned nil before interrupt", i)
+		}
+	}
+
+	sigs <- os.Interrupt
+	for i := 0; i < 2; i++ {
+		if p := d.Decode(br); p != nil {
+			t.Errorf("decode returned non-nil point after interrupt")
+		}
+	}
+	if !d.interrupted {
+		t.Errorf("decoder not marked as interrupted")
+	}
+	if inner.called != 2 {
+		t.Errorf("wrapped decoder called incorrect number of times: got %d want %d", inner.called, 2)
+	}
+}
+
+func TestInterruptibleDecoderTimeout(t *testing.T) {
+	br := bufio.NewReader(bytes.NewReader([]byte("abcdef")))
+	done := make(chan struct{})
+	inner := &testDecoder{}
+	d := &interruptibleDecoder{PointDecoder: inner, done: done}
+
+	if p := d.Decode(br); p == nil {
+		t.Fatalf("decode returned nil before timeout")
+	}
+	close(done)
+	if p := d.Decode(br); p != nil {
+		t.Errorf("decode returned non-nil point after timeout")
+	}
+	if !d.timedOut || d.interrupted {
+		t.Errorf("decoder not marked as timed out: timedOut %v interrupted %v", d.timedOut, d.interrupted)
+	}
+	if inner.called != 1 {
+		t.Errorf("wrapped decoder called incorrect number of times: got %d want %d", inner.called, 1)
+	}
+}
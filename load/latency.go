@@ -0,0 +1,112 @@
+package load
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencySubBucketBits is log2 of the number of linear sub-buckets each power
+	// of two is split into, bounding the relative error of a recorded value to 1/32
+	latencySubBucketBits = 5
+	latencySubBuckets    = 1 << latencySubBucketBits
+	// numLatencyBuckets covers every possible uint64 value
+	numLatencyBuckets = latencySubBuckets * (64 - latencySubBucketBits + 1)
+)
+
+// latencyHistogram records durations in a fixed number of buckets, HDR histogram
+// style, so memory stays bounded no matter how many values are recorded. Values
+// are recorded in microseconds. It is safe for concurrent use.
+type latencyHistogram struct {
+	counts [numLatencyBuckets]uint64
+	total  uint64
+	sum    uint64
+	max    uint64
+}
+
+// latencyBucket returns the index of the bucket that v falls in
+func latencyBucket(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	shift := uint(bits.Len64(v) - latencySubBucketBits - 1)
+	return int(shift+1)*latencySubBuckets + int(v>>shift) - latencySubBuckets
+}
+
+// latencyBucketUpperBound returns the largest value that falls in bucket idx
+func latencyBucketUpperBound(idx int) uint64 {
+	if idx < latencySubBuckets {
+		return uint64(idx)
+	}
+	shift := uint(idx/latencySubBuckets - 1)
+	m := uint64(idx%latencySubBuckets + latencySubBuckets)
+	return (m+1)<<shift - 1
+}
+
+// record adds d to the histogram
+func (h *latencyHistogram) record(d time.Duration) {
+	v := uint64(d / time.Microsecond)
+	atomic.AddUint64(&h.counts[latencyBucket(v)], 1)
+	atomic.AddUint64(&h.total, 1)
+	atomic.AddUint64(&h.sum, v)
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if v <= max || atomic.CompareAndSwapUint64(&h.max, max, v) {
+			break
+		}
+	}
+}
+
+// count returns the number of recorded values
+func (h *latencyHistogram) count() uint64 {
+	return atomic.LoadUint64(&h.total)
+}
+
+// sumValue returns the total of all recorded values
+func (h *latencyHistogram) sumValue() time.Duration {
+	return time.Duration(atomic.LoadUint64(&h.sum)) * time.Microsecond
+}
+
+// countAtMost returns the number of recorded values no greater than d. Values in
+// the same bucket as d are included, so the count may include values up to
+// 1/latencySubBuckets larger than d.
+func (h *latencyHistogram) countAtMost(d time.Duration) uint64 {
+	last := latencyBucket(uint64(d / time.Microsecond))
+	cnt := uint64(0)
+	for i := 0; i <= last; i++ {
+		cnt += atomic.LoadUint64(&h.counts[i])
+	}
+	return cnt
+}
+
+// maxValue returns the largest recorded value
+func (h *latencyHistogram) maxValue() time.Duration {
+	return time.Duration(atomic.LoadUint64(&h.max)) * time.Microsecond
+}
+
+// percentile returns an upper bound for the p-th percentile (0 < p <= 100)
+// of the recorded values, or 0 if nothing has been recorded
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	total := h.count()
+	if total == 0 {
+		return 0
+	}
+	target := uint64(float64(total)*p/100 + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	seen := uint64(0)
+	for i := range h.counts {
+		seen += atomic.LoadUint64(&h.counts[i])
+		if seen >= target {
+			v := latencyBucketUpperBound(i)
+			// The bucket bound may overshoot the largest value actually seen
+			if max := atomic.LoadUint64(&h.max); v > max {
+				v = max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.maxValue()
+}
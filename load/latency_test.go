@@ -0,0 +1,71 @@
+package load
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	// Every value must fall within the bounds of its bucket, and buckets must
+	// be contiguous and increasing
+	prevIdx := -1
+	for v := uint64(0); v < 1<<16; v++ {
+		idx := latencyBucket(v)
+		if idx < prevIdx || idx > prevIdx+1 {
+			t.Fatalf("non-contiguous bucket for %d: got %d after %d", v, idx, prevIdx)
+		}
+		prevIdx = idx
+		if upper := latencyBucketUpperBound(idx); v > upper {
+			t.Fatalf("value %d above upper bound %d of its bucket %d", v, upper, idx)
+		}
+	}
+
+	if got := latencyBucket(^uint64(0)); got != numLatencyBuckets-1 {
+		t.Errorf("incorrect bucket for max value: got %d want %d", got, numLatencyBuckets-1)
+	}
+}
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	h := &latencyHistogram{}
+	if got := h.percentile(50); got != 0 {
+		t.Errorf("empty histogram percentile not 0: got %v", got)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 1 + w; i <= 1000; i += 4 {
+				h.record(time.Duration(i) * time.Millisecond)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if got := h.count(); got != 1000 {
+		t.Errorf("incorrect count: got %d want %d", got, 1000)
+	}
+	if got := h.maxValue(); got != time.Second {
+		t.Errorf("incorrect max: got %v want %v", got, time.Second)
+	}
+
+	cases := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 50, want: 500 * time.Millisecond},
+		{p: 95, want: 950 * time.Millisecond},
+		{p: 99, want: 990 * time.Millisecond},
+		{p: 100, want: time.Second},
+	}
+	for _, c := range cases {
+		got := h.percentile(c.p)
+		// Bucketing gives an upper bound within 1/latencySubBuckets of the real value
+		maxErr := c.want / latencySubBuckets
+		if got < c.want || got > c.want+maxErr {
+			t.Errorf("incorrect p%v: got %v want %v (+%v)", c.p, got, c.want, maxErr)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package load
+
+import (
+	"log"
+	"net"
+)
+
+// acceptConnection listens for TCP connections on addr and returns the first
+// one, from which the input is read with --listen. Later connections are
+// refused since the listener is closed once the first is accepted.
+func acceptConnection(addr string) (net.Conn, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	log.Printf("waiting for a connection to read data from on %s", ln.Addr())
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("reading data from %s", conn.RemoteAddr())
+	return conn, nil
+}
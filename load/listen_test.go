@@ -0,0 +1,55 @@
+package load
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptConnection(t *testing.T) {
+	// Pick a free port to listen on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	want := "tags,hostname string\ncpu,usage_user\n"
+	go func() {
+		for i := 0; i < 100; i++ {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			conn.Write([]byte(want))
+			conn.Close()
+			return
+		}
+	}()
+
+	conn, err := acceptConnection(addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	got, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("cannot read from connection: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("incorrect data: got %q want %q", got, want)
+	}
+
+	// Only a single connection is accepted
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("expected a second connection to be refused")
+	}
+
+	if _, err := acceptConnection("not an address"); err == nil {
+		t.Errorf("expected error for an invalid address")
+	}
+}
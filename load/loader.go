@@ -2,14 +2,20 @@ package load
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -56,30 +62,70 @@ type Benchmark interface {
 
 // BenchmarkRunnerConfig contains all the configuration information required for running BenchmarkRunner.
 type BenchmarkRunnerConfig struct {
-	DBName          string        `mapstructure:"db-name"`
-	BatchSize       uint          `mapstructure:"batch-size"`
-	Workers         uint          `mapstructure:"workers"`
-	Limit           uint64        `mapstructure:"limit"`
-	DoLoad          bool          `mapstructure:"do-load"`
-	DoCreateDB      bool          `mapstructure:"do-create-db"`
-	DoAbortOnExist  bool          `mapstructure:"do-abort-on-exist"`
-	ReportingPeriod time.Duration `mapstructure:"reporting-period"`
-	FileName        string        `mapstructure:"file"`
-	Seed            int64         `mapstructure:"seed"`
+	DBName           string        `mapstructure:"db-name"`
+	BatchSize        uint          `mapstructure:"batch-size"`
+	BatchBytes       uint64        `mapstructure:"batch-bytes"`
+	Workers          uint          `mapstructure:"workers"`
+	AutoWorkers      bool          `mapstructure:"auto-workers"`
+	Limit            uint64        `mapstructure:"limit"`
+	MaxRowsPerSec    uint64        `mapstructure:"max-rows-per-sec"`
+	DoLoad           bool          `mapstructure:"do-load"`
+	ParseOnly        bool          `mapstructure:"parse-only"`
+	DoCreateDB       bool          `mapstructure:"do-create-db"`
+	DoAbortOnExist   bool          `mapstructure:"do-abort-on-exist"`
+	ReportingPeriod  time.Duration `mapstructure:"reporting-period"`
+	FileName         string        `mapstructure:"file"`
+	FileNames        string        `mapstructure:"files"`
+	Listen           string        `mapstructure:"listen"`
+	Seed             int64         `mapstructure:"seed"`
+	InputCompression string        `mapstructure:"input-compression"`
+	StatsFormat      string        `mapstructure:"stats-format"`
+	MetricsAddr      string        `mapstructure:"metrics-addr"`
+	ProgressSocket   string        `mapstructure:"progress-socket"`
+	ResultsFile      string        `mapstructure:"results-file"`
+	ReportFile       string        `mapstructure:"report-file"`
+	WarmupSeconds    uint          `mapstructure:"warmup-seconds"`
+	Timeout          time.Duration `mapstructure:"timeout"`
+	ReportMem        bool          `mapstructure:"report-mem"`
+	ReportQueue      bool          `mapstructure:"report-queue"`
+	ReportBytes      bool          `mapstructure:"report-bytes"`
+	AutotuneBatch    bool          `mapstructure:"autotune-batch"`
+	TotalRows        uint64        `mapstructure:"total-rows"`
+	PinWorkers       bool          `mapstructure:"pin-workers"`
 }
 
 // AddToFlagSet adds command line flags needed by the BenchmarkRunnerConfig to the flag set.
 func (c BenchmarkRunnerConfig) AddToFlagSet(fs *pflag.FlagSet) {
 	fs.String("db-name", "benchmark", "Name of database")
 	fs.Uint("batch-size", defaultBatchSize, "Number of items to batch together in a single insert")
+	fs.Bool("autotune-batch", false, "Whether to pick the batch size while loading, doubling it from a small size while throughput improves (overrides --batch-size)")
+	fs.Uint64("batch-bytes", 0, "Approximate size in bytes at which to send a batch, instead of a number of items (cannot be used with --batch-size)")
 	fs.Uint("workers", 1, "Number of parallel clients inserting")
-	fs.Uint64("limit", 0, "Number of items to insert (0 = all of them).")
+	fs.Bool("auto-workers", false, "Whether to start with a few workers and add more, up to --workers, while the work queue stays full, or stop idle ones while it stays empty")
+	fs.Bool("pin-workers", false, "Experimental: whether to lock each worker to its own OS thread pinned to a distinct CPU, for less run-to-run variance (Linux only; ignored elsewhere)")
+	fs.Uint64("limit", 0, "Number of items to insert (0 = all of them). The rest of STDIN is read and discarded so the writer does not fail with a broken pipe")
+	fs.Uint64("max-rows-per-sec", 0, "Maximum number of items (rows for most loaders) to read per second, for a steady ingest rate instead of the maximum throughput (0 = no limit)")
 	fs.Bool("do-load", true, "Whether to write data. Set this flag to false to check input read speed.")
+	fs.Bool("parse-only", false, "Whether to only decode the input, counting and discarding items without batching them or starting workers, to measure parse speed alone (implies --do-load=false)")
 	fs.Bool("do-create-db", true, "Whether to create the database. Disable on all but one client if running on a multi client setup.")
 	fs.Bool("do-abort-on-exist", false, "Whether to abort if a database with the given name already exists.")
 	fs.Duration("reporting-period", 10*time.Second, "Period to report write stats")
+	fs.Uint64("total-rows", 0, "Expected number of rows, if known, to report the percentage complete and an ETA each period")
+	fs.Bool("report-mem", false, "Whether to also report the loader's heap size, memory obtained from the OS and number of GCs each period")
+	fs.Bool("report-queue", false, "Whether to also report the number of batches waiting for a worker and the queue capacity each period (a full queue means the database is the bottleneck, an empty one the input)")
+	fs.Bool("report-bytes", false, "Whether to also report the MB of input read and the read rate each period")
+	fs.Duration("timeout", 0, "Maximum duration of the load, after which it is aborted and the stats so far are printed (0 for no limit)")
 	fs.String("file", "", "File name to read data from")
+	fs.String("files", "", "Comma-separated list of files to read data from concurrently, one reader per file (overrides --file)")
+	fs.String("listen", "", "TCP address (e.g., ':8123') to accept a single connection on and read data from instead of STDIN, e.g., from a generator on another host")
 	fs.Int64("seed", 0, "PRNG seed (default: 0, which uses the current timestamp)")
+	fs.String("input-compression", CompressionAuto, "Compression of the input data: 'none', 'gzip', or 'auto' to detect gzip from its magic bytes")
+	fs.String("metrics-addr", "", "Address (e.g., ':9090') to serve load stats for Prometheus on at /metrics while loading (default: disabled)")
+	fs.String("progress-socket", "", "Path of a Unix domain socket to also send the periodic stats to as newline-delimited JSON, for any number of clients such as a TUI (default: disabled)")
+	fs.Uint("warmup-seconds", 0, "Number of seconds at the start of the load to exclude from the mean and overall rates")
+	fs.String("results-file", "", "CSV file to append a row of summary results to, with a header if the file is new (default: disabled)")
+	fs.String("report-file", "", "File to write the periodic stats, batch timings and summary to instead of STDOUT (e.g., /dev/stderr)")
+	fs.String("stats-format", StatsFormatText, "Format of the periodic and final stats: 'text' or 'json' (newline-delimited JSON objects)")
 }
 
 // BenchmarkRunner is responsible for initializing and storing common
@@ -89,8 +135,26 @@ type BenchmarkRunner struct {
 	br             *bufio.Reader
 	metricCnt      uint64
 	rowCnt         uint64
+	bytesRead      uint64
 	initialRand    *rand.Rand
 	sleepRegulator insertstrategy.SleepRegulator
+	batchLatency   latencyHistogram
+	warmup         warmupBaseline
+	ctx            context.Context
+	tuner          *batchTuner
+	tables         tableCounts
+	// limited is set when the load stopped after --limit items
+	limited bool
+	// pinCPUs are the CPUs that workers are pinned to in turn with --pin-workers
+	pinCPUs []int
+	// exitFns are called before the load exits early, see OnExit
+	exitFns []func()
+	// results are the summary results of the load, once it finished
+	results *summaryStats
+	// scanPause holds back reading the input, see PauseScan
+	scanPause scanPause
+	// progressSocket is sent the periodic stats with --progress-socket
+	progressSocket *progressSocket
 }
 
 var loader = &BenchmarkRunner{}
@@ -105,12 +169,39 @@ func GetBenchmarkRunner(c BenchmarkRunnerConfig) *BenchmarkRunner {
 // with specified batch size.
 func GetBenchmarkRunnerWithBatchSize(c BenchmarkRunnerConfig, batchSize uint) *BenchmarkRunner {
 	loader.BenchmarkRunnerConfig = c
+	if c.ParseOnly {
+		loader.DoLoad = false
+	}
+
+	if c.BatchBytes > 0 && batchSizeSet(pflag.CommandLine, c) {
+		panic("could not initialize BenchmarkRunner: --batch-size and --batch-bytes cannot both be set")
+	}
 
 	// If the configuration batch size is at default, we use the supplied batch size instead.
 	if c.BatchSize == defaultBatchSize {
 		c.BatchSize = batchSize
 	}
 
+	if c.AutotuneBatch && c.BatchBytes > 0 {
+		panic("could not initialize BenchmarkRunner: --autotune-batch and --batch-bytes cannot both be set")
+	}
+
+	if len(c.Listen) > 0 && (len(c.FileName) > 0 || len(c.FileNames) > 0) {
+		panic("could not initialize BenchmarkRunner: --listen cannot be used with --file or --files")
+	}
+
+	if err := validateStatsFormat(c.StatsFormat); err != nil {
+		panic(fmt.Sprintf("could not initialize BenchmarkRunner: %v", err))
+	}
+	if c.ProgressSocket != "" && c.ReportingPeriod <= 0 {
+		panic("could not initialize BenchmarkRunner: --progress-socket requires a --reporting-period")
+	}
+	if c.ReportFile != "" {
+		if err := loader.openReportFile(); err != nil {
+			panic(fmt.Sprintf("could not initialize BenchmarkRunner: cannot create report file: %v", err))
+		}
+	}
+
 	loader.initialRand = rand.New(rand.NewSource(loader.Seed))
 
 	var insertIntervals string
@@ -128,36 +219,156 @@ func GetBenchmarkRunnerWithBatchSize(c BenchmarkRunnerConfig, batchSize uint) *B
 	return loader
 }
 
+// batchSizeSet returns whether --batch-size was given on the command line of
+// fs, even at its default, or whether c has a batch size other than the default
+// if the flags were not added to fs
+func batchSizeSet(fs *pflag.FlagSet, c BenchmarkRunnerConfig) bool {
+	if f := fs.Lookup("batch-size"); f != nil {
+		return f.Changed
+	}
+	return c.BatchSize != defaultBatchSize
+}
+
 // DatabaseName returns the value of the --db-name flag (name of the database to store data)
 func (l *BenchmarkRunner) DatabaseName() string {
 	return l.DBName
 }
 
+// Context returns the context of the running load, which is cancelled when
+// --timeout is reached. Processors should use it for database operations so
+// that they are aborted promptly.
+func (l *BenchmarkRunner) Context() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+// OnExit registers fn to be called before the process exits at the end of a
+// load aborted by --timeout or an interrupt, or with Exit, when functions
+// deferred by the caller of RunBenchmark do not run.
+func (l *BenchmarkRunner) OnExit(fn func()) {
+	l.exitFns = append(l.exitFns, fn)
+}
+
+// Exit runs the functions registered with OnExit and exits with code. Loaders
+// use it to exit on fatal errors.
+func (l *BenchmarkRunner) Exit(code int) {
+	for _, fn := range l.exitFns {
+		fn()
+	}
+	os.Exit(code)
+}
+
 // RunBenchmark takes in a Benchmark b, a bufio.Reader br, and holders for number of metrics and rows
 // and uses those to run the load benchmark
 func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint) {
+	// The queues are only known here, but this is checked before the
+	// database is created, which drops any existing one
+	if l.AutoWorkers && !l.ParseOnly && l.workQueueCount(workQueues) > 1 {
+		panic("--auto-workers cannot be used when each worker has its own queue of batches")
+	}
+
+	// Checked before anything is created rather than once scanning starts
+	if l.BatchBytes > 0 && !l.ParseOnly {
+		if _, ok := b.GetBatchFactory().New().(SizedBatch); !ok {
+			fatal("--batch-bytes is not supported by this loader: its batches cannot estimate their size")
+			return
+		}
+	}
+
+	var cancel context.CancelFunc
+	if l.Timeout > 0 {
+		l.ctx, cancel = context.WithTimeout(context.Background(), l.Timeout)
+	} else {
+		l.ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
 	l.br = l.GetBufferedReader()
 
 	// Create required DB
 	cleanupFn := l.useDBCreator(b.GetDBCreator())
 	defer cleanupFn()
 
-	channels := l.createChannels(workQueues)
+	if len(l.MetricsAddr) > 0 {
+		shutdownFn := l.startMetricsServer(l.MetricsAddr)
+		defer shutdownFn()
+	}
+
+	if len(l.ProgressSocket) > 0 {
+		socket, err := listenProgressSocket(l.ProgressSocket)
+		if err != nil {
+			fatal("cannot listen on progress socket %s: %v", l.ProgressSocket, err)
+			return
+		}
+		l.progressSocket = socket
+		defer socket.close()
+	}
 
-	// Launch all worker processes in background
+	// With --parse-only, items are discarded as they are decoded so there
+	// are no channels or workers
+	var channels []*duplexChannel
 	var wg sync.WaitGroup
-	numChannels := len(channels)
-	for i := 0; i < int(l.Workers); i++ {
-		wg.Add(1)
+	var scaler *workerScaler
+	if !l.ParseOnly {
+		channels = l.createChannels(workQueues)
+
+		if l.PinWorkers {
+			l.pinCPUs = l.workerCPUs()
+		}
 
-		go l.work(b, &wg, channels[i%numChannels], i)
+		if l.AutoWorkers {
+			scaler = newWorkerScaler(channels[0], int(l.Workers), func(workerNum int, retire <-chan struct{}) {
+				wg.Add(1)
+				go func() {
+					l.workUntil(b, &wg, channels[0], workerNum, retire)
+					scaler.release(workerNum)
+				}()
+			})
+			scaler.start(autoWorkersStart)
+		} else {
+			// Launch all worker processes in background
+			numChannels := len(channels)
+			for i := 0; i < int(l.Workers); i++ {
+				wg.Add(1)
+
+				go l.work(b, &wg, channels[i%numChannels], i)
+			}
+		}
 	}
 
+	// Stop reading new data on interrupt, but let in-flight batches finish
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	pointDecoder, stopDecoding := l.getPointDecoder(b)
+	if l.MaxRowsPerSec > 0 {
+		pointDecoder = newRateLimitedDecoder(pointDecoder, l.MaxRowsPerSec)
+	}
+	decoder := &interruptibleDecoder{PointDecoder: pointDecoder, sigs: sigs, done: l.ctx.Done(), pause: &l.scanPause}
+
 	// Start scan process - actual data read process
 	start := time.Now()
-	l.scan(b, channels)
+	var warmupTimer *time.Timer
+	if l.WarmupSeconds > 0 {
+		warmup := time.Duration(l.WarmupSeconds) * time.Second
+		warmupTimer = time.AfterFunc(warmup, func() { l.endWarmup(warmup) })
+	}
+	itemsRead := l.scan(b, channels, decoder)
+	stopDecoding()
+	l.limited = l.Limit > 0 && itemsRead == l.Limit
+	var drained <-chan struct{}
+	if l.limited && len(l.inputFiles()) == 0 {
+		// Discard the rest of STDIN rather than leaving it unread, so that
+		// the process writing to it does not fail with a broken pipe
+		drained = drainInput(l.br)
+	}
 
 	// After scan process completed (no more data to come) - begin shutdown process
+	if scaler != nil {
+		scaler.finish()
+	}
 
 	// Close all communication channels to/from workers
 	for _, c := range channels {
@@ -167,29 +378,134 @@ func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint) {
 	// Wait for all workers to finish
 	wg.Wait()
 	end := time.Now()
+	if warmupTimer != nil && warmupTimer.Stop() {
+		log.Printf("warning: load finished before the %ds warm-up ended; rates include all of the load", l.WarmupSeconds)
+	}
+
+	timedOut := l.ctx.Err() == context.DeadlineExceeded
 
 	l.summary(end.Sub(start))
+
+	if timedOut {
+		log.Printf("load aborted after reaching the %v timeout; the stats above are partial", l.Timeout)
+		cleanupFn()
+		cancel()
+		l.Exit(timedOutExitCode)
+	}
+	if decoder.interrupted {
+		cleanupFn()
+		l.Exit(interruptedExitCode)
+	}
+	if drained != nil {
+		<-drained
+	}
 }
 
-// GetBufferedReader returns the buffered Reader that should be used by the loader
+// GetBufferedReader returns the buffered Reader that should be used by the loader.
+// When reading from multiple files, this is the reader for the first one.
 func (l *BenchmarkRunner) GetBufferedReader() *bufio.Reader {
 	if l.br == nil {
-		if len(l.FileName) > 0 {
+		files := l.inputFiles()
+		if len(files) > 0 {
 			// Read from specified file
-			file, err := os.Open(l.FileName)
+			l.br = l.openBufferedReader(files[0])
+		} else if len(l.Listen) > 0 {
+			// Read from the first connection made to the address
+			conn, err := acceptConnection(l.Listen)
 			if err != nil {
-				fatal("cannot open file for read %s: %v", l.FileName, err)
+				fatal("cannot accept a connection on %s: %v", l.Listen, err)
 				return nil
 			}
-			l.br = bufio.NewReaderSize(file, defaultReadSize)
+			l.br = l.wrapBufferedReader(bufio.NewReaderSize(conn, defaultReadSize))
 		} else {
 			// Read from STDIN
-			l.br = bufio.NewReaderSize(os.Stdin, defaultReadSize)
+			l.br = l.wrapBufferedReader(bufio.NewReaderSize(os.Stdin, defaultReadSize))
 		}
 	}
 	return l.br
 }
 
+// inputFiles returns the names of the files to read data from, if any
+func (l *BenchmarkRunner) inputFiles() []string {
+	if len(l.FileNames) > 0 {
+		return strings.Split(l.FileNames, ",")
+	}
+	if len(l.FileName) > 0 {
+		return []string{l.FileName}
+	}
+	return nil
+}
+
+// openBufferedReader opens fileName for reading, returning nil if it cannot be read
+func (l *BenchmarkRunner) openBufferedReader(fileName string) *bufio.Reader {
+	br, _ := l.openFile(fileName)
+	return br
+}
+
+// openFile opens fileName for reading, returning a reader of its data along
+// with the file to close once it is no longer read, or nil if it cannot be read
+func (l *BenchmarkRunner) openFile(fileName string) (*bufio.Reader, *os.File) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		fatal("cannot open file for read %s: %v", fileName, err)
+		return nil, nil
+	}
+	return l.wrapBufferedReader(bufio.NewReaderSize(file, defaultReadSize)), file
+}
+
+// wrapBufferedReader decompresses br if needed, so that every consumer of the
+// reader (header parsing, point decoding) sees plain data. The plain data read
+// is counted in bytesRead.
+func (l *BenchmarkRunner) wrapBufferedReader(br *bufio.Reader) *bufio.Reader {
+	wrapped, err := wrapCompressedReader(br, l.InputCompression)
+	if err != nil {
+		fatal("cannot read input: %v", err)
+		return nil
+	}
+	return bufio.NewReaderSize(&countingReader{r: wrapped, n: &l.bytesRead}, defaultReadSize)
+}
+
+// countingReader adds the number of bytes read from r to n
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddUint64(c.n, uint64(n))
+	return n, err
+}
+
+// getPointDecoder returns the PointDecoder to scan input with. For multiple input
+// files, each file after the first has its header skipped and all of them are
+// decoded concurrently. The returned function is called once scanning ends, to
+// stop decoding and close the files opened for it.
+func (l *BenchmarkRunner) getPointDecoder(b Benchmark) (PointDecoder, func()) {
+	files := l.inputFiles()
+	if len(files) <= 1 {
+		return b.GetPointDecoder(l.br), func() {}
+	}
+
+	readers := []*bufio.Reader{l.br}
+	var opened []*os.File
+	for _, fileName := range files[1:] {
+		br, file := l.openFile(fileName)
+		if hs, ok := b.(HeaderSkipper); ok {
+			hs.SkipHeader(br)
+		}
+		readers = append(readers, br)
+		opened = append(opened, file)
+	}
+	d := newMultiReaderDecoder(readers, b.GetPointDecoder)
+	return d, func() {
+		d.stop()
+		for _, file := range opened {
+			file.Close()
+		}
+	}
+}
+
 // useDBCreator handles a DBCreator by running it according to flags set by the
 // user. The function returns a function that the caller should defer or run
 // when the benchmark is finished
@@ -244,10 +560,8 @@ func (l *BenchmarkRunner) createChannels(workQueues uint) []*duplexChannel {
 	channels := []*duplexChannel{}
 
 	// How many work queues should be created?
-	workQueuesToCreate := int(workQueues)
-	if workQueues == WorkerPerQueue {
-		workQueuesToCreate = int(l.Workers)
-	} else if workQueues > l.Workers {
+	workQueuesToCreate := l.workQueueCount(workQueues)
+	if workQueues != WorkerPerQueue && workQueues > l.Workers {
 		panic(fmt.Sprintf("cannot have more work queues (%d) than workers (%d)", workQueues, l.Workers))
 	}
 
@@ -262,21 +576,81 @@ func (l *BenchmarkRunner) createChannels(workQueues uint) []*duplexChannel {
 	return channels
 }
 
+// workQueueCount returns the number of work queues created for workQueues,
+// which is either a number of queues or WorkerPerQueue
+func (l *BenchmarkRunner) workQueueCount(workQueues uint) int {
+	if workQueues == WorkerPerQueue {
+		return int(l.Workers)
+	}
+	return int(workQueues)
+}
+
 // scan launches any needed reporting mechanism and proceeds to scan input data
 // to distribute to workers
-func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel) uint64 {
+func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel, decoder PointDecoder) uint64 {
 	// Start background reporting process
 	// TODO why it is here? May be it could be moved one level up?
 	if l.ReportingPeriod.Nanoseconds() > 0 {
-		go l.report(l.ReportingPeriod)
+		// Reporting stops once the load's context is canceled, when it ends
+		go l.report(l.ReportingPeriod, channels, l.Context().Done())
+	}
+
+	if l.ParseOnly {
+		return parseOnly(l.Limit, l.br, decoder, &l.rowCnt)
 	}
 
 	// Scan incoming data
-	return scanWithIndexer(channels, l.BatchSize, l.Limit, l.br, b.GetPointDecoder(l.br), b.GetBatchFactory(), b.GetPointIndexer(uint(len(channels))))
+	if l.AutotuneBatch && l.DoLoad {
+		l.tuner = newBatchTuner()
+	}
+	return scanWithIndexer(channels, l.BatchSize, l.BatchBytes, l.tuner, l.Limit, l.br, decoder, b.GetBatchFactory(), b.GetPointIndexer(uint(len(channels))))
+}
+
+// batchSize returns the number of items per batch, as picked by
+// --autotune-batch if set
+func (l *BenchmarkRunner) batchSize() uint {
+	if l.tuner != nil {
+		return l.tuner.batchSize()
+	}
+	return l.BatchSize
+}
+
+// workerCPUs returns the CPUs to pin workers to in turn with --pin-workers, or
+// none if workers cannot be pinned
+func (l *BenchmarkRunner) workerCPUs() []int {
+	cpus, err := allowedCPUs()
+	if err != nil {
+		log.Printf("warning: --pin-workers is ignored: %v", err)
+		return nil
+	}
+	if int(l.Workers) > len(cpus) {
+		log.Printf("warning: %d workers share %d CPUs with --pin-workers", l.Workers, len(cpus))
+	}
+	return cpus
+}
+
+// pinWorker locks the calling worker goroutine to its OS thread and pins the
+// thread to a CPU. The thread is never unlocked, so it exits with the worker
+// rather than running other goroutines with its affinity.
+func (l *BenchmarkRunner) pinWorker(workerNum int) {
+	cpu := l.pinCPUs[workerNum%len(l.pinCPUs)]
+	runtime.LockOSThread()
+	if err := pinThread(cpu); err != nil {
+		log.Printf("warning: could not pin worker %d to CPU %d: %v", workerNum, cpu, err)
+	}
 }
 
 // work is the processing function for each worker in the loader
 func (l *BenchmarkRunner) work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel, workerNum int) {
+	l.workUntil(b, wg, c, workerNum, nil)
+}
+
+// workUntil is work for a worker that also stops, between batches, when it
+// receives from retire
+func (l *BenchmarkRunner) workUntil(b Benchmark, wg *sync.WaitGroup, c *duplexChannel, workerNum int, retire <-chan struct{}) {
+	if len(l.pinCPUs) > 0 {
+		l.pinWorker(workerNum)
+	}
 
 	// Prepare processor
 	proc := b.GetProcessor()
@@ -284,9 +658,26 @@ func (l *BenchmarkRunner) work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel
 
 	// Process batches coming from duplexChannel.toWorker queue
 	// and send ACKs into duplexChannel.toScanner queue
-	for b := range c.toWorker {
+	for {
+		// b is nil once the queue is closed, or when the worker is retired
+		var b Batch
+		select {
+		case b = <-c.toWorker:
+		case <-retire:
+		}
+		if b == nil {
+			break
+		}
 		startedWorkAt := time.Now()
+		items := b.Len()
 		metricCnt, rowCnt := proc.ProcessBatch(b, l.DoLoad)
+		if l.DoLoad {
+			latency := time.Since(startedWorkAt)
+			l.batchLatency.record(latency)
+			if l.tuner != nil {
+				l.tuner.record(items, latency)
+			}
+		}
 		atomic.AddUint64(&l.metricCnt, metricCnt)
 		atomic.AddUint64(&l.rowCnt, rowCnt)
 		c.sendToScanner()
@@ -310,41 +701,171 @@ func (l *BenchmarkRunner) timeToSleep(workerNum int, startedWorkAt time.Time) {
 
 // summary prints the summary of statistics from loading
 func (l *BenchmarkRunner) summary(took time.Duration) {
-	metricRate := float64(l.metricCnt) / float64(took.Seconds())
-	printFn("\nSummary:\n")
-	printFn("loaded %d metrics in %0.3fsec with %d workers (mean rate %0.2f metrics/sec)\n", l.metricCnt, took.Seconds(), l.Workers, metricRate)
-	if l.rowCnt > 0 {
-		rowRate := float64(l.rowCnt) / float64(took.Seconds())
-		printFn("loaded %d rows in %0.3fsec with %d workers (mean rate %0.2f rows/sec)\n", l.rowCnt, took.Seconds(), l.Workers, rowRate)
+	rateMetrics, rateRows, rateTook, warmup := l.warmup.exclude(l.metricCnt, l.rowCnt, took)
+	pauses, pausedTook := l.scanPause.stats()
+	metricRate := float64(rateMetrics) / float64(rateTook.Seconds())
+	stats := summaryStats{
+		Timestamp:      time.Now().Unix(),
+		TotalColumns:   l.metricCnt,
+		TotalRows:      l.rowCnt,
+		ElapsedSeconds: took.Seconds(),
+		WarmupSeconds:  warmup.Seconds(),
+		Limited:        l.limited,
+		TargetRowRate:  l.MaxRowsPerSec,
+		Workers:        l.Workers,
+		BatchSize:      l.batchSize(),
+		MeanColRate:    metricRate,
+		MeanRowRate:    float64(rateRows) / float64(rateTook.Seconds()),
+		P50LatencyMs:   durationToMs(l.batchLatency.percentile(50)),
+		P95LatencyMs:   durationToMs(l.batchLatency.percentile(95)),
+		P99LatencyMs:   durationToMs(l.batchLatency.percentile(99)),
+		MaxLatencyMs:   durationToMs(l.batchLatency.maxValue()),
+		TotalBytes:     l.bytesRead,
+		MeanMBRate:     mbPerSec(l.bytesRead, took),
+		PausedSeconds:  pausedTook.Seconds(),
+		Build:          GetBuildInfo(),
+	}
+	l.results = &stats
+	// A breakdown is only useful to spot skew between several tables
+	if tables := l.tables.sorted(); len(tables) > 1 {
+		stats.Tables = tables
+	}
+	if l.StatsFormat == StatsFormatJSON {
+		printJSON(stats)
+	} else {
+		printFn("\nSummary:\n")
+		if l.ParseOnly {
+			printFn("parsed %d items in %0.3fsec without loading them (mean rate %0.2f items/sec)\n", l.rowCnt, took.Seconds(), stats.MeanRowRate)
+		} else {
+			printFn("loaded %d metrics in %0.3fsec with %d workers (mean rate %0.2f metrics/sec)\n", l.metricCnt, took.Seconds(), l.Workers, metricRate)
+		}
+		if l.rowCnt > 0 && !l.ParseOnly {
+			printFn("loaded %d rows in %0.3fsec with %d workers (mean rate %0.2f rows/sec)\n", l.rowCnt, took.Seconds(), l.Workers, stats.MeanRowRate)
+		}
+		if l.bytesRead > 0 {
+			printFn("read %d bytes of input in %0.3fsec (mean rate %0.2f MB/sec)\n", l.bytesRead, took.Seconds(), stats.MeanMBRate)
+		}
+		if pauses > 0 {
+			printFn("reading of the input was paused %d times for %v in total\n", pauses, pausedTook.Round(time.Millisecond))
+		}
+		if warmup > 0 {
+			printFn("mean rates exclude the first %v of warm-up\n", warmup)
+		}
+		if l.limited {
+			printFn("load limited to the first %d items of the input\n", l.Limit)
+		}
+		if l.MaxRowsPerSec > 0 {
+			printFn("target rate %d rows/sec (--max-rows-per-sec)\n", l.MaxRowsPerSec)
+		}
+		if l.batchLatency.count() > 0 {
+			printFn("batch latency: p50 %v, p95 %v, p99 %v, max %v\n", l.batchLatency.percentile(50), l.batchLatency.percentile(95), l.batchLatency.percentile(99), l.batchLatency.maxValue())
+		}
+		if len(stats.Tables) > 0 {
+			printFn("per table:\n")
+			for _, t := range stats.Tables {
+				printFn("  %s: %d rows (%0.1f%%), %d metrics\n", t.Table, t.Rows, percentOf(t.Rows, l.rowCnt), t.Columns)
+			}
+		}
+	}
+
+	if l.ResultsFile != "" {
+		if err := appendResults(l.ResultsFile, stats); err != nil {
+			fatal("cannot write results file %s: %v", l.ResultsFile, err)
+		}
 	}
 }
 
-// report handles periodic reporting of loading stats
-func (l *BenchmarkRunner) report(period time.Duration) {
+// report handles periodic reporting of loading stats until done is closed
+func (l *BenchmarkRunner) report(period time.Duration, channels []*duplexChannel, done <-chan struct{}) {
 	start := time.Now()
 	prevTime := start
 	prevColCount := uint64(0)
 	prevRowCount := uint64(0)
+	prevBytes := uint64(0)
 
-	printFn("time,per. metric/s,metric total,overall metric/s,per. row/s,row total,overall row/s\n")
-	for now := range time.NewTicker(period).C {
+	if l.StatsFormat != StatsFormatJSON {
+		header := "time,per. metric/s,metric total,overall metric/s,per. row/s,row total,overall row/s"
+		if l.ReportMem {
+			header += memStatsHeader
+		}
+		if l.ReportQueue {
+			header += queueStatsHeader
+		}
+		if l.ReportBytes {
+			header += bytesStatsHeader
+		}
+		if l.TotalRows > 0 {
+			header += progressHeader
+		}
+		printFn(header + "\n")
+	}
+	var estimator *progressEstimator
+	if l.TotalRows > 0 {
+		estimator = &progressEstimator{total: l.TotalRows}
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
 		cCount := atomic.LoadUint64(&l.metricCnt)
 		rCount := atomic.LoadUint64(&l.rowCnt)
+		bCount := atomic.LoadUint64(&l.bytesRead)
 
 		sinceStart := now.Sub(start)
 		took := now.Sub(prevTime)
 		colrate := float64(cCount-prevColCount) / float64(took.Seconds())
-		overallColRate := float64(cCount) / float64(sinceStart.Seconds())
-		if rCount > 0 {
-			rowrate := float64(rCount-prevRowCount) / float64(took.Seconds())
-			overallRowRate := float64(rCount) / float64(sinceStart.Seconds())
-			printFn("%d,%0.2f,%E,%0.2f,%0.2f,%E,%0.2f\n", now.Unix(), colrate, float64(cCount), overallColRate, rowrate, float64(rCount), overallRowRate)
+		// Overall rates exclude the warm-up once it has ended
+		overallCols, overallRows, overallTook, _ := l.warmup.exclude(cCount, rCount, sinceStart)
+		overallColRate := float64(overallCols) / float64(overallTook.Seconds())
+		var mem *memStats
+		if l.ReportMem {
+			mem = readMemStats()
+		}
+		var queue *queueStats
+		if l.ReportQueue {
+			queue = readQueueStats(channels)
+		}
+		var read *bytesStats
+		if l.ReportBytes {
+			read = &bytesStats{TotalBytes: bCount, PeriodMBRate: mbPerSec(bCount-prevBytes, took)}
+		}
+		rowrate := float64(rCount-prevRowCount) / float64(took.Seconds())
+		var prog *progress
+		if estimator != nil {
+			prog = estimator.update(rCount, rowrate)
+		}
+		stats := periodStats{
+			Timestamp:      now.Unix(),
+			PeriodColRate:  colrate,
+			PeriodRowRate:  rowrate,
+			TotalColumns:   cCount,
+			TotalRows:      rCount,
+			ElapsedSeconds: sinceStart.Seconds(),
+			Memory:         mem,
+			Queue:          queue,
+			Read:           read,
+			Progress:       prog,
+		}
+		if l.progressSocket != nil {
+			l.progressSocket.send(stats)
+		}
+		if l.StatsFormat == StatsFormatJSON {
+			printJSON(stats)
+		} else if rCount > 0 {
+			overallRowRate := float64(overallRows) / float64(overallTook.Seconds())
+			printFn("%d,%0.2f,%E,%0.2f,%0.2f,%E,%0.2f%s\n", now.Unix(), colrate, float64(cCount), overallColRate, rowrate, float64(rCount), overallRowRate, mem.columns()+queue.columns()+read.columns()+prog.columns())
 		} else {
-			printFn("%d,%0.2f,%E,%0.2f,-,-,-\n", now.Unix(), colrate, float64(cCount), overallColRate)
+			printFn("%d,%0.2f,%E,%0.2f,-,-,-%s\n", now.Unix(), colrate, float64(cCount), overallColRate, mem.columns()+queue.columns()+read.columns()+prog.columns())
 		}
 
 		prevColCount = cCount
 		prevRowCount = rCount
+		prevBytes = bCount
 		prevTime = now
 	}
 }
@@ -3,12 +3,19 @@ package load
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/spf13/pflag"
 )
 
 type testProcessor struct {
@@ -458,11 +465,14 @@ func TestWorkWithSleep(t *testing.T) {
 
 func TestSummary(t *testing.T) {
 	cases := []struct {
-		desc    string
-		metrics uint64
-		rows    uint64
-		took    time.Duration
-		want    string
+		desc      string
+		metrics   uint64
+		rows      uint64
+		took      time.Duration
+		limit     uint64
+		parseOnly bool
+		bytesRead uint64
+		want      string
 	}{
 		{
 			desc:    "10 metrics, 0 rows, 1 second",
@@ -492,12 +502,38 @@ func TestSummary(t *testing.T) {
 			took:    time.Second,
 			want:    "\nSummary:\nloaded 10 metrics in 1.000sec with 0 workers (mean rate 10.00 metrics/sec)\nloaded 1 rows in 1.000sec with 0 workers (mean rate 1.00 rows/sec)\n",
 		},
+		{
+			desc:    "limited: 10 metrics, 0 rows, 1 second",
+			metrics: 10,
+			rows:    0,
+			took:    time.Second,
+			limit:   5,
+			want:    "\nSummary:\nloaded 10 metrics in 1.000sec with 0 workers (mean rate 10.00 metrics/sec)\nload limited to the first 5 items of the input\n",
+		},
+		{
+			desc:      "parse only: 0 metrics, 4 rows, 2 seconds",
+			rows:      4,
+			took:      2 * time.Second,
+			parseOnly: true,
+			want:      "\nSummary:\nparsed 4 items in 2.000sec without loading them (mean rate 2.00 items/sec)\n",
+		},
+		{
+			desc:      "bytes read: 10 metrics, 0 rows, 2 seconds",
+			metrics:   10,
+			took:      2 * time.Second,
+			bytesRead: 3 << 20,
+			want:      "\nSummary:\nloaded 10 metrics in 2.000sec with 0 workers (mean rate 5.00 metrics/sec)\nread 3145728 bytes of input in 2.000sec (mean rate 1.50 MB/sec)\n",
+		},
 	}
 
 	for _, c := range cases {
 		br := &BenchmarkRunner{}
 		br.metricCnt = c.metrics
 		br.rowCnt = c.rows
+		br.Limit = c.limit
+		br.limited = c.limit > 0
+		br.ParseOnly = c.parseOnly
+		br.bytesRead = c.bytesRead
 		var b bytes.Buffer
 		printFn = func(s string, args ...interface{}) (n int, err error) {
 			return fmt.Fprintf(&b, s, args...)
@@ -509,7 +545,42 @@ func TestSummary(t *testing.T) {
 	}
 }
 
+func TestSummaryJSON(t *testing.T) {
+	br := &BenchmarkRunner{}
+	br.StatsFormat = StatsFormatJSON
+	br.Workers = 2
+	br.BatchSize = 5
+	br.metricCnt = 10
+	br.rowCnt = 4
+	var b bytes.Buffer
+	printFn = func(s string, args ...interface{}) (n int, err error) {
+		return fmt.Fprintf(&b, s, args...)
+	}
+	br.summary(2 * time.Second)
+
+	var got summaryStats
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("summary is not valid JSON: %v\n%s", err, b.String())
+	}
+	got.Timestamp = 0
+	want := summaryStats{
+		TotalColumns:   10,
+		TotalRows:      4,
+		ElapsedSeconds: 2,
+		Workers:        2,
+		BatchSize:      5,
+		MeanColRate:    5,
+		MeanRowRate:    2,
+		Build:          GetBuildInfo(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect JSON summary: got %+v want %+v", got, want)
+	}
+}
+
 func TestReport(t *testing.T) {
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
 	var b bytes.Buffer
 	counter := int64(0)
 	var m sync.Mutex
@@ -521,7 +592,17 @@ func TestReport(t *testing.T) {
 	}
 	br := &BenchmarkRunner{}
 	duration := 200 * time.Millisecond
-	go br.report(duration)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		br.report(duration, nil, done)
+		close(stopped)
+	}()
+	// The reporting goroutine must stop before printFn is restored
+	defer func() {
+		close(done)
+		<-stopped
+	}()
 
 	time.Sleep(25 * time.Millisecond)
 	if got := atomic.LoadInt64(&counter); got != 1 {
@@ -557,3 +638,276 @@ func TestReport(t *testing.T) {
 		t.Errorf("TestReport: row report ends in -")
 	}
 }
+
+func TestMemStatsColumns(t *testing.T) {
+	var none *memStats
+	if got := none.columns(); got != "" {
+		t.Errorf("incorrect columns without memory stats: got %q", got)
+	}
+	m := &memStats{HeapAllocBytes: 3 << 20, SysBytes: 10 << 20, NumGC: 7}
+	if got, want := m.columns(), ",3.00,10.00,7"; got != want {
+		t.Errorf("incorrect columns: got %q want %q", got, want)
+	}
+	if got, want := strings.Count(memStatsHeader, ","), strings.Count(m.columns(), ","); got != want {
+		t.Errorf("header has %d columns but row has %d", got, want)
+	}
+	if readMemStats().SysBytes == 0 {
+		t.Errorf("memory obtained from the OS not read")
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	var none *queueStats
+	if got := none.columns(); got != "" {
+		t.Errorf("incorrect columns without queue stats: got %q", got)
+	}
+	channels := []*duplexChannel{newDuplexChannel(2), newDuplexChannel(2)}
+	channels[0].sendToWorker(&testBatch{})
+	channels[1].sendToWorker(&testBatch{})
+	channels[1].sendToWorker(&testBatch{})
+	q := readQueueStats(channels)
+	if got, want := *q, (queueStats{Queued: 3, Capacity: 4}); got != want {
+		t.Errorf("incorrect queue stats: got %v want %v", got, want)
+	}
+	if got, want := q.columns(), ",3,4"; got != want {
+		t.Errorf("incorrect columns: got %q want %q", got, want)
+	}
+	if got, want := strings.Count(queueStatsHeader, ","), strings.Count(q.columns(), ","); got != want {
+		t.Errorf("header has %d columns but row has %d", got, want)
+	}
+}
+
+func TestBytesStats(t *testing.T) {
+	var none *bytesStats
+	if got := none.columns(); got != "" {
+		t.Errorf("incorrect columns without bytes stats: got %q", got)
+	}
+	b := &bytesStats{TotalBytes: 5 << 20, PeriodMBRate: mbPerSec(1<<20, 2*time.Second)}
+	if got, want := b.columns(), ",5.00,0.50"; got != want {
+		t.Errorf("incorrect columns: got %q want %q", got, want)
+	}
+	if got, want := strings.Count(bytesStatsHeader, ","), strings.Count(b.columns(), ","); got != want {
+		t.Errorf("header has %d columns but row has %d", got, want)
+	}
+}
+
+func TestWrapBufferedReaderCountsBytes(t *testing.T) {
+	r := &BenchmarkRunner{}
+	br := r.wrapBufferedReader(bufio.NewReader(strings.NewReader("a,b\n\n1,2\n")))
+	if _, err := ioutil.ReadAll(br); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := atomic.LoadUint64(&r.bytesRead), uint64(9); got != want {
+		t.Errorf("incorrect bytes read: got %d want %d", got, want)
+	}
+}
+
+func TestReportFile(t *testing.T) {
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	br := &BenchmarkRunner{}
+	br.ReportFile = filepath.Join(dir, "report.txt")
+	if err := br.openReportFile(); err != nil {
+		t.Fatalf("unexpected error opening report file: %v", err)
+	}
+	br.metricCnt = 10
+	br.summary(time.Second)
+	br.Reportf("BATCH: %d\n", 5)
+
+	got, err := ioutil.ReadFile(br.ReportFile)
+	if err != nil {
+		t.Fatalf("could not read report file: %v", err)
+	}
+	want := "\nSummary:\nloaded 10 metrics in 1.000sec with 0 workers (mean rate 10.00 metrics/sec)\nBATCH: 5\n"
+	if string(got) != want {
+		t.Errorf("incorrect report file contents: got %q want %q", got, want)
+	}
+
+	br.ReportFile = filepath.Join(dir, "missing", "report.txt")
+	if err := br.openReportFile(); err == nil {
+		t.Errorf("expected error for a report file in a missing directory but got none")
+	}
+}
+
+func TestReportJSONLines(t *testing.T) {
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
+	var b bytes.Buffer
+	var m sync.Mutex
+	printFn = func(s string, args ...interface{}) (n int, err error) {
+		m.Lock()
+		defer m.Unlock()
+		return fmt.Fprintf(&b, s, args...)
+	}
+
+	br := &BenchmarkRunner{}
+	br.StatsFormat = StatsFormatJSON
+	br.metricCnt = 10
+	br.rowCnt = 4
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		br.report(10*time.Millisecond, nil, done)
+		close(stopped)
+	}()
+	time.Sleep(25 * time.Millisecond)
+	br.PauseScan("replicas lag")
+	br.ResumeScan()
+	close(done)
+	<-stopped
+	br.summary(time.Second)
+	br.Reportf("BATCH: worker %d batchsize %d\n", 1, 5)
+	br.Reportf("skipped %d batches\n  %d failed with: %s\n", 2, 2, "timeout")
+
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	reports := 0
+	for _, line := range lines {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("line is not valid JSON: %v\n%s", err, line)
+		}
+		if v["event"] == "report" {
+			reports++
+		}
+	}
+	if want := 5; reports != want {
+		t.Errorf("incorrect number of report lines: got %d want %d\n%s", reports, want, b.String())
+	}
+	if !strings.Contains(b.String(), `"message":"  2 failed with: timeout"`) {
+		t.Errorf("multi-line report not split into separate lines:\n%s", b.String())
+	}
+}
+
+func TestGetBenchmarkRunnerBatchBytes(t *testing.T) {
+	oldConfig := loader.BenchmarkRunnerConfig
+	defer func() { loader.BenchmarkRunnerConfig = oldConfig }()
+	cases := []struct {
+		desc        string
+		c           BenchmarkRunnerConfig
+		batchSize   uint
+		shouldPanic bool
+	}{
+		{
+			desc:        "both set",
+			c:           BenchmarkRunnerConfig{BatchSize: 500, BatchBytes: 1 << 20},
+			batchSize:   defaultBatchSize,
+			shouldPanic: true,
+		},
+		{
+			desc:        "with autotune",
+			c:           BenchmarkRunnerConfig{BatchSize: defaultBatchSize, BatchBytes: 1 << 20, AutotuneBatch: true},
+			batchSize:   defaultBatchSize,
+			shouldPanic: true,
+		},
+		{
+			desc:      "loader default batch size",
+			c:         BenchmarkRunnerConfig{BatchSize: defaultBatchSize, BatchBytes: 1 << 20},
+			batchSize: 100,
+		},
+	}
+	for _, c := range cases {
+		func() {
+			defer func() {
+				r := recover()
+				if r != nil && !c.shouldPanic {
+					t.Errorf("%s: unexpected panic: %v", c.desc, r)
+				} else if r == nil && c.shouldPanic {
+					t.Errorf("%s: expected panic but got none", c.desc)
+				}
+			}()
+			GetBenchmarkRunnerWithBatchSize(c.c, c.batchSize)
+		}()
+	}
+}
+
+func TestBatchSizeSet(t *testing.T) {
+	cases := []struct {
+		desc string
+		args []string
+		want bool
+	}{
+		{desc: "not set", want: false},
+		{desc: "set", args: []string{"--batch-size=500"}, want: true},
+		{desc: "set to the default", args: []string{fmt.Sprintf("--batch-size=%d", defaultBatchSize)}, want: true},
+	}
+	for _, c := range cases {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		BenchmarkRunnerConfig{}.AddToFlagSet(fs)
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatalf("%s: unexpected error parsing flags: %v", c.desc, err)
+		}
+		batchSize, _ := fs.GetUint("batch-size")
+		if got := batchSizeSet(fs, BenchmarkRunnerConfig{BatchSize: batchSize}); got != c.want {
+			t.Errorf("%s: incorrect batch size set: got %v want %v", c.desc, got, c.want)
+		}
+	}
+
+	// Without the flags, only a batch size other than the default is set
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if batchSizeSet(fs, BenchmarkRunnerConfig{BatchSize: defaultBatchSize}) {
+		t.Errorf("default batch size reported as set without the flags")
+	}
+	if !batchSizeSet(fs, BenchmarkRunnerConfig{BatchSize: 500}) {
+		t.Errorf("batch size not reported as set without the flags")
+	}
+}
+
+// testUnsizedBenchmark has batches that cannot estimate their size
+type testUnsizedBenchmark struct {
+	testBenchmark
+}
+
+func (b *testUnsizedBenchmark) GetBatchFactory() BatchFactory { return &testFactory{} }
+
+func TestRunBenchmarkBatchBytesUnsupported(t *testing.T) {
+	oldFatal := fatal
+	defer func() { fatal = oldFatal }()
+	msg := ""
+	fatal = func(format string, args ...interface{}) {
+		msg = fmt.Sprintf(format, args...)
+	}
+
+	br := &BenchmarkRunner{}
+	br.BatchBytes = 1 << 20
+	br.RunBenchmark(&testUnsizedBenchmark{}, SingleQueue)
+	if !strings.Contains(msg, "--batch-bytes is not supported") {
+		t.Errorf("incorrect fatal message: got %q", msg)
+	}
+	if br.br != nil {
+		t.Errorf("input was opened before --batch-bytes was rejected")
+	}
+}
+
+// testCreatorBenchmark has a database creator to check whether it is used
+type testCreatorBenchmark struct {
+	testBenchmark
+	dbc *testCreator
+}
+
+func (b *testCreatorBenchmark) GetDBCreator() DBCreator { return b.dbc }
+
+func TestRunBenchmarkAutoWorkersConflict(t *testing.T) {
+	br := &BenchmarkRunner{}
+	br.AutoWorkers = true
+	br.Workers = 2
+	br.DoLoad = true
+	br.DoCreateDB = true
+	b := &testCreatorBenchmark{dbc: &testCreator{exists: true}}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("expected panic for --auto-workers with a queue per worker but got none")
+			}
+		}()
+		br.RunBenchmark(b, WorkerPerQueue)
+	}()
+	if b.dbc.initCalled || b.dbc.removeCalled || b.dbc.createCalled {
+		t.Errorf("database creator used before the flag conflict was rejected: %+v", b.dbc)
+	}
+}
@@ -0,0 +1,64 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// batchLatencyBuckets are the upper bounds (in seconds) of the buckets exposed
+// for the tsbs_batch_commit_seconds histogram
+var batchLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// writeMetrics writes the current load stats to w in the Prometheus text exposition format
+func (l *BenchmarkRunner) writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP tsbs_rows_loaded_total Number of rows loaded.\n")
+	fmt.Fprintf(w, "# TYPE tsbs_rows_loaded_total counter\n")
+	fmt.Fprintf(w, "tsbs_rows_loaded_total %d\n", atomic.LoadUint64(&l.rowCnt))
+	fmt.Fprintf(w, "# HELP tsbs_columns_loaded_total Number of columns (metrics) loaded.\n")
+	fmt.Fprintf(w, "# TYPE tsbs_columns_loaded_total counter\n")
+	fmt.Fprintf(w, "tsbs_columns_loaded_total %d\n", atomic.LoadUint64(&l.metricCnt))
+	fmt.Fprintf(w, "# HELP tsbs_input_read_bytes_total Number of bytes of input read, after decompression.\n")
+	fmt.Fprintf(w, "# TYPE tsbs_input_read_bytes_total counter\n")
+	fmt.Fprintf(w, "tsbs_input_read_bytes_total %d\n", atomic.LoadUint64(&l.bytesRead))
+
+	h := &l.batchLatency
+	fmt.Fprintf(w, "# HELP tsbs_batch_commit_seconds Time taken to process and commit a batch.\n")
+	fmt.Fprintf(w, "# TYPE tsbs_batch_commit_seconds histogram\n")
+	for _, le := range batchLatencyBuckets {
+		d := time.Duration(le * float64(time.Second))
+		fmt.Fprintf(w, "tsbs_batch_commit_seconds_bucket{le=\"%g\"} %d\n", le, h.countAtMost(d))
+	}
+	cnt := h.count()
+	fmt.Fprintf(w, "tsbs_batch_commit_seconds_bucket{le=\"+Inf\"} %d\n", cnt)
+	fmt.Fprintf(w, "tsbs_batch_commit_seconds_sum %g\n", h.sumValue().Seconds())
+	fmt.Fprintf(w, "tsbs_batch_commit_seconds_count %d\n", cnt)
+}
+
+// startMetricsServer serves the load stats for Prometheus on addr at /metrics.
+// The returned function shuts the server down.
+func (l *BenchmarkRunner) startMetricsServer(addr string) func() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		l.writeMetrics(w)
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server failed: %v", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("could not shut down metrics server: %v", err)
+		}
+	}
+}
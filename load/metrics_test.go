@@ -0,0 +1,38 @@
+package load
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	br := &BenchmarkRunner{}
+	br.rowCnt = 20
+	br.metricCnt = 200
+	br.bytesRead = 4096
+	br.batchLatency.record(3 * time.Millisecond)
+	br.batchLatency.record(200 * time.Millisecond)
+
+	var b bytes.Buffer
+	br.writeMetrics(&b)
+	got := b.String()
+	want := []string{
+		"tsbs_rows_loaded_total 20\n",
+		"tsbs_columns_loaded_total 200\n",
+		"tsbs_input_read_bytes_total 4096\n",
+		"tsbs_batch_commit_seconds_bucket{le=\"0.001\"} 0\n",
+		"tsbs_batch_commit_seconds_bucket{le=\"0.005\"} 1\n",
+		"tsbs_batch_commit_seconds_bucket{le=\"0.1\"} 1\n",
+		"tsbs_batch_commit_seconds_bucket{le=\"0.25\"} 2\n",
+		"tsbs_batch_commit_seconds_bucket{le=\"+Inf\"} 2\n",
+		"tsbs_batch_commit_seconds_sum 0.203\n",
+		"tsbs_batch_commit_seconds_count 2\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("metrics output missing %q:\n%s", w, got)
+		}
+	}
+}
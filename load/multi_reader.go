@@ -0,0 +1,76 @@
+package load
+
+import (
+	"bufio"
+	"sync"
+)
+
+// HeaderSkipper is a Benchmark whose input starts with a header (e.g., a schema)
+// that is consumed by its DBCreator. When loading from multiple files, the header
+// is only read from the first file and skipped on the others.
+type HeaderSkipper interface {
+	Benchmark
+
+	// SkipHeader consumes the header from br, leaving only data to decode
+	SkipHeader(br *bufio.Reader)
+}
+
+// multiReaderDecoder is a PointDecoder that decodes several readers concurrently,
+// each with its own PointDecoder, and returns their points as a single stream.
+type multiReaderDecoder struct {
+	points chan *Point
+	// done is closed by stop when no more points will be read
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newMultiReaderDecoder starts decoding all readers in the background using
+// decoders created by newDecoder. The returned PointDecoder reaches the end of
+// its input only once every reader has been fully decoded.
+func newMultiReaderDecoder(readers []*bufio.Reader, newDecoder func(*bufio.Reader) PointDecoder) *multiReaderDecoder {
+	d := &multiReaderDecoder{
+		points: make(chan *Point, defaultBatchSize),
+		done:   make(chan struct{}),
+	}
+
+	for _, br := range readers {
+		d.wg.Add(1)
+		go func(br *bufio.Reader) {
+			defer d.wg.Done()
+			decoder := newDecoder(br)
+			for {
+				p := decoder.Decode(br)
+				if p == nil {
+					return
+				}
+				select {
+				case d.points <- p:
+				case <-d.done:
+					return
+				}
+			}
+		}(br)
+	}
+
+	// Only signal the end of input after all readers have finished
+	go func() {
+		d.wg.Wait()
+		close(d.points)
+	}()
+
+	return d
+}
+
+// Decode returns the next point decoded from any of the readers, or nil when all are done
+func (d *multiReaderDecoder) Decode(_ *bufio.Reader) *Point {
+	return <-d.points
+}
+
+// stop stops decoding when scanning ends before all readers are fully decoded,
+// e.g., with --limit or --timeout, returning once every reader is no longer in
+// use. It is safe to call more than once.
+func (d *multiReaderDecoder) stop() {
+	d.stopOnce.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
@@ -0,0 +1,75 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiReaderDecoder(t *testing.T) {
+	inputs := []string{"abc", "", "defgh", "i"}
+	readers := make([]*bufio.Reader, 0, len(inputs))
+	for _, in := range inputs {
+		readers = append(readers, bufio.NewReader(bytes.NewBufferString(in)))
+	}
+	d := newMultiReaderDecoder(readers, func(_ *bufio.Reader) PointDecoder {
+		return &testDecoder{}
+	})
+
+	got := []byte{}
+	for {
+		p := d.Decode(nil)
+		if p == nil {
+			break
+		}
+		got = append(got, p.Data.(byte))
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if want := "abcdefghi"; string(got) != want {
+		t.Errorf("incorrect points decoded: got %s want %s", got, want)
+	}
+
+	// Should keep returning nil after all readers are done
+	if p := d.Decode(nil); p != nil {
+		t.Errorf("non-nil point returned after end of input")
+	}
+}
+
+func TestMultiReaderDecoderStop(t *testing.T) {
+	// More points than fit in the channel, so the readers block sending them
+	input := strings.Repeat("x", 3*defaultBatchSize)
+	readers := []*bufio.Reader{
+		bufio.NewReader(bytes.NewBufferString(input)),
+		bufio.NewReader(bytes.NewBufferString(input)),
+	}
+	d := newMultiReaderDecoder(readers, func(_ *bufio.Reader) PointDecoder {
+		return &testDecoder{}
+	})
+	if p := d.Decode(nil); p == nil {
+		t.Fatalf("no point decoded")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		d.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("readers still running after stop")
+	}
+	d.stop()
+
+	// The points already decoded are returned before the end of input
+	n := 0
+	for d.Decode(nil) != nil {
+		n++
+	}
+	if n > defaultBatchSize {
+		t.Errorf("incorrect number of points after stop: got %d want at most %d", n, defaultBatchSize)
+	}
+}
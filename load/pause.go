@@ -0,0 +1,86 @@
+package load
+
+import (
+	"sync"
+	"time"
+)
+
+// scanPause holds back reading the input while a loader asks it to, e.g., for
+// replicas to catch up, while the workers finish the batches already queued.
+// It is safe for concurrent use.
+type scanPause struct {
+	mutex sync.Mutex
+	// resumedCh is closed when reading is resumed, and nil when not paused
+	resumedCh chan struct{}
+	since     time.Time
+	count     int
+	total     time.Duration
+}
+
+// pause pauses reading, returning false if it was already paused
+func (p *scanPause) pause() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.resumedCh != nil {
+		return false
+	}
+	p.resumedCh = make(chan struct{})
+	p.since = time.Now()
+	p.count++
+	return true
+}
+
+// resume resumes reading, returning how long it was paused for, or false if
+// it was not paused
+func (p *scanPause) resume() (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.resumedCh == nil {
+		return 0, false
+	}
+	close(p.resumedCh)
+	p.resumedCh = nil
+	took := time.Since(p.since)
+	p.total += took
+	return took, true
+}
+
+// resumed returns a channel closed when reading is resumed, or nil if reading
+// is not paused
+func (p *scanPause) resumed() <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.resumedCh == nil {
+		return nil
+	}
+	return p.resumedCh
+}
+
+// stats returns the number of times reading was paused and for how long in
+// total, including an ongoing pause
+func (p *scanPause) stats() (int, time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	total := p.total
+	if p.resumedCh != nil {
+		total += time.Since(p.since)
+	}
+	return p.count, total
+}
+
+// PauseScan pauses reading the input, for reason, until ResumeScan is called.
+// The workers finish the batches already queued. Loaders use it to hold back
+// the load while the database needs to catch up, e.g., replicas. It is safe
+// for concurrent use.
+func (l *BenchmarkRunner) PauseScan(reason string) {
+	if l.scanPause.pause() {
+		l.Reportf("PAUSED: reading of the input paused: %s\n", reason)
+	}
+}
+
+// ResumeScan resumes reading the input paused with PauseScan
+func (l *BenchmarkRunner) ResumeScan() {
+	if took, ok := l.scanPause.resume(); ok {
+		l.Reportf("RESUMED: reading of the input resumed after %v\n", took.Round(time.Millisecond))
+	}
+}
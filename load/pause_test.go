@@ -0,0 +1,71 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestScanPause(t *testing.T) {
+	var p scanPause
+	if p.resumed() != nil {
+		t.Errorf("paused before pausing")
+	}
+	if !p.pause() || p.pause() {
+		t.Errorf("incorrect pausing: expected only the first pause to take effect")
+	}
+	resumed := p.resumed()
+	if resumed == nil {
+		t.Fatalf("not paused after pausing")
+	}
+	if _, ok := p.resume(); !ok {
+		t.Errorf("resume did not take effect")
+	}
+	select {
+	case <-resumed:
+	default:
+		t.Errorf("resumed channel not closed on resume")
+	}
+	if _, ok := p.resume(); ok {
+		t.Errorf("resumed when not paused")
+	}
+	p.pause()
+	p.resume()
+	if count, _ := p.stats(); count != 2 {
+		t.Errorf("incorrect number of pauses: got %d want 2", count)
+	}
+}
+
+func TestInterruptibleDecoderPause(t *testing.T) {
+	br := bufio.NewReader(bytes.NewReader([]byte("abcdef")))
+	pause := &scanPause{}
+	inner := &testDecoder{}
+	d := &interruptibleDecoder{PointDecoder: inner, pause: pause}
+
+	pause.pause()
+	decoded := make(chan *Point)
+	go func() { decoded <- d.Decode(br) }()
+	select {
+	case <-decoded:
+		t.Fatalf("decoded while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	pause.resume()
+	if p := <-decoded; p == nil {
+		t.Errorf("decode returned nil after resume")
+	}
+
+	// A timeout stops waiting for the pause to end
+	done := make(chan struct{})
+	d.done = done
+	pause.pause()
+	go func() { decoded <- d.Decode(br) }()
+	close(done)
+	if p := <-decoded; p != nil {
+		t.Errorf("decode returned non-nil point after timeout while paused")
+	}
+	if inner.called != 1 {
+		t.Errorf("wrapped decoder called incorrect number of times: got %d want %d", inner.called, 1)
+	}
+}
@@ -0,0 +1,63 @@
+package load
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// progressSmoothing is the weight of the latest period's row rate in the
+// smoothed rate used for the ETA
+const progressSmoothing = 0.3
+
+// progressHeader is appended to the header of the periodic stats with --total-rows
+const progressHeader = ",complete,eta"
+
+// progress is the progress of the load towards --total-rows
+type progress struct {
+	PercentComplete float64 `json:"percent_complete"`
+	// ETASeconds is negative while the row rate is still unknown
+	ETASeconds float64 `json:"eta_seconds"`
+}
+
+// progressEstimator estimates the progress of a load of total rows from the
+// row counts of the periodic reports. The ETA uses an exponential moving
+// average of the row rate of each period, so that it does not jitter.
+type progressEstimator struct {
+	total uint64
+	rate  float64
+	seen  bool
+}
+
+// update returns the progress once rows have been loaded, given the row rate
+// of the latest period
+func (e *progressEstimator) update(rows uint64, periodRate float64) *progress {
+	// Periods before any rows are loaded, e.g., while creating the database,
+	// do not count towards the rate
+	if !e.seen {
+		e.rate, e.seen = periodRate, periodRate > 0
+	} else {
+		e.rate = progressSmoothing*periodRate + (1-progressSmoothing)*e.rate
+	}
+	p := &progress{PercentComplete: math.Min(100, 100*float64(rows)/float64(e.total)), ETASeconds: -1}
+	switch {
+	case rows >= e.total:
+		p.ETASeconds = 0
+	case e.rate > 0:
+		p.ETASeconds = float64(e.total-rows) / e.rate
+	}
+	return p
+}
+
+// columns returns p as the columns appended to a row of the periodic stats,
+// or nothing if progress is not reported
+func (p *progress) columns() string {
+	if p == nil {
+		return ""
+	}
+	eta := "-"
+	if p.ETASeconds >= 0 {
+		eta = (time.Duration(p.ETASeconds) * time.Second).String()
+	}
+	return fmt.Sprintf(",%0.1f%%,%s", p.PercentComplete, eta)
+}
@@ -0,0 +1,116 @@
+package load
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressSocketWriteTimeout is how long sending the stats to a client of
+// --progress-socket may take before the client is dropped, so that a stuck
+// client cannot hold up the periodic reporting
+const progressSocketWriteTimeout = time.Second
+
+// progressSocket sends the periodic stats as newline-delimited JSON to every
+// client connected to a Unix domain socket, e.g., a TUI, with
+// --progress-socket. Clients may connect and disconnect at any time without
+// affecting the load. It is safe for concurrent use.
+type progressSocket struct {
+	ln      net.Listener
+	mutex   sync.Mutex
+	clients map[net.Conn]struct{}
+	closed  bool
+}
+
+// listenProgressSocket listens for clients to send the stats to on the Unix
+// domain socket at path. A socket file left at path by an earlier load is
+// removed first.
+func listenProgressSocket(path string) (*progressSocket, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &progressSocket{ln: ln, clients: make(map[net.Conn]struct{})}
+	go s.accept()
+	return s, nil
+}
+
+// accept adds each client that connects until the socket is closed
+func (s *progressSocket) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if !closed {
+				log.Printf("progress socket stopped accepting clients: %v", err)
+			}
+			return
+		}
+		s.mutex.Lock()
+		if s.closed {
+			conn.Close()
+		} else {
+			s.clients[conn] = struct{}{}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// send writes v as a single line of JSON to every client, dropping those that
+// disconnected or did not read it in time. Clients are written to
+// concurrently and without holding the lock, so that stalled clients delay
+// the periodic report by at most progressSocketWriteTimeout in total.
+func (s *progressSocket) send(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	b = append(b, '\n')
+	s.mutex.Lock()
+	clients := make([]net.Conn, 0, len(s.clients))
+	for conn := range s.clients {
+		clients = append(clients, conn)
+	}
+	s.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range clients {
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			conn.SetWriteDeadline(time.Now().Add(progressSocketWriteTimeout))
+			if _, err := conn.Write(b); err != nil {
+				conn.Close()
+				s.mutex.Lock()
+				delete(s.clients, conn)
+				s.mutex.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// close disconnects the clients and stops listening, removing the socket file
+func (s *progressSocket) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.ln.Close()
+	for conn := range s.clients {
+		conn.Close()
+		delete(s.clients, conn)
+	}
+}
@@ -0,0 +1,139 @@
+package load
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsbs")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.sock")
+
+	// A socket file left by an earlier load is replaced
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	s, err := listenProgressSocket(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gone, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; ; i++ {
+		s.mutex.Lock()
+		n := len(s.clients)
+		s.mutex.Unlock()
+		if n == 2 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("clients not accepted: got %d want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A client disconnecting does not stop the others from being sent the stats
+	gone.Close()
+	want := periodStats{Timestamp: 1, TotalRows: 10, PeriodRowRate: 5}
+	for i := 0; i < 2; i++ {
+		s.send(want)
+	}
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("cannot read stats: %v", err)
+		}
+		var got periodStats
+		if err := json.Unmarshal(line, &got); err != nil {
+			t.Fatalf("cannot decode stats %q: %v", line, err)
+		}
+		if got.Timestamp != want.Timestamp || got.TotalRows != want.TotalRows || got.PeriodRowRate != want.PeriodRowRate {
+			t.Errorf("incorrect stats: got %+v want %+v", got, want)
+		}
+	}
+	s.mutex.Lock()
+	if n := len(s.clients); n != 1 {
+		t.Errorf("disconnected client not dropped: got %d clients want 1", n)
+	}
+	s.mutex.Unlock()
+
+	s.close()
+	if _, err := r.ReadBytes('\n'); err == nil {
+		t.Errorf("client not disconnected on close")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed on close: %v", err)
+	}
+	// Sending after closing is a no-op
+	s.send(want)
+}
+
+func TestProgressSocketStalledClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsbs")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := listenProgressSocket(filepath.Join(dir, "progress.sock"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.close()
+
+	// Clients that never read fill the socket buffer with a large enough line
+	const stalled = 3
+	for i := 0; i < stalled; i++ {
+		conn, err := net.Dial("unix", filepath.Join(dir, "progress.sock"))
+		if err != nil {
+			t.Fatalf("cannot connect: %v", err)
+		}
+		defer conn.Close()
+	}
+	for i := 0; ; i++ {
+		s.mutex.Lock()
+		n := len(s.clients)
+		s.mutex.Unlock()
+		if n == stalled {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("clients not accepted: got %d want %d", n, stalled)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	s.send(map[string]string{"pad": strings.Repeat("x", 8<<20)})
+	// The clients time out together rather than one after the other
+	if took := time.Since(start); took >= 2*progressSocketWriteTimeout {
+		t.Errorf("sending to stalled clients took too long: %v", took)
+	}
+	s.mutex.Lock()
+	if n := len(s.clients); n != 0 {
+		t.Errorf("stalled clients not dropped: got %d clients want 0", n)
+	}
+	s.mutex.Unlock()
+}
@@ -0,0 +1,42 @@
+package load
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProgressEstimator(t *testing.T) {
+	e := &progressEstimator{total: 1000}
+	cases := []struct {
+		desc        string
+		rows        uint64
+		periodRate  float64
+		wantPercent float64
+		wantETA     float64
+		wantColumns string
+	}{
+		{desc: "nothing loaded yet", rows: 0, periodRate: 0, wantPercent: 0, wantETA: -1, wantColumns: ",0.0%,-"},
+		{desc: "first rate", rows: 100, periodRate: 10, wantPercent: 10, wantETA: 90, wantColumns: ",10.0%,1m30s"},
+		// the smoothed rate is 0.3*20 + 0.7*10 = 13
+		{desc: "smoothed rate", rows: 300, periodRate: 20, wantPercent: 30, wantETA: 700.0 / 13},
+		{desc: "complete", rows: 1000, periodRate: 20, wantPercent: 100, wantETA: 0, wantColumns: ",100.0%,0s"},
+		{desc: "more than total", rows: 1200, periodRate: 20, wantPercent: 100, wantETA: 0},
+	}
+	for _, c := range cases {
+		p := e.update(c.rows, c.periodRate)
+		if p.PercentComplete != c.wantPercent {
+			t.Errorf("%s: incorrect percent: got %v want %v", c.desc, p.PercentComplete, c.wantPercent)
+		}
+		if math.Abs(p.ETASeconds-c.wantETA) > 1e-9 {
+			t.Errorf("%s: incorrect ETA: got %v want %v", c.desc, p.ETASeconds, c.wantETA)
+		}
+		if c.wantColumns != "" && p.columns() != c.wantColumns {
+			t.Errorf("%s: incorrect columns: got %s want %s", c.desc, p.columns(), c.wantColumns)
+		}
+	}
+
+	var none *progress
+	if got := none.columns(); got != "" {
+		t.Errorf("incorrect columns without progress: got %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+package load
+
+import (
+	"bufio"
+	"time"
+)
+
+// maxRateLag is how far reading may fall behind the --max-rows-per-sec
+// schedule, e.g., while waiting for slow workers, before the schedule is
+// restarted. Otherwise the items behind schedule would be read in a burst.
+const maxRateLag = time.Second
+
+// rateLimitedDecoder wraps a PointDecoder so that items are decoded at no more
+// than rate items per second, for a steady load rather than the maximum
+// throughput. Items are spread evenly over time, so batches are sent to the
+// workers at a steady pace as well.
+type rateLimitedDecoder struct {
+	PointDecoder
+	rate  float64
+	start time.Time
+	items uint64
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newRateLimitedDecoder(d PointDecoder, rate uint64) *rateLimitedDecoder {
+	return &rateLimitedDecoder{PointDecoder: d, rate: float64(rate), now: time.Now, sleep: time.Sleep}
+}
+
+// Decode waits until the next item is due, then defers to the wrapped PointDecoder
+func (d *rateLimitedDecoder) Decode(br *bufio.Reader) *Point {
+	now := d.now()
+	if d.items == 0 {
+		d.start = now
+	}
+	due := d.start.Add(time.Duration(float64(d.items) / d.rate * float64(time.Second)))
+	if wait := due.Sub(now); wait > 0 {
+		d.sleep(wait)
+	} else if -wait > maxRateLag {
+		d.start = now
+		d.items = 0
+	}
+	d.items++
+	return d.PointDecoder.Decode(br)
+}
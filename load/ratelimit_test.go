@@ -0,0 +1,51 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedDecoder(t *testing.T) {
+	br := bufio.NewReader(bytes.NewReader([]byte("abcdefgh")))
+	inner := &testDecoder{}
+	d := newRateLimitedDecoder(inner, 4)
+	now := time.Unix(100, 0)
+	var slept time.Duration
+	d.now = func() time.Time { return now }
+	d.sleep = func(wait time.Duration) {
+		slept += wait
+		now = now.Add(wait)
+	}
+
+	// Items are due every 250ms from the first
+	for i := 0; i < 4; i++ {
+		if p := d.Decode(br); p == nil {
+			t.Fatalf("decode %d returned nil", i)
+		}
+	}
+	if want := 750 * time.Millisecond; slept != want {
+		t.Errorf("incorrect wait for 4 items: got %v want %v", slept, want)
+	}
+
+	// Items behind schedule are read without waiting
+	now = now.Add(500 * time.Millisecond)
+	slept = 0
+	d.Decode(br)
+	d.Decode(br)
+	if slept != 0 {
+		t.Errorf("waited %v for items behind schedule", slept)
+	}
+
+	// Falling too far behind restarts the schedule instead of bursting
+	now = now.Add(10 * time.Second)
+	d.Decode(br)
+	d.Decode(br)
+	if want := 250 * time.Millisecond; slept != want {
+		t.Errorf("incorrect wait after falling behind: got %v want %v", slept, want)
+	}
+	if inner.called != 8 {
+		t.Errorf("wrapped decoder called incorrect number of times: got %d want %d", inner.called, 8)
+	}
+}
@@ -0,0 +1,82 @@
+package load
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RunResults are the summary results of a finished load, for a loader to
+// record them, e.g., in a database
+type RunResults struct {
+	Time           time.Time
+	Workers        uint
+	BatchSize      uint
+	TotalRows      uint64
+	ElapsedSeconds float64
+	MeanRowRate    float64
+	MeanColRate    float64
+	Build          BuildInfo
+}
+
+// Results returns the summary results of the load run by RunBenchmark, or
+// false if it did not finish
+func (l *BenchmarkRunner) Results() (RunResults, bool) {
+	if l.results == nil {
+		return RunResults{}, false
+	}
+	s := l.results
+	return RunResults{
+		Time:           time.Unix(s.Timestamp, 0).UTC(),
+		Workers:        s.Workers,
+		BatchSize:      s.BatchSize,
+		TotalRows:      s.TotalRows,
+		ElapsedSeconds: s.ElapsedSeconds,
+		MeanRowRate:    s.MeanRowRate,
+		MeanColRate:    s.MeanColRate,
+		Build:          s.Build,
+	}, true
+}
+
+// resultsHeader is the header row of a --results-file
+var resultsHeader = []string{"date", "workers", "batch_size", "total_rows", "elapsed_seconds", "mean_row_rate", "mean_col_rate"}
+
+// resultsRow returns the row appended to a --results-file for s
+func resultsRow(s summaryStats) []string {
+	return []string{
+		time.Unix(s.Timestamp, 0).UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(s.Workers), 10),
+		strconv.FormatUint(uint64(s.BatchSize), 10),
+		strconv.FormatUint(s.TotalRows, 10),
+		strconv.FormatFloat(s.ElapsedSeconds, 'f', 3, 64),
+		strconv.FormatFloat(s.MeanRowRate, 'f', 2, 64),
+		strconv.FormatFloat(s.MeanColRate, 'f', 2, 64),
+	}
+}
+
+// appendResults appends the results of a run to the CSV file fileName,
+// creating it with a header row if it does not exist or is empty.
+func appendResults(fileName string, s summaryStats) error {
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(resultsHeader)
+	}
+	w.Write(resultsRow(s))
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
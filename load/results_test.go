@@ -0,0 +1,70 @@
+package load
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsbs-results")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "results.csv")
+
+	s := summaryStats{
+		Timestamp:      1451606400,
+		TotalRows:      1000,
+		ElapsedSeconds: 2.5,
+		Workers:        4,
+		BatchSize:      100,
+		MeanColRate:    4000,
+		MeanRowRate:    400,
+	}
+	for i := 0; i < 2; i++ {
+		if err := appendResults(fileName, s); err != nil {
+			t.Fatalf("unexpected error on append %d: %v", i, err)
+		}
+	}
+
+	got, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("could not read results file: %v", err)
+	}
+	row := "2016-01-01T00:00:00Z,4,100,1000,2.500,400.00,4000.00\n"
+	want := "date,workers,batch_size,total_rows,elapsed_seconds,mean_row_rate,mean_col_rate\n" + row + row
+	if string(got) != want {
+		t.Errorf("incorrect results file: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestResults(t *testing.T) {
+	br := &BenchmarkRunner{}
+	if _, ok := br.Results(); ok {
+		t.Errorf("unexpected results before the load finished")
+	}
+	br.Workers = 2
+	br.BatchSize = 5
+	br.metricCnt = 10
+	br.rowCnt = 4
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
+	printFn = func(s string, args ...interface{}) (n int, err error) {
+		return 0, nil
+	}
+	br.summary(2 * time.Second)
+
+	got, ok := br.Results()
+	if !ok {
+		t.Fatalf("no results after the load finished")
+	}
+	got.Time = time.Time{}
+	want := RunResults{Workers: 2, BatchSize: 5, TotalRows: 4, ElapsedSeconds: 2, MeanRowRate: 2, MeanColRate: 5, Build: GetBuildInfo()}
+	if got != want {
+		t.Errorf("incorrect results: got %+v want %+v", got, want)
+	}
+}
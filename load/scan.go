@@ -2,7 +2,10 @@ package load
 
 import (
 	"bufio"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"sync/atomic"
 )
 
 // ackAndMaybeSend adjust the unsent batches count
@@ -44,6 +47,14 @@ type Batch interface {
 	Append(*Point)
 }
 
+// SizedBatch is an optional interface for a Batch that can estimate its size in
+// bytes, which is needed to use --batch-bytes.
+type SizedBatch interface {
+	Batch
+	// Bytes returns the approximate serialized size of the batch in bytes
+	Bytes() int
+}
+
 // Point acts as a 'holder' for the internal representation of a point in a given load client.
 // Instead of using interface{} as a return type, we get compile safety by using Point
 type Point struct {
@@ -87,11 +98,18 @@ type PointDecoder interface {
 // Data is decoded by PointDecoder decoder and then placed into appropriate batches, using the supplied PointIndexer,
 // which are then dispatched to workers (duplexChannel chosen by PointIndexer). Scan does flow control to make sure workers are not left idle for too long
 // and also that the scanning process  does not starve them of CPU.
-func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br *bufio.Reader, decoder PointDecoder, factory BatchFactory, indexer PointIndexer) uint64 {
+// If batchBytes is non-zero, batches are sent once they reach that many bytes
+// instead of once they contain batchSize items. If tuner is non-nil, it sets
+// the number of items per batch instead of batchSize.
+func scanWithIndexer(channels []*duplexChannel, batchSize uint, batchBytes uint64, tuner *batchTuner, limit uint64, br *bufio.Reader, decoder PointDecoder, factory BatchFactory, indexer PointIndexer) uint64 {
 	var itemsRead uint64
 	numChannels := len(channels)
 
-	if batchSize < 1 {
+	if batchBytes > 0 {
+		if _, ok := factory.New().(SizedBatch); !ok {
+			panic("--batch-bytes is not supported by this loader")
+		}
+	} else if tuner == nil && batchSize < 1 {
 		panic("--batch-size cannot be less than 1")
 	}
 
@@ -167,8 +185,11 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 		idx := indexer.GetIndex(item)
 		fillingBatches[idx].Append(item)
 
-		if fillingBatches[idx].Len() >= int(batchSize) {
-			// Batch is full (contains at least batchSize items) - ready to be sent to worker,
+		if tuner != nil {
+			batchSize = tuner.batchSize()
+		}
+		if batchFull(fillingBatches[idx], batchSize, batchBytes) {
+			// Batch is full (contains at least batchSize items or batchBytes bytes) - ready to be sent to worker,
 			// or moved to outstanding, in case no workers available atm.
 			unsentBatches[idx] = sendOrQueueBatch(channels[idx], &ocnt, fillingBatches[idx], unsentBatches[idx])
 			// Place new empty batch
@@ -202,3 +223,38 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 
 	return itemsRead
 }
+
+// parseOnly decodes items from br until the input ends or limit items have
+// been read, discarding them without batching them or sending them to any
+// channel. Each item is counted in rowCnt so that it is reported as it goes.
+func parseOnly(limit uint64, br *bufio.Reader, decoder PointDecoder, rowCnt *uint64) uint64 {
+	var itemsRead uint64
+	for limit == 0 || itemsRead < limit {
+		if decoder.Decode(br) == nil {
+			break
+		}
+		itemsRead++
+		atomic.AddUint64(rowCnt, 1)
+	}
+	return itemsRead
+}
+
+// drainInput reads and discards the rest of r in the background, closing the
+// returned channel once r is exhausted
+func drainInput(r io.Reader) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, r)
+		close(done)
+	}()
+	return done
+}
+
+// batchFull returns whether b has reached batchBytes bytes, if set, or
+// otherwise batchSize items.
+func batchFull(b Batch, batchSize uint, batchBytes uint64) bool {
+	if batchBytes > 0 {
+		return uint64(b.(SizedBatch).Bytes()) >= batchBytes
+	}
+	return b.Len() >= int(batchSize)
+}
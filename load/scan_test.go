@@ -184,6 +184,19 @@ func (f *testFactory) New() Batch {
 	return &testBatch{}
 }
 
+// testSizedBatch counts each item as one byte
+type testSizedBatch struct {
+	testBatch
+}
+
+func (b *testSizedBatch) Bytes() int { return b.len }
+
+type testSizedFactory struct{}
+
+func (f *testSizedFactory) New() Batch {
+	return &testSizedBatch{}
+}
+
 func _checkScan(t *testing.T, desc string, called, read, want uint64) {
 	if called != want {
 		t.Errorf("%s: decoder not called enough: got %d want %d", desc, called, want)
@@ -205,6 +218,8 @@ func TestScanWithIndexer(t *testing.T) {
 	cases := []struct {
 		desc        string
 		batchSize   uint
+		batchBytes  uint64
+		sized       bool
 		limit       uint64
 		wantCalls   uint64
 		shouldPanic bool
@@ -240,12 +255,29 @@ func TestScanWithIndexer(t *testing.T) {
 			limit:       0,
 			shouldPanic: true,
 		},
+		{
+			desc:       "scan w/ batchBytes",
+			batchBytes: 2,
+			sized:      true,
+			limit:      0,
+			wantCalls:  uint64(len(data)),
+		},
+		{
+			desc:        "batchBytes w/o SizedBatch is panic",
+			batchBytes:  2,
+			limit:       0,
+			shouldPanic: true,
+		},
 	}
 	for _, c := range cases {
 		br := bufio.NewReader(bytes.NewReader(data))
 		channels := []*duplexChannel{newDuplexChannel(1)}
 		decoder := &testDecoder{0}
 		indexer := &ConstantIndexer{}
+		var factory BatchFactory = &testFactory{}
+		if c.sized {
+			factory = &testSizedFactory{}
+		}
 		if c.shouldPanic {
 			func() {
 				defer func() {
@@ -253,13 +285,68 @@ func TestScanWithIndexer(t *testing.T) {
 						t.Errorf("%s: did not panic when should", c.desc)
 					}
 				}()
-				scanWithIndexer(channels, c.batchSize, c.limit, br, decoder, &testFactory{}, indexer)
+				scanWithIndexer(channels, c.batchSize, c.batchBytes, nil, c.limit, br, decoder, factory, indexer)
 			}()
 			continue
 		} else {
 			go _boringWorker(channels[0])
-			read := scanWithIndexer(channels, c.batchSize, c.limit, br, decoder, &testFactory{}, indexer)
+			read := scanWithIndexer(channels, c.batchSize, c.batchBytes, nil, c.limit, br, decoder, factory, indexer)
 			_checkScan(t, c.desc, decoder.called, read, c.wantCalls)
 		}
 	}
 }
+
+func TestParseOnly(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x02}
+	cases := []struct {
+		desc      string
+		limit     uint64
+		wantCalls uint64
+	}{
+		{desc: "parse w/ zero limit", limit: 0, wantCalls: uint64(len(data))},
+		{desc: "parse w/ one limit", limit: 1, wantCalls: 1},
+		{desc: "parse w/ over limit", limit: 4, wantCalls: uint64(len(data))},
+	}
+	for _, c := range cases {
+		br := bufio.NewReader(bytes.NewReader(data))
+		decoder := &testDecoder{0}
+		var rows uint64
+		read := parseOnly(c.limit, br, decoder, &rows)
+		_checkScan(t, c.desc, decoder.called, read, c.wantCalls)
+		if rows != c.wantCalls {
+			t.Errorf("%s: rows counted incorrect: got %d want %d", c.desc, rows, c.wantCalls)
+		}
+	}
+}
+
+func TestBatchFull(t *testing.T) {
+	cases := []struct {
+		desc       string
+		len        int
+		batchSize  uint
+		batchBytes uint64
+		want       bool
+	}{
+		{desc: "under batchSize", len: 1, batchSize: 2, want: false},
+		{desc: "at batchSize", len: 2, batchSize: 2, want: true},
+		{desc: "under batchBytes", len: 2, batchSize: 1, batchBytes: 3, want: false},
+		{desc: "at batchBytes", len: 3, batchSize: 1, batchBytes: 3, want: true},
+	}
+	for _, c := range cases {
+		b := &testSizedBatch{testBatch{len: c.len}}
+		if got := batchFull(b, c.batchSize, c.batchBytes); got != c.want {
+			t.Errorf("%s: incorrect result: got %v want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestDrainInput(t *testing.T) {
+	br := bufio.NewReader(bytes.NewBufferString("line1\nline2\nline3\n"))
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-drainInput(br)
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("input not drained: got error %v want EOF", err)
+	}
+}
@@ -0,0 +1,207 @@
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// StatsFormatText prints stats as CSV lines and a human readable summary
+	StatsFormatText = "text"
+	// StatsFormatJSON prints stats as newline-delimited JSON objects
+	StatsFormatJSON = "json"
+)
+
+// periodStats is the JSON representation of a single periodic report
+type periodStats struct {
+	Timestamp      int64       `json:"timestamp"`
+	PeriodColRate  float64     `json:"period_col_rate"`
+	PeriodRowRate  float64     `json:"period_row_rate"`
+	TotalColumns   uint64      `json:"total_columns"`
+	TotalRows      uint64      `json:"total_rows"`
+	ElapsedSeconds float64     `json:"elapsed_seconds"`
+	Memory         *memStats   `json:"memory,omitempty"`
+	Queue          *queueStats `json:"queue,omitempty"`
+	Read           *bytesStats `json:"read,omitempty"`
+	Progress       *progress   `json:"progress,omitempty"`
+}
+
+// memStatsHeader is appended to the header of the periodic stats with --report-mem
+const memStatsHeader = ",heap alloc MB,sys MB,num GC"
+
+// memStats is the loader's own memory usage, reported each period with --report-mem
+type memStats struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// readMemStats returns the current memory usage of the loader
+func readMemStats() *memStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &memStats{
+		HeapAllocBytes: m.HeapAlloc,
+		SysBytes:       m.Sys,
+		NumGC:          m.NumGC,
+	}
+}
+
+// columns returns m as the columns appended to a row of the periodic stats,
+// or nothing if memory usage is not reported
+func (m *memStats) columns() string {
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf(",%0.2f,%0.2f,%d", float64(m.HeapAllocBytes)/(1<<20), float64(m.SysBytes)/(1<<20), m.NumGC)
+}
+
+// queueStatsHeader is appended to the header of the periodic stats with --report-queue
+const queueStatsHeader = ",queued batches,queue capacity"
+
+// queueStats is the number of batches read but not yet picked up by a worker,
+// reported each period with --report-queue. A queue that stays full means the
+// workers cannot keep up with the input, while one that stays empty means the
+// workers are waiting on the input.
+type queueStats struct {
+	Queued   int `json:"queued_batches"`
+	Capacity int `json:"capacity"`
+}
+
+// readQueueStats returns the batches queued to the workers across channels
+func readQueueStats(channels []*duplexChannel) *queueStats {
+	q := &queueStats{}
+	for _, c := range channels {
+		q.Queued += len(c.toWorker)
+		q.Capacity += cap(c.toWorker)
+	}
+	return q
+}
+
+// columns returns q as the columns appended to a row of the periodic stats,
+// or nothing if the queue is not reported
+func (q *queueStats) columns() string {
+	if q == nil {
+		return ""
+	}
+	return fmt.Sprintf(",%d,%d", q.Queued, q.Capacity)
+}
+
+// bytesStatsHeader is appended to the header of the periodic stats with --report-bytes
+const bytesStatsHeader = ",MB read,per. MB/s"
+
+// bytesStats is the input read so far, reported each period with
+// --report-bytes. Bytes are counted as they are handed to the decoder, after
+// any decompression, so a read rate that drops while the queue is empty means
+// the load is bound by reading the input rather than by the database.
+type bytesStats struct {
+	TotalBytes   uint64  `json:"total_bytes"`
+	PeriodMBRate float64 `json:"period_mb_rate"`
+}
+
+// columns returns b as the columns appended to a row of the periodic stats,
+// or nothing if the input read is not reported
+func (b *bytesStats) columns() string {
+	if b == nil {
+		return ""
+	}
+	return fmt.Sprintf(",%0.2f,%0.2f", float64(b.TotalBytes)/(1<<20), b.PeriodMBRate)
+}
+
+// mbPerSec returns the rate in MB per second of reading bytes in took
+func mbPerSec(bytes uint64, took time.Duration) float64 {
+	return float64(bytes) / (1 << 20) / took.Seconds()
+}
+
+// summaryStats is the JSON representation of the final summary of a run
+type summaryStats struct {
+	Timestamp      int64   `json:"timestamp"`
+	TotalColumns   uint64  `json:"total_columns"`
+	TotalRows      uint64  `json:"total_rows"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	WarmupSeconds  float64 `json:"warmup_seconds,omitempty"`
+	Limited        bool    `json:"limited,omitempty"`
+	TargetRowRate  uint64  `json:"target_row_rate,omitempty"`
+	Workers        uint    `json:"workers"`
+	BatchSize      uint    `json:"batch_size"`
+	MeanColRate    float64 `json:"mean_col_rate"`
+	MeanRowRate    float64 `json:"mean_row_rate"`
+	P50LatencyMs   float64 `json:"p50_batch_latency_ms"`
+	P95LatencyMs   float64 `json:"p95_batch_latency_ms"`
+	P99LatencyMs   float64 `json:"p99_batch_latency_ms"`
+	MaxLatencyMs   float64 `json:"max_batch_latency_ms"`
+	TotalBytes     uint64  `json:"total_bytes_read,omitempty"`
+	MeanMBRate     float64 `json:"mean_mb_rate,omitempty"`
+	PausedSeconds  float64 `json:"paused_seconds,omitempty"`
+	// Tables breaks the totals down per table, by descending rows
+	Tables []tableStats `json:"tables,omitempty"`
+	Build  BuildInfo    `json:"build"`
+}
+
+// validateStatsFormat checks that format is one of the supported stats formats
+func validateStatsFormat(format string) error {
+	switch format {
+	case "", StatsFormatText, StatsFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown stats format '%s'", format)
+	}
+}
+
+// durationToMs converts d to fractional milliseconds
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// printJSON prints v as a single line of JSON
+func printJSON(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	printFn("%s\n", b)
+}
+
+// openReportFile sends the periodic stats, batch timings and summary to
+// --report-file instead of STDOUT
+func (l *BenchmarkRunner) openReportFile() error {
+	f, err := os.Create(l.ReportFile)
+	if err != nil {
+		return err
+	}
+	// Unbuffered, so that nothing is lost when the load exits early
+	printFn = func(format string, args ...interface{}) (int, error) {
+		return fmt.Fprintf(f, format, args...)
+	}
+	return nil
+}
+
+// reportMessage is the JSON representation of a line of report output of a
+// loader, so that it does not break the stream of JSON objects
+type reportMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	Event     string `json:"event"`
+	Message   string `json:"message"`
+}
+
+// Reportf writes report output of a loader, such as batch timings, along with
+// the stats to --report-file, or STDOUT if it is not set. With
+// --stats-format=json each line is written as a JSON object with event
+// "report". It is safe for concurrent use.
+func (l *BenchmarkRunner) Reportf(format string, args ...interface{}) {
+	if l.StatsFormat != StatsFormatJSON {
+		printFn(format, args...)
+		return
+	}
+	now := time.Now().Unix()
+	for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		printJSON(reportMessage{Timestamp: now, Event: "report", Message: line})
+	}
+}
@@ -0,0 +1,85 @@
+package load
+
+import (
+	"sort"
+	"sync"
+)
+
+// tableStats is the JSON representation of the metrics and rows loaded into
+// a single table
+type tableStats struct {
+	Table   string `json:"table"`
+	Columns uint64 `json:"columns"`
+	Rows    uint64 `json:"rows"`
+}
+
+// tableCounts counts the metrics and rows loaded into each table, for loads
+// into several tables, so the summary can show how they are distributed. It
+// is safe for concurrent use.
+type tableCounts struct {
+	mutex sync.Mutex
+	m     map[string]*tableStats
+}
+
+func (c *tableCounts) add(table string, metrics, rows uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]*tableStats)
+	}
+	s, ok := c.m[table]
+	if !ok {
+		s = &tableStats{Table: table}
+		c.m[table] = s
+	}
+	s.Columns += metrics
+	s.Rows += rows
+}
+
+// rows returns the number of rows loaded into table
+func (c *tableCounts) rows(table string) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if s, ok := c.m[table]; ok {
+		return s.Rows
+	}
+	return 0
+}
+
+// sorted returns the counts of each table, by descending rows and then by name
+func (c *tableCounts) sorted() []tableStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ret := make([]tableStats, 0, len(c.m))
+	for _, s := range c.m {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Rows != ret[j].Rows {
+			return ret[i].Rows > ret[j].Rows
+		}
+		return ret[i].Table < ret[j].Table
+	})
+	return ret
+}
+
+// AddTableCounts records that metrics and rows were loaded into table. Loaders
+// into several tables call it for each batch so that the summary breaks the
+// totals down per table. It is safe for concurrent use.
+func (l *BenchmarkRunner) AddTableCounts(table string, metrics, rows uint64) {
+	l.tables.add(table, metrics, rows)
+}
+
+// TableRows returns the number of rows recorded with AddTableCounts as loaded
+// into table so far. It is safe for concurrent use.
+func (l *BenchmarkRunner) TableRows(table string) uint64 {
+	return l.tables.rows(table)
+}
+
+// percentOf returns n as a percentage of total, or 0 if total is 0
+func percentOf(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
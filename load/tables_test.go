@@ -0,0 +1,93 @@
+package load
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableCountsSorted(t *testing.T) {
+	var c tableCounts
+	if got := c.sorted(); len(got) != 0 {
+		t.Errorf("incorrect counts before any were added: got %v", got)
+	}
+	c.add("mem", 10, 1)
+	c.add("cpu", 100, 10)
+	c.add("disk", 7, 1)
+	c.add("mem", 20, 2)
+	want := []tableStats{
+		{Table: "cpu", Columns: 100, Rows: 10},
+		{Table: "mem", Columns: 30, Rows: 3},
+		{Table: "disk", Columns: 7, Rows: 1},
+	}
+	if got := c.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect sorted counts: got %v want %v", got, want)
+	}
+}
+
+func TestSummaryTables(t *testing.T) {
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
+	for _, format := range []string{StatsFormatText, StatsFormatJSON} {
+		br := &BenchmarkRunner{}
+		br.StatsFormat = format
+		br.metricCnt = 100
+		br.rowCnt = 10
+		br.AddTableCounts("mem", 10, 1)
+		br.AddTableCounts("cpu", 90, 9)
+		var b bytes.Buffer
+		printFn = func(s string, args ...interface{}) (n int, err error) {
+			return fmt.Fprintf(&b, s, args...)
+		}
+		br.summary(time.Second)
+
+		if format == StatsFormatText {
+			want := "per table:\n  cpu: 9 rows (90.0%), 90 metrics\n  mem: 1 rows (10.0%), 10 metrics\n"
+			if got := b.String(); !strings.HasSuffix(got, want) {
+				t.Errorf("text summary does not end with the per-table counts: got\n%s\nwant suffix\n%s", got, want)
+			}
+			continue
+		}
+		var got summaryStats
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatalf("summary is not valid JSON: %v\n%s", err, b.String())
+		}
+		want := []tableStats{{Table: "cpu", Columns: 90, Rows: 9}, {Table: "mem", Columns: 10, Rows: 1}}
+		if !reflect.DeepEqual(got.Tables, want) {
+			t.Errorf("incorrect per-table counts in JSON summary: got %v want %v", got.Tables, want)
+		}
+	}
+}
+
+func TestSummaryTablesSingleTable(t *testing.T) {
+	oldPrintFn := printFn
+	defer func() { printFn = oldPrintFn }()
+	br := &BenchmarkRunner{}
+	br.rowCnt = 1
+	br.AddTableCounts("cpu", 10, 1)
+	var b bytes.Buffer
+	printFn = func(s string, args ...interface{}) (n int, err error) {
+		return fmt.Fprintf(&b, s, args...)
+	}
+	br.summary(time.Second)
+	if strings.Contains(b.String(), "per table") {
+		t.Errorf("per-table counts printed for a single table:\n%s", b.String())
+	}
+}
+
+func TestTableRows(t *testing.T) {
+	br := &BenchmarkRunner{}
+	if got := br.TableRows("cpu"); got != 0 {
+		t.Errorf("incorrect rows before any were loaded: got %d want 0", got)
+	}
+	br.AddTableCounts("cpu", 10, 1)
+	br.AddTableCounts("cpu", 20, 2)
+	br.AddTableCounts("mem", 5, 1)
+	if got := br.TableRows("cpu"); got != 3 {
+		t.Errorf("incorrect rows: got %d want 3", got)
+	}
+}
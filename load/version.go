@@ -0,0 +1,31 @@
+package load
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version and Commit identify the build of the loaders, and are set by the
+// linker, e.g.:
+//
+//	go install -ldflags "-X github.com/timescale/tsbs/load.Version=0.1.0 -X github.com/timescale/tsbs/load.Commit=$(git rev-parse --short HEAD)" ./...
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// BuildInfo identifies the build that produced a run
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// GetBuildInfo returns the build info of the running binary
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, %s)", b.Version, b.Commit, b.GoVersion)
+}
@@ -0,0 +1,45 @@
+package load
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmupBaseline holds the counts at the end of the warm-up period set by
+// --warmup-seconds, which are excluded from rate calculations.
+type warmupBaseline struct {
+	mutex     sync.Mutex
+	done      bool
+	elapsed   time.Duration
+	metricCnt uint64
+	rowCnt    uint64
+}
+
+// endWarmup records the current counts as the baseline for rates, elapsed
+// after the start of the load
+func (l *BenchmarkRunner) endWarmup(elapsed time.Duration) {
+	metricCnt := atomic.LoadUint64(&l.metricCnt)
+	rowCnt := atomic.LoadUint64(&l.rowCnt)
+	l.warmup.mutex.Lock()
+	l.warmup.done = true
+	l.warmup.elapsed = elapsed
+	l.warmup.metricCnt = metricCnt
+	l.warmup.rowCnt = rowCnt
+	l.warmup.mutex.Unlock()
+	log.Printf("warm-up ended after %v; rates exclude the %d metrics and %d rows loaded during it", elapsed, metricCnt, rowCnt)
+}
+
+// exclude returns the metric and row counts and the time elapsed since the
+// end of the warm-up, given the totals since the start of the load, along with
+// the length of the warm-up. The totals are returned as-is if the warm-up has
+// not ended.
+func (w *warmupBaseline) exclude(metricCnt, rowCnt uint64, elapsed time.Duration) (uint64, uint64, time.Duration, time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.done || elapsed <= w.elapsed {
+		return metricCnt, rowCnt, elapsed, 0
+	}
+	return metricCnt - w.metricCnt, rowCnt - w.rowCnt, elapsed - w.elapsed, w.elapsed
+}
@@ -0,0 +1,62 @@
+package load
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWarmupBaselineExclude(t *testing.T) {
+	cases := []struct {
+		desc        string
+		baseline    warmupBaseline
+		elapsed     time.Duration
+		wantMetrics uint64
+		wantRows    uint64
+		wantElapsed time.Duration
+		wantWarmup  time.Duration
+	}{
+		{
+			desc:        "warm-up not ended",
+			elapsed:     10 * time.Second,
+			wantMetrics: 100,
+			wantRows:    10,
+			wantElapsed: 10 * time.Second,
+		},
+		{
+			desc:        "warm-up ended",
+			baseline:    warmupBaseline{done: true, elapsed: 4 * time.Second, metricCnt: 30, rowCnt: 3},
+			elapsed:     10 * time.Second,
+			wantMetrics: 70,
+			wantRows:    7,
+			wantElapsed: 6 * time.Second,
+			wantWarmup:  4 * time.Second,
+		},
+		{
+			desc:        "warm-up ended at elapsed",
+			baseline:    warmupBaseline{done: true, elapsed: 10 * time.Second, metricCnt: 100, rowCnt: 10},
+			elapsed:     10 * time.Second,
+			wantMetrics: 100,
+			wantRows:    10,
+			wantElapsed: 10 * time.Second,
+		},
+	}
+	for i := range cases {
+		c := &cases[i]
+		metrics, rows, elapsed, warmup := c.baseline.exclude(100, 10, c.elapsed)
+		if metrics != c.wantMetrics || rows != c.wantRows {
+			t.Errorf("%s: incorrect counts: got %d, %d want %d, %d", c.desc, metrics, rows, c.wantMetrics, c.wantRows)
+		}
+		if elapsed != c.wantElapsed || warmup != c.wantWarmup {
+			t.Errorf("%s: incorrect durations: got %v, %v want %v, %v", c.desc, elapsed, warmup, c.wantElapsed, c.wantWarmup)
+		}
+	}
+}
+
+func TestEndWarmup(t *testing.T) {
+	br := &BenchmarkRunner{metricCnt: 50, rowCnt: 5}
+	br.endWarmup(2 * time.Second)
+	metrics, rows, elapsed, warmup := br.warmup.exclude(80, 8, 5*time.Second)
+	if metrics != 30 || rows != 3 || elapsed != 3*time.Second || warmup != 2*time.Second {
+		t.Errorf("incorrect values after warm-up: got %d, %d, %v, %v", metrics, rows, elapsed, warmup)
+	}
+}